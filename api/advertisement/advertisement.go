@@ -0,0 +1,264 @@
+package advertisement
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AD structure types used by beacon advertisements
+const (
+	adTypeCompleteServiceUUIDs16 = 0x03
+	adTypeServiceData16          = 0x16
+	adTypeManufacturerData       = 0xFF
+)
+
+// Identifiers that mark iBeacon and Eddystone payloads
+const (
+	appleCompanyID       = 0x004C
+	iBeaconType          = 0x02
+	iBeaconLength        = 0x15
+	eddystoneServiceUUID = 0xFEAA
+)
+
+// Eddystone frame types
+const (
+	EddystoneFrameUID = 0x00
+	EddystoneFrameURL = 0x10
+	EddystoneFrameTLM = 0x20
+	EddystoneFrameEID = 0x30
+)
+
+var ErrMalformed = errors.New("malformed advertisement")
+var ErrNoBeaconFrame = errors.New("advertisement contains no beacon frame")
+
+// Advertisement holds every beacon frame found in a single advertising payload
+type Advertisement struct {
+	IBeacon      *IBeacon      `json:"ibeacon,omitempty"`
+	EddystoneUID *EddystoneUID `json:"eddystone_uid,omitempty"`
+	EddystoneURL *EddystoneURL `json:"eddystone_url,omitempty"`
+	EddystoneTLM *EddystoneTLM `json:"eddystone_tlm,omitempty"`
+	EddystoneEID *EddystoneEID `json:"eddystone_eid,omitempty"`
+}
+
+// IBeacon is Apple's proximity beacon frame. TxPower is the calibrated RSSI at one metre.
+type IBeacon struct {
+	UUID    string `json:"uuid"`
+	Major   uint16 `json:"major"`
+	Minor   uint16 `json:"minor"`
+	TxPower int8   `json:"tx_power"`
+}
+
+// EddystoneUID identifies a beacon by a 10 byte namespace and 6 byte instance.
+// TxPower is the calibrated RSSI at zero metres.
+type EddystoneUID struct {
+	Namespace string `json:"namespace"`
+	Instance  string `json:"instance"`
+	TxPower   int8   `json:"tx_power"`
+}
+
+// EddystoneURL broadcasts a compressed URL
+type EddystoneURL struct {
+	URL     string `json:"url"`
+	TxPower int8   `json:"tx_power"`
+}
+
+// EddystoneTLM carries unencrypted beacon telemetry. Temperature is nil when the
+// beacon does not support it. Uptime is measured in tenths of a second.
+type EddystoneTLM struct {
+	BatteryMillivolts  uint16   `json:"battery_millivolts"`
+	Temperature        *float64 `json:"temperature"`
+	AdvertisementCount uint32   `json:"advertisement_count"`
+	UptimeDeciseconds  uint32   `json:"uptime_deciseconds"`
+}
+
+// EddystoneEID broadcasts a rotating ephemeral identifier
+type EddystoneEID struct {
+	EphemeralID string `json:"ephemeral_id"`
+	TxPower     int8   `json:"tx_power"`
+}
+
+// ParseHex decodes a hex encoded advertising payload, as forwarded by gateways
+func ParseHex(payload string) (*Advertisement, error) {
+	data, err := hex.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes the AD structures of an advertising payload and returns the
+// beacon frames it contains
+func Parse(data []byte) (*Advertisement, error) {
+	adv := Advertisement{}
+	found := false
+
+	for offset := 0; offset < len(data); {
+		length := int(data[offset])
+		// a zero length structure marks the early end of significant data
+		if length == 0 {
+			break
+		}
+		if offset+1+length > len(data) {
+			return nil, fmt.Errorf("%w: structure at offset %d overruns payload", ErrMalformed, offset)
+		}
+
+		adType := data[offset+1]
+		value := data[offset+2 : offset+1+length]
+		offset += 1 + length
+
+		var err error
+		switch adType {
+		case adTypeManufacturerData:
+			var frame *IBeacon
+			frame, err = parseIBeacon(value)
+			if frame != nil {
+				adv.IBeacon = frame
+				found = true
+			}
+		case adTypeServiceData16:
+			var parsed bool
+			parsed, err = parseEddystone(value, &adv)
+			found = found || parsed
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !found {
+		return nil, ErrNoBeaconFrame
+	}
+	return &adv, nil
+}
+
+// parseIBeacon returns nil without an error for manufacturer data that is not an iBeacon
+func parseIBeacon(value []byte) (*IBeacon, error) {
+	if len(value) < 4 || binary.LittleEndian.Uint16(value) != appleCompanyID || value[2] != iBeaconType {
+		return nil, nil
+	}
+	if value[3] != iBeaconLength || len(value) < 4+iBeaconLength {
+		return nil, fmt.Errorf("%w: truncated ibeacon frame", ErrMalformed)
+	}
+
+	frame := value[4:]
+	return &IBeacon{
+		UUID:    formatUUID(frame[0:16]),
+		Major:   binary.BigEndian.Uint16(frame[16:18]),
+		Minor:   binary.BigEndian.Uint16(frame[18:20]),
+		TxPower: int8(frame[20]),
+	}, nil
+}
+
+// parseEddystone reports false without an error for service data that is not Eddystone
+func parseEddystone(value []byte, adv *Advertisement) (bool, error) {
+	if len(value) < 3 || binary.LittleEndian.Uint16(value) != eddystoneServiceUUID {
+		return false, nil
+	}
+
+	frame := value[3:]
+	switch value[2] {
+	case EddystoneFrameUID:
+		if len(frame) < 17 {
+			return false, fmt.Errorf("%w: truncated eddystone uid frame", ErrMalformed)
+		}
+		adv.EddystoneUID = &EddystoneUID{
+			TxPower:   int8(frame[0]),
+			Namespace: strings.ToUpper(hex.EncodeToString(frame[1:11])),
+			Instance:  strings.ToUpper(hex.EncodeToString(frame[11:17])),
+		}
+	case EddystoneFrameURL:
+		if len(frame) < 2 {
+			return false, fmt.Errorf("%w: truncated eddystone url frame", ErrMalformed)
+		}
+		url, err := decodeURL(frame[1:])
+		if err != nil {
+			return false, err
+		}
+		adv.EddystoneURL = &EddystoneURL{URL: url, TxPower: int8(frame[0])}
+	case EddystoneFrameTLM:
+		tlm, err := parseTLM(frame)
+		if err != nil {
+			return false, err
+		}
+		adv.EddystoneTLM = tlm
+	case EddystoneFrameEID:
+		if len(frame) < 9 {
+			return false, fmt.Errorf("%w: truncated eddystone eid frame", ErrMalformed)
+		}
+		adv.EddystoneEID = &EddystoneEID{
+			TxPower:     int8(frame[0]),
+			EphemeralID: strings.ToUpper(hex.EncodeToString(frame[1:9])),
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseTLM(frame []byte) (*EddystoneTLM, error) {
+	if len(frame) < 13 {
+		return nil, fmt.Errorf("%w: truncated eddystone tlm frame", ErrMalformed)
+	}
+	if frame[0] != 0x00 {
+		return nil, fmt.Errorf("%w: unsupported eddystone tlm version %d", ErrMalformed, frame[0])
+	}
+
+	tlm := EddystoneTLM{
+		BatteryMillivolts:  binary.BigEndian.Uint16(frame[1:3]),
+		AdvertisementCount: binary.BigEndian.Uint32(frame[5:9]),
+		UptimeDeciseconds:  binary.BigEndian.Uint32(frame[9:13]),
+	}
+
+	// temperature is signed 8.8 fixed point, 0x8000 when not supported
+	rawTemperature := binary.BigEndian.Uint16(frame[3:5])
+	if rawTemperature != 0x8000 {
+		temperature := float64(int16(rawTemperature)) / 256
+		tlm.Temperature = &temperature
+	}
+	return &tlm, nil
+}
+
+var urlSchemes = []string{"http://www.", "https://www.", "http://", "https://"}
+
+var urlExpansions = []string{
+	".com/", ".org/", ".edu/", ".net/", ".info/", ".biz/", ".gov/",
+	".com", ".org", ".edu", ".net", ".info", ".biz", ".gov",
+}
+
+func decodeURL(encoded []byte) (string, error) {
+	if int(encoded[0]) >= len(urlSchemes) {
+		return "", fmt.Errorf("%w: unknown eddystone url scheme %d", ErrMalformed, encoded[0])
+	}
+
+	var url strings.Builder
+	url.WriteString(urlSchemes[encoded[0]])
+	for _, c := range encoded[1:] {
+		switch {
+		case int(c) < len(urlExpansions):
+			url.WriteString(urlExpansions[c])
+		case c > 0x20 && c < 0x7F:
+			url.WriteByte(c)
+		default:
+			return "", fmt.Errorf("%w: invalid eddystone url character 0x%02x", ErrMalformed, c)
+		}
+	}
+	return url.String(), nil
+}
+
+// NormalizeUUID rewrites a 128 bit UUID, with or without hyphens, into the upper
+// case hyphenated form used for iBeacon identities
+func NormalizeUUID(s string) (string, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(s), "-", ""))
+	if err != nil || len(b) != 16 {
+		return "", fmt.Errorf("invalid uuid %q", s)
+	}
+	return formatUUID(b), nil
+}
+
+func formatUUID(b []byte) string {
+	s := strings.ToUpper(hex.EncodeToString(b))
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
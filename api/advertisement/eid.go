@@ -0,0 +1,73 @@
+package advertisement
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// MaxEIDRotationExponent is the largest rotation exponent Eddystone-EID allows,
+// giving a rotation period of 2^15 seconds (about nine hours)
+const MaxEIDRotationExponent = 15
+
+var ErrInvalidIdentityKey = errors.New("eid identity key must be 16 bytes of hex")
+var ErrInvalidEphemeralID = errors.New("ephemeral id must be 8 bytes of hex")
+
+// EIDCounter is the time counter a beacon uses for EID computation. Beacons
+// registered with this service count seconds since the unix epoch.
+func EIDCounter(t time.Time) uint32 {
+	return uint32(t.Unix())
+}
+
+// EIDRotationPeriod is how long a beacon broadcasts the same ephemeral id
+func EIDRotationPeriod(rotationExponent uint8) time.Duration {
+	return time.Duration(1<<rotationExponent) * time.Second
+}
+
+// ComputeEID derives the ephemeral id a beacon broadcasts at the given time
+// counter, following the Eddystone-EID computation: a temporary key is encrypted
+// from the identity key and the top half of the counter, then used to encrypt the
+// counter with its lowest rotationExponent bits cleared
+func ComputeEID(identityKey string, rotationExponent uint8, counter uint32) (string, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(identityKey))
+	if err != nil || len(key) != aes.BlockSize {
+		return "", ErrInvalidIdentityKey
+	}
+	if rotationExponent > MaxEIDRotationExponent {
+		return "", errors.New("eid rotation exponent must be between 0 and 15")
+	}
+
+	identityCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	keyData := make([]byte, aes.BlockSize)
+	keyData[11] = 0xFF
+	binary.BigEndian.PutUint16(keyData[14:], uint16(counter>>16))
+	temporaryKey := make([]byte, aes.BlockSize)
+	identityCipher.Encrypt(temporaryKey, keyData)
+
+	temporaryCipher, err := aes.NewCipher(temporaryKey)
+	if err != nil {
+		return "", err
+	}
+	eidData := make([]byte, aes.BlockSize)
+	eidData[11] = rotationExponent
+	binary.BigEndian.PutUint32(eidData[12:], counter&^(1<<rotationExponent-1))
+	eid := make([]byte, aes.BlockSize)
+	temporaryCipher.Encrypt(eid, eidData)
+
+	return strings.ToUpper(hex.EncodeToString(eid[:8])), nil
+}
+
+// NormalizeEphemeralID rewrites an ephemeral id into the form the advertisement parser produces
+func NormalizeEphemeralID(ephemeralID string) (string, error) {
+	ephemeralID = strings.ToUpper(strings.TrimSpace(ephemeralID))
+	if _, err := hex.DecodeString(ephemeralID); err != nil || len(ephemeralID) != 16 {
+		return "", ErrInvalidEphemeralID
+	}
+	return ephemeralID, nil
+}
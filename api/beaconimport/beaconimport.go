@@ -0,0 +1,254 @@
+package beaconimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/macaddress"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/jinzhu/gorm"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Outcomes reported for each imported row
+const (
+	StatusCreated             = "created"
+	StatusDuplicate           = "duplicate"
+	StatusInvalidMac          = "invalid_mac"
+	StatusUnknownOrganisation = "unknown_organisation"
+	StatusUnauthorized        = "unauthorized"
+)
+
+// Row is a single beacon to import
+type Row struct {
+	MacAddress     string `json:"mac_address"`
+	OrganisationID uint64 `json:"organisation_id"`
+	Placement      string `json:"placement"`
+}
+
+// Result describes what happened to a single row. Rows are numbered from one in
+// the order they were supplied.
+type Result struct {
+	Row        int    `json:"row"`
+	MacAddress string `json:"mac_address"`
+	Status     string `json:"status"`
+	BeaconID   uint64 `json:"beacon_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Options control how an import is carried out
+type Options struct {
+	// DryRun reports the results without committing anything
+	DryRun bool
+	// ActorID is recorded against the registration of every imported beacon
+	ActorID uint32
+	// Authorize reports whether the actor may import beacons into the
+	// organisation, or without one when given zero. Every row is allowed when nil.
+	Authorize func(organisationID uint64) bool
+}
+
+// Report summarises an import
+type Report struct {
+	DryRun  bool           `json:"dry_run"`
+	Counts  map[string]int `json:"counts"`
+	Results []Result       `json:"results"`
+}
+
+// ParseCSV reads rows from CSV with a header line. The mac_address column is
+// required, organisation_id and placement are optional.
+func ParseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty import")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["mac_address"]; !ok {
+		return nil, errors.New("import is missing the mac_address column")
+	}
+
+	column := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := Row{
+			MacAddress: column(record, "mac_address"),
+			Placement:  column(record, "placement"),
+		}
+		if organisationID := column(record, "organisation_id"); organisationID != "" {
+			row.OrganisationID, err = strconv.ParseUint(organisationID, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid organisation_id %q", len(rows)+1, organisationID)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseJSON reads rows from a JSON array of objects
+func ParseJSON(r io.Reader) ([]Row, error) {
+	var rows []Row
+	err := json.NewDecoder(r).Decode(&rows)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Import creates a beacon for every valid row within a single transaction. Rows
+// with an organisation are registered with it, the rest are left unowned. Rows
+// that cannot be created are reported rather than failing the batch; only
+// database errors abort the import. A dry run reports the same results without
+// committing anything.
+func Import(db *gorm.DB, rows []Row, options Options) (*Report, error) {
+	report := Report{
+		DryRun: options.DryRun,
+		Counts: map[string]int{
+			StatusCreated:             0,
+			StatusDuplicate:           0,
+			StatusInvalidMac:          0,
+			StatusUnknownOrganisation: 0,
+			StatusUnauthorized:        0,
+		},
+		Results: []Result{},
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	organisations := map[uint64]bool{}
+	authorized := map[uint64]bool{}
+	seen := map[string]bool{}
+
+	for i, row := range rows {
+		result := Result{Row: i + 1, MacAddress: row.MacAddress}
+
+		status, err := importRow(tx, row, options, organisations, authorized, seen, &result)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		result.Status = status
+
+		report.Counts[status]++
+		report.Results = append(report.Results, result)
+	}
+
+	if options.DryRun {
+		tx.Rollback()
+		return &report, nil
+	}
+
+	err := tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func importRow(tx *gorm.DB, row Row, options Options, organisations, authorized map[uint64]bool, seen map[string]bool, result *Result) (string, error) {
+	normalized, err := macaddress.Normalize(row.MacAddress)
+	if err != nil {
+		result.Error = err.Error()
+		return StatusInvalidMac, nil
+	}
+	result.MacAddress = normalized
+
+	if row.OrganisationID != 0 {
+		known, checked := organisations[row.OrganisationID]
+		if !checked {
+			organisation := models.Organisation{}
+			_, err = organisation.FindOrganisationByID(tx, row.OrganisationID)
+			if err != nil && err != models.ErrOrganisationNotFound {
+				return "", err
+			}
+			known = err == nil
+			organisations[row.OrganisationID] = known
+		}
+		if !known {
+			result.Error = fmt.Sprintf("organisation (ID: %d) not found", row.OrganisationID)
+			return StatusUnknownOrganisation, nil
+		}
+	}
+
+	if options.Authorize != nil {
+		allowed, checked := authorized[row.OrganisationID]
+		if !checked {
+			allowed = options.Authorize(row.OrganisationID)
+			authorized[row.OrganisationID] = allowed
+		}
+		if !allowed {
+			result.Error = "not allowed to import beacons into this organisation"
+			if row.OrganisationID == 0 {
+				result.Error = "not allowed to import beacons without an organisation"
+			}
+			return StatusUnauthorized, nil
+		}
+	}
+
+	if seen[normalized] {
+		result.Error = "mac address appears earlier in the import"
+		return StatusDuplicate, nil
+	}
+	seen[normalized] = true
+
+	existing := models.Beacon{}
+	_, err = existing.FindBeaconByMacAddress(tx, normalized)
+	if err == nil {
+		result.BeaconID = existing.ID
+		result.Error = "mac address already registered"
+		return StatusDuplicate, nil
+	}
+	if err != models.ErrBeaconNotFound {
+		return "", err
+	}
+
+	beacon := models.Beacon{
+		MacAddress: normalized,
+		Placement:  row.Placement,
+		Status:     models.BeaconStatusUnclaimed,
+	}
+	_, err = beacon.SaveBeacon(tx)
+	if err != nil {
+		return "", err
+	}
+	result.BeaconID = beacon.ID
+
+	if row.OrganisationID != 0 {
+		err = beacon.RegisterImportedBeacon(tx, row.OrganisationID, options.ActorID, "imported")
+		if err != nil {
+			return "", err
+		}
+	}
+	return StatusCreated, nil
+}
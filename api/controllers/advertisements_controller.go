@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/macaddress"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type resolveAdvertisementRequest struct {
+	Payload    string `json:"payload"`
+	MacAddress string `json:"mac_address"`
+}
+
+type resolveAdvertisementResponse struct {
+	Advertisement *advertisement.Advertisement `json:"advertisement"`
+	Beacon        *models.Beacon               `json:"beacon"`
+}
+
+// eidResolveWindow reads how many rotation periods either side of the observation
+// time an ephemeral id is searched for from EID_RESOLVE_WINDOW
+func eidResolveWindow() int {
+	value := os.Getenv("EID_RESOLVE_WINDOW")
+	if value == "" {
+		return models.DefaultEIDResolveWindow
+	}
+
+	window, err := strconv.Atoi(value)
+	if err != nil || window < 0 {
+		log.Printf("invalid EID_RESOLVE_WINDOW %q, using %d", value, models.DefaultEIDResolveWindow)
+		return models.DefaultEIDResolveWindow
+	}
+	return window
+}
+
+// ResolveAdvertisement decodes a raw advertising payload forwarded by a gateway and
+// identifies the beacon that broadcast it
+func (s *Server) ResolveAdvertisement(w http.ResponseWriter, r *http.Request) {
+	_, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	resolveRequest := resolveAdvertisementRequest{}
+	err = json.Unmarshal(body, &resolveRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	adv, err := advertisement.ParseHex(resolveRequest.Payload)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	beaconResolved, err := beacon.ResolveAdvertisement(s.DB, adv, resolveRequest.MacAddress, time.Now(), eidResolveWindow())
+	if errors.Is(err, macaddress.ErrInvalidMacAddress) || err == advertisement.ErrInvalidEphemeralID {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, resolveAdvertisementResponse{
+		Advertisement: adv,
+		Beacon:        beaconResolved,
+	})
+}
@@ -32,12 +32,25 @@ func (s *Server) Initialize(dbDriver, dbUser, dbPort, dbPassword, dbHost, dbName
 		}
 	}
 
-	s.DB.Debug().AutoMigrate(&models.User{}, &models.Ticket{}) // Database migration
+	s.DB.Debug().AutoMigrate(&models.User{}, &models.Ticket{}, &models.Organisation{}, &models.Location{}, &models.Beacon{}, &models.Puc{}, &models.PucCustody{}, &models.PucLossReport{}, &models.PucAlert{}, &models.CheckIn{}, &models.Visit{}, &models.Sighting{}, &models.OccupancySnapshot{}, &models.BeaconStatusTransition{}, &models.BeaconTelemetry{}, &models.BeaconEventType{}, &models.BeaconEvent{}, &models.CheckInNonce{}, &models.Label{}, &models.BeaconTransfer{}, &models.BeaconClaimCode{}, &models.BeaconEphemeralID{}, &models.Gateway{}, &models.CheckInRejection{}) // Database migration
+	err = models.CreateBeaconIdentityIndexes(s.DB)
+	if err != nil {
+		log.Fatal("[Error] ", err)
+	}
+	err = models.SeedBeaconEventTypes(s.DB)
+	if err != nil {
+		log.Fatal("[Error] ", err)
+	}
+
 	s.Router = mux.NewRouter()
 	s.initializeRoutes()
 }
 
 func (s *Server) Run(addr string) {
+	go s.runOfflineDetector(offlineCheckInterval())
+	go s.runOccupancySnapshotter(occupancySnapshotInterval())
+	go s.runEIDRefresher(eidSchedule())
+
 	fmt.Println("Listening to port 8080")
 	log.Fatal(http.ListenAndServe(addr, s.Router))
 }
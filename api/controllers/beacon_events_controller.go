@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"net/http"
+	"time"
+)
+
+const defaultBeaconEventRange = 30 * 24 * time.Hour
+
+// GetBeaconEvents returns the beacon's event log between from and to (RFC 3339,
+// defaulting to the last 30 days), newest first. type takes a comma separated
+// list of event types to filter by. Only the beacon's administrator reads it.
+func (s *Server) GetBeaconEvents(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultBeaconEventRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	eventTypes, err := models.ValidateBeaconEventTypes(r.URL.Query().Get("type"))
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	event := models.BeaconEvent{}
+	events, err := event.FindBeaconEvents(s.DB, beacon.ID, eventTypes, from, to)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, events)
+}
+
+// GetBeaconCheckInRejections returns how many check-ins the beacon rejected, by
+// reason and hour, between from and to (defaulting to the last 30 days). Only the
+// beacon's administrator reads it, and only for the time it owned the beacon.
+func (s *Server) GetBeaconCheckInRejections(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultBeaconEventRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rejections, err := models.FindCheckInRejections(s.DB, beacon.ID, beacon.OrganisationID, from, to)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, rejections)
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"log"
+	"os"
+	"time"
+)
+
+const defaultOfflineCheckInterval = time.Minute
+
+// offlineCheckInterval reads how often beacons are checked for silence from
+// BEACON_OFFLINE_CHECK_INTERVAL, e.g. "30s" or "5m"
+func offlineCheckInterval() time.Duration {
+	value := os.Getenv("BEACON_OFFLINE_CHECK_INTERVAL")
+	if value == "" {
+		return defaultOfflineCheckInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("invalid BEACON_OFFLINE_CHECK_INTERVAL %q, using %s", value, defaultOfflineCheckInterval)
+		return defaultOfflineCheckInterval
+	}
+	return interval
+}
+
+// runOfflineDetector periodically marks beacons that have gone silent as offline.
+// Beacons come back online as soon as they are heard again.
+func (s *Server) runOfflineDetector(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		marked, err := models.MarkOfflineBeacons(s.DB, now)
+		if err != nil {
+			log.Printf("[ERROR] unable to mark offline beacons: %v", err)
+			continue
+		}
+		if marked > 0 {
+			log.Printf("marked %d beacon(s) offline", marked)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"net/http"
+	"strconv"
+)
+
+// GetNearbyBeacons lists the beacons within radius metres of lat/lng, nearest first
+func (s *Server) GetNearbyBeacons(w http.ResponseWriter, r *http.Request) {
+	values, err := parseFloatParams(r, "lat", "lng", "radius")
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	floor, err := parseFloorParam(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	beacons, err := beacon.FindBeaconsWithinRadius(s.DB, values[0], values[1], values[2], floor)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beacons)
+}
+
+// GetBeaconsInBoundingBox lists the beacons placed inside the min_lat/min_lng, max_lat/max_lng rectangle
+func (s *Server) GetBeaconsInBoundingBox(w http.ResponseWriter, r *http.Request) {
+	values, err := parseFloatParams(r, "min_lat", "min_lng", "max_lat", "max_lng")
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	floor, err := parseFloorParam(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	box := models.BoundingBox{
+		MinLatitude:  values[0],
+		MinLongitude: values[1],
+		MaxLatitude:  values[2],
+		MaxLongitude: values[3],
+	}
+
+	beacon := models.Beacon{}
+	beacons, err := beacon.FindBeaconsInBoundingBox(s.DB, box, floor)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beacons)
+}
+
+// GetNearestBeacon finds the placed beacon closest to lat/lng
+func (s *Server) GetNearestBeacon(w http.ResponseWriter, r *http.Request) {
+	values, err := parseFloatParams(r, "lat", "lng")
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	floor, err := parseFloorParam(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	nearest, err := beacon.FindNearestBeacon(s.DB, values[0], values[1], floor)
+	if err == models.ErrInvalidCoordinates {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, nearest)
+}
+
+// parseFloatParams reads the named query parameters, all of which are required
+func parseFloatParams(r *http.Request, names ...string) ([]float64, error) {
+	query := r.URL.Query()
+	values := make([]float64, len(names))
+	for i, name := range names {
+		value := query.Get(name)
+		if value == "" {
+			return nil, fmt.Errorf("%s is required", name)
+		}
+
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		values[i] = parsed
+	}
+	return values, nil
+}
+
+// parseFloorParam reads the optional floor query parameter
+func parseFloorParam(r *http.Request) (*int, error) {
+	value := r.URL.Query().Get("floor")
+	if value == "" {
+		return nil, nil
+	}
+
+	floor, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid floor: %v", err)
+	}
+	return &floor, nil
+}
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type beaconTransitionRequest struct {
+	OrganisationID uint64 `json:"organisation_id"`
+	Reason         string `json:"reason"`
+}
+
+type beaconHistoryResponse struct {
+	Beacon    *models.Beacon                   `json:"beacon"`
+	History   *[]models.BeaconStatusTransition `json:"history"`
+	SecretKey string                           `json:"secret_key,omitempty"`
+}
+
+type beaconSecretKeyResponse struct {
+	BeaconID  uint64 `json:"beacon_id"`
+	SecretKey string `json:"secret_key"`
+}
+
+type beaconEIDRequest struct {
+	IdentityKey      string `json:"identity_key"`
+	RotationExponent *uint8 `json:"rotation_exponent"`
+}
+
+type beaconEIDResponse struct {
+	BeaconID         uint64 `json:"beacon_id"`
+	IdentityKey      string `json:"identity_key"`
+	RotationExponent uint8  `json:"rotation_exponent"`
+}
+
+func (s *Server) RegisterBeacon(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, transitionRequest, ok := s.prepareBeaconTransition(w, r)
+	if !ok {
+		return
+	}
+
+	organisation := models.Organisation{}
+	_, err := organisation.FindOrganisationByID(s.DB, transitionRequest.OrganisationID)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// the organisation's administrator registers the beacon outright, staff can
+	// only leave it pending their approval
+	if organisation.AdministratorID != uint64(actorID) && !s.isStaff(actorID) {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	// the check-in key provisioned on registration is only ever shown in this response
+	err = beacon.RegisterBeacon(s.DB, organisation, actorID, transitionRequest.Reason)
+	s.respondBeaconTransition(w, beacon, err, registeredSecretKey(beacon, err))
+}
+
+// registeredSecretKey is the check-in key a registration provisioned, if any
+func registeredSecretKey(beacon *models.Beacon, err error) string {
+	if err != nil || beacon.Status != models.BeaconStatusRegistered {
+		return ""
+	}
+	return beacon.SecretKey
+}
+
+func (s *Server) DeregisterBeacon(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, transitionRequest, ok := s.prepareBeaconTransition(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	err := beacon.DeregisterBeacon(s.DB, actorID, transitionRequest.Reason)
+	s.respondBeaconTransition(w, beacon, err, "")
+}
+
+func (s *Server) SuspendBeacon(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, transitionRequest, ok := s.prepareBeaconTransition(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	err := beacon.SuspendBeacon(s.DB, actorID, transitionRequest.Reason)
+	s.respondBeaconTransition(w, beacon, err, "")
+}
+
+func (s *Server) DecommissionBeacon(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, transitionRequest, ok := s.prepareBeaconTransition(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	err := beacon.DecommissionBeacon(s.DB, actorID, transitionRequest.Reason)
+	s.respondBeaconTransition(w, beacon, err, "")
+}
+
+func (s *Server) GetBeaconHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	_, err = beacon.FindBeaconByID(s.DB, bid)
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.respondBeaconTransition(w, &beacon, nil, "")
+}
+
+// RotateBeaconSecretKey replaces a registered beacon's check-in signing key
+func (s *Server) RotateBeaconSecretKey(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, _, ok := s.prepareBeaconTransition(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	if beacon.Status != models.BeaconStatusRegistered {
+		responses.ERROR(w, http.StatusConflict, errors.New("only registered beacons have a check-in key"))
+		return
+	}
+
+	err := beacon.RotateSecretKey(s.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beaconSecretKeyResponse{BeaconID: beacon.ID, SecretKey: beacon.SecretKey})
+}
+
+// ProvisionBeaconEID registers the identity key a beacon derives its rotating
+// ephemeral ids from, generating one when none is supplied
+func (s *Server) ProvisionBeaconEID(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	eidRequest := beaconEIDRequest{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &eidRequest)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	rotationExponent := uint8(models.DefaultEIDRotationExponent)
+	if eidRequest.RotationExponent != nil {
+		rotationExponent = *eidRequest.RotationExponent
+	}
+
+	err = beacon.ProvisionEID(s.DB, eidRequest.IdentityKey, rotationExponent, eidSchedule())
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beaconEIDResponse{
+		BeaconID:         beacon.ID,
+		IdentityKey:      beacon.EIDIdentityKey,
+		RotationExponent: beacon.EIDRotationExponent,
+	})
+}
+
+// prepareBeacon resolves the beacon in the path and the acting user, writing the
+// error response itself on failure
+func (s *Server) prepareBeacon(w http.ResponseWriter, r *http.Request) (*models.Beacon, uint32, bool) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, 0, false
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, 0, false
+	}
+
+	beacon := models.Beacon{}
+	_, err = beacon.FindBeaconByID(s.DB, bid)
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return nil, 0, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, 0, false
+	}
+	return &beacon, actorID, true
+}
+
+// prepareBeaconTransition resolves the beacon, the acting user and the request body
+// shared by every lifecycle endpoint, writing the error response itself on failure
+func (s *Server) prepareBeaconTransition(w http.ResponseWriter, r *http.Request) (*models.Beacon, uint32, beaconTransitionRequest, bool) {
+	transitionRequest := beaconTransitionRequest{}
+
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok {
+		return nil, 0, transitionRequest, false
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return nil, 0, transitionRequest, false
+	}
+
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &transitionRequest)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return nil, 0, transitionRequest, false
+		}
+	}
+
+	return beacon, actorID, transitionRequest, true
+}
+
+// authorizeBeaconAdministrator only lets the administrator of the beacon's
+// organisation manage it, or staff when no organisation owns it
+func (s *Server) authorizeBeaconAdministrator(w http.ResponseWriter, beacon *models.Beacon, actorID uint32) bool {
+	if beacon.OrganisationID == 0 {
+		return s.authorizeStaff(w, actorID)
+	}
+	return s.authorizeOrganisationAdministrator(w, beacon.OrganisationID, actorID)
+}
+
+// beaconHistoryOrganisation is the organisation a beacon's history is narrowed to
+// for the actor: staff read all of it, anybody else only what was recorded while
+// the beacon belonged to its current organisation
+func (s *Server) beaconHistoryOrganisation(beacon *models.Beacon, actorID uint32) uint64 {
+	if s.isStaff(actorID) {
+		return 0
+	}
+	return beacon.OrganisationID
+}
+
+// isStaff reports whether the actor is one of the operators
+func (s *Server) isStaff(actorID uint32) bool {
+	user := models.User{}
+	_, err := user.FindUserByID(s.DB, actorID)
+	return err == nil && user.IsStaff
+}
+
+// authorizeStaff only lets operators through
+func (s *Server) authorizeStaff(w http.ResponseWriter, actorID uint32) bool {
+	if !s.isStaff(actorID) {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return false
+	}
+	return true
+}
+
+// isOrganisationAdministrator reports whether the actor administers the organisation
+func (s *Server) isOrganisationAdministrator(organisationID uint64, actorID uint32) bool {
+	organisation := models.Organisation{}
+	_, err := organisation.FindOrganisationByID(s.DB, organisationID)
+	return err == nil && organisation.AdministratorID == uint64(actorID)
+}
+
+// authorizeOrganisationAdministrator only lets the organisation's administrator through
+func (s *Server) authorizeOrganisationAdministrator(w http.ResponseWriter, organisationID uint64, actorID uint32) bool {
+	organisation := models.Organisation{}
+	_, err := organisation.FindOrganisationByID(s.DB, organisationID)
+	if err == models.ErrOrganisationNotFound {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if organisation.AdministratorID != uint64(actorID) {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return false
+	}
+	return true
+}
+
+func (s *Server) respondBeaconTransition(w http.ResponseWriter, beacon *models.Beacon, err error, secretKey string) {
+	if errors.Is(err, models.ErrInvalidBeaconTransition) {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	history, err := beacon.FindBeaconHistory(s.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, beaconHistoryResponse{
+		Beacon:    beacon,
+		History:   history,
+		SecretKey: secretKey,
+	})
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const defaultTelemetryRange = 7 * 24 * time.Hour
+
+// telemetryRequest accepts either explicit sample fields or the hex payload of an
+// Eddystone TLM advertisement
+type telemetryRequest struct {
+	models.BeaconTelemetry
+	Payload string `json:"payload"`
+}
+
+// CreateBeaconTelemetry records a telemetry sample sent with a key of a gateway in
+// the beacon's organisation, or by the beacon's administrator
+func (s *Server) CreateBeaconTelemetry(w http.ResponseWriter, r *http.Request) {
+	beacon, ok := s.prepareReportedBeacon(w, r)
+	if !ok {
+		return
+	}
+	bid := beacon.ID
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	sampleRequest := telemetryRequest{}
+	err = json.Unmarshal(body, &sampleRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	recordedAt := sampleRequest.RecordedAt
+	if recordedAt.IsZero() {
+		recordedAt = time.Now()
+	}
+
+	sample := sampleRequest.BeaconTelemetry
+	if sampleRequest.Payload != "" {
+		adv, err := advertisement.ParseHex(sampleRequest.Payload)
+		if err == nil && adv.EddystoneTLM == nil {
+			err = errors.New("advertisement contains no telemetry frame")
+		}
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		sample = models.NewTelemetryFromTLM(bid, adv.EddystoneTLM, recordedAt)
+	}
+	sample.ID = 0
+	sample.BeaconID = bid
+	sample.RecordedAt = recordedAt
+
+	sampleCreated, err := sample.SaveTelemetry(s.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = beacon.MarkSeen(s.DB, recordedAt)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, sampleCreated)
+}
+
+// GetBeaconTelemetry returns the samples between from and to (RFC 3339, defaulting
+// to the last week), or per hour or day summaries when bucket is given. Only the
+// beacon's administrator reads it, and only what was recorded while it was theirs.
+func (s *Server) GetBeaconTelemetry(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+	organisationID := s.beaconHistoryOrganisation(beacon, actorID)
+
+	from, to, err := parseTimeRange(r, defaultTelemetryRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	telemetry := models.BeaconTelemetry{}
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		samples, err := telemetry.FindBeaconTelemetry(s.DB, beacon.ID, organisationID, from, to)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		responses.JSON(w, http.StatusOK, samples)
+		return
+	}
+
+	if bucket != models.TelemetryBucketHour && bucket != models.TelemetryBucketDay {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("bucket must be hour or day"))
+		return
+	}
+
+	buckets, err := telemetry.AggregateBeaconTelemetry(s.DB, beacon.ID, organisationID, from, to, bucket)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, buckets)
+}
+
+// parseTimeRange reads the from and to query parameters as RFC 3339 timestamps.
+// to defaults to now and from defaults to defaultRange before to.
+func parseTimeRange(r *http.Request, defaultRange time.Duration) (time.Time, time.Time, error) {
+	var err error
+	query := r.URL.Query()
+
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		to, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	from := to.Add(-defaultRange)
+	if value := query.Get("from"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+type beaconTransferRequest struct {
+	ToOrganisationID uint64 `json:"to_organisation_id"`
+	Reason           string `json:"reason"`
+}
+
+type acceptedTransferResponse struct {
+	Transfer  *models.BeaconTransfer `json:"transfer"`
+	Beacon    *models.Beacon         `json:"beacon"`
+	SecretKey string                 `json:"secret_key,omitempty"`
+}
+
+// beaconTransferTTL reads how long a transfer waits to be accepted from
+// BEACON_TRANSFER_TTL, e.g. "72h"
+func beaconTransferTTL() time.Duration {
+	value := os.Getenv("BEACON_TRANSFER_TTL")
+	if value == "" {
+		return models.DefaultBeaconTransferTTL
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("invalid BEACON_TRANSFER_TTL %q, using %s", value, models.DefaultBeaconTransferTTL)
+		return models.DefaultBeaconTransferTTL
+	}
+	return ttl
+}
+
+// RequestBeaconTransfer offers a beacon to another organisation. Only the
+// administrator of the organisation holding the beacon can offer it.
+func (s *Server) RequestBeaconTransfer(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok {
+		return
+	}
+	if beacon.OrganisationID == 0 {
+		responses.ERROR(w, http.StatusConflict, errors.New("only beacons belonging to an organisation can be transferred"))
+		return
+	}
+	if !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	transferRequest := beaconTransferRequest{}
+	err = json.Unmarshal(body, &transferRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	transfer, err := beacon.RequestBeaconTransfer(s.DB, transferRequest.ToOrganisationID, actorID, transferRequest.Reason, beaconTransferTTL())
+	if err == models.ErrBeaconTransferInProgress || errors.Is(err, models.ErrInvalidBeaconTransition) {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/transfers/%d", r.Host, transfer.ID))
+	responses.JSON(w, http.StatusCreated, transfer)
+}
+
+// GetBeaconTransfer shows a transfer to the administrator of either organisation
+func (s *Server) GetBeaconTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, actorID, ok := s.prepareBeaconTransfer(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.isOrganisationAdministrator(transfer.FromOrganisationID, actorID) &&
+		!s.authorizeOrganisationAdministrator(w, transfer.ToOrganisationID, actorID) {
+		return
+	}
+	responses.JSON(w, http.StatusOK, transfer)
+}
+
+// AcceptBeaconTransfer moves the beacon into the receiving organisation. The
+// beacon's new check-in key is only ever shown in this response.
+func (s *Server) AcceptBeaconTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, actorID, ok := s.prepareBeaconTransfer(w, r)
+	if !ok || !s.authorizeOrganisationAdministrator(w, transfer.ToOrganisationID, actorID) {
+		return
+	}
+
+	beacon, err := transfer.AcceptBeaconTransfer(s.DB, actorID)
+	if errors.Is(err, models.ErrBeaconTransferNotPending) {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, acceptedTransferResponse{
+		Transfer:  transfer,
+		Beacon:    beacon,
+		SecretKey: beacon.SecretKey,
+	})
+}
+
+// RejectBeaconTransfer declines a transfer on behalf of the receiving organisation
+func (s *Server) RejectBeaconTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, actorID, ok := s.prepareBeaconTransfer(w, r)
+	if !ok || !s.authorizeOrganisationAdministrator(w, transfer.ToOrganisationID, actorID) {
+		return
+	}
+
+	err := transfer.RejectBeaconTransfer(s.DB, actorID)
+	s.respondBeaconTransfer(w, transfer, err)
+}
+
+// CancelBeaconTransfer withdraws a transfer on behalf of the sending organisation
+func (s *Server) CancelBeaconTransfer(w http.ResponseWriter, r *http.Request) {
+	transfer, actorID, ok := s.prepareBeaconTransfer(w, r)
+	if !ok || !s.authorizeOrganisationAdministrator(w, transfer.FromOrganisationID, actorID) {
+		return
+	}
+
+	err := transfer.CancelBeaconTransfer(s.DB, actorID)
+	s.respondBeaconTransfer(w, transfer, err)
+}
+
+// GetOrganisationBeaconTransfers lists the transfers an organisation is sending or
+// receiving, optionally filtered with status=pending
+func (s *Server) GetOrganisationBeaconTransfers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	oid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !s.authorizeOrganisationAdministrator(w, oid, actorID) {
+		return
+	}
+
+	transfer := models.BeaconTransfer{}
+	transfers, err := transfer.FindOrganisationBeaconTransfers(s.DB, oid, r.URL.Query().Get("status"))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, transfers)
+}
+
+func (s *Server) respondBeaconTransfer(w http.ResponseWriter, transfer *models.BeaconTransfer, err error) {
+	if err == models.ErrBeaconTransferNotPending {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, transfer)
+}
+
+// prepareBeaconTransfer resolves the transfer in the path and the acting user,
+// writing the error response itself on failure
+func (s *Server) prepareBeaconTransfer(w http.ResponseWriter, r *http.Request) (*models.BeaconTransfer, uint32, bool) {
+	vars := mux.Vars(r)
+	tid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, 0, false
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, 0, false
+	}
+
+	transfer := models.BeaconTransfer{}
+	_, err = transfer.FindBeaconTransferByID(s.DB, tid)
+	if err == models.ErrBeaconTransferNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return nil, 0, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, 0, false
+	}
+	return &transfer, actorID, true
+}
@@ -0,0 +1,477 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/beaconimport"
+	"github.com/SherbazHashmi/goblog/api/formaterror"
+	"github.com/SherbazHashmi/goblog/api/labels"
+	"github.com/SherbazHashmi/goblog/api/macaddress"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *Server) CreateBeacon(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	err = json.Unmarshal(body, &beacon)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = beacon.Prepare()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// as with imports, beacons are only created in organisations the actor
+	// administers, and only staff create beacons that no organisation owns
+	organisationID := beacon.OrganisationID
+	if organisationID == 0 {
+		if !s.authorizeStaff(w, uid) {
+			return
+		}
+	} else if !s.authorizeOrganisationAdministrator(w, organisationID, uid) {
+		return
+	}
+
+	// Beacons start out unregistered, one created for an organisation is
+	// registered to it through the lifecycle
+	beacon.ID = 0
+	beacon.IsRegistered = false
+	beacon.Status = models.BeaconStatusUnclaimed
+	beacon.OrganisationID = 0
+
+	tx := s.DB.Begin()
+	beaconCreated, err := beacon.SaveBeacon(tx)
+	if err == nil && organisationID != 0 {
+		err = beaconCreated.RegisterImportedBeacon(tx, organisationID, uid, "created")
+	}
+	if err == models.ErrBeaconIdentityTaken {
+		tx.Rollback()
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, beaconCreated.ID))
+	responses.JSON(w, http.StatusCreated, beaconCreated)
+}
+
+// ImportBeacons creates beacons in bulk from a CSV or JSON upload. CSV is
+// selected with format=csv or a text/csv content type, otherwise JSON is expected.
+func (s *Server) ImportBeacons(w http.ResponseWriter, r *http.Request) {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var rows []beaconimport.Row
+	format := r.URL.Query().Get("format")
+	if format == "csv" || (format == "" && strings.Contains(r.Header.Get("Content-Type"), "csv")) {
+		rows, err = beaconimport.ParseCSV(r.Body)
+	} else {
+		rows, err = beaconimport.ParseJSON(r.Body)
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// beacons are only imported into organisations the actor administers, and
+	// only staff import beacons that no organisation owns
+	options := beaconimport.Options{
+		DryRun:  dryRun,
+		ActorID: uid,
+		Authorize: func(organisationID uint64) bool {
+			if organisationID == 0 {
+				return s.isStaff(uid)
+			}
+			return s.isOrganisationAdministrator(organisationID, uid)
+		},
+	}
+
+	report, err := beaconimport.Import(s.DB, rows, options)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, report)
+}
+
+// GetBeacons lists beacons, narrowed by an optional label selector such as
+// selector=floor in (1,2),type!=storage
+func (s *Server) GetBeacons(w http.ResponseWriter, r *http.Request) {
+	selector, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	beacons, err := beacon.FindAllBeacons(s.DB, selector)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beacons)
+}
+
+func (s *Server) GetBeacon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	beaconReceived, err := beacon.FindBeaconByID(s.DB, bid)
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beaconReceived)
+}
+
+func (s *Server) GetBeaconByMacAddress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	beacon := models.Beacon{}
+	beaconReceived, err := beacon.FindBeaconByMacAddress(s.DB, vars["mac_address"])
+	if errors.Is(err, macaddress.ErrInvalidMacAddress) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beaconReceived)
+}
+
+func (s *Server) GetOrganisationBeacons(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	oid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation := models.Organisation{}
+	_, err = organisation.FindOrganisationByID(s.DB, oid)
+	if err == models.ErrOrganisationNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	beacons, err := beacon.FindOrganisationBeacons(s.DB, oid, selector)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beacons)
+}
+
+func (s *Server) GetOfflineBeacons(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	oid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation := models.Organisation{}
+	_, err = organisation.FindOrganisationByID(s.DB, oid)
+	if err == models.ErrOrganisationNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	beacon := models.Beacon{}
+	offline, err := beacon.FindOfflineBeacons(s.DB, oid, time.Now())
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, offline)
+}
+
+// BeaconHeartbeat lets a gateway report that it has heard a beacon. It is sent
+// with a key of a gateway in the beacon's organisation, or by the beacon's administrator.
+func (s *Server) BeaconHeartbeat(w http.ResponseWriter, r *http.Request) {
+	beacon, ok := s.prepareReportedBeacon(w, r)
+	if !ok {
+		return
+	}
+
+	err := beacon.MarkSeen(s.DB, time.Now())
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beacon)
+}
+
+// prepareReportedBeacon resolves the beacon in the path for a report about it
+// from a gateway of the beacon's organisation, authenticated by its key, or from
+// the beacon's administrator, writing the error response itself on failure
+func (s *Server) prepareReportedBeacon(w http.ResponseWriter, r *http.Request) (*models.Beacon, bool) {
+	key := r.Header.Get(gatewayKeyHeader)
+	if key == "" {
+		beacon, actorID, ok := s.prepareBeacon(w, r)
+		if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+			return nil, false
+		}
+		return beacon, true
+	}
+
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	gateway, err := models.FindGatewayByKey(s.DB, key)
+	if err == models.ErrInvalidGatewayKey {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	// another organisation's beacons are reported as unknown so a gateway cannot
+	// probe for them
+	beacon := models.Beacon{}
+	_, err = beacon.FindBeaconByID(s.DB, bid)
+	if err == models.ErrBeaconNotFound || (err == nil && beacon.OrganisationID != gateway.OrganisationID) {
+		responses.ERROR(w, http.StatusNotFound, models.ErrBeaconNotFound)
+		return nil, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return &beacon, true
+}
+
+func (s *Server) UpdateBeacon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	// Check if the beacon exists
+	beacon := models.Beacon{}
+	_, err = beacon.FindBeaconByID(s.DB, bid)
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !s.authorizeBeaconAdministrator(w, &beacon, uid) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	beaconUpdate := models.Beacon{}
+	err = json.Unmarshal(body, &beaconUpdate)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = beaconUpdate.Prepare()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	// Ownership and registration state are only changed through the registration flow
+	beaconUpdate.ID = beacon.ID
+	beaconUpdate.OrganisationID = beacon.OrganisationID
+	beaconUpdate.IsRegistered = beacon.IsRegistered
+	beaconUpdate.RegisteredOn = beacon.RegisteredOn
+	beaconUpdate.Status = beacon.Status
+	beaconUpdate.Labels = beacon.Labels
+
+	err = beaconUpdate.UpdateBeacon(s.DB, bid)
+	if err == models.ErrBeaconIdentityTaken {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beaconUpdate)
+}
+
+type beaconLabelsRequest struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// SetBeaconLabels replaces every label on a beacon
+func (s *Server) SetBeaconLabels(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	labelsRequest := beaconLabelsRequest{}
+	err = json.Unmarshal(body, &labelsRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if labelsRequest.Labels == nil {
+		labelsRequest.Labels = map[string]string{}
+	}
+
+	err = beacon.SetBeaconLabels(s.DB, labelsRequest.Labels)
+	if errors.Is(err, labels.ErrInvalidLabel) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beacon)
+}
+
+func (s *Server) DeleteBeacon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	bid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	beacon := models.Beacon{}
+	_, err = beacon.FindBeaconByID(s.DB, bid)
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !s.authorizeBeaconAdministrator(w, &beacon, uid) {
+		return
+	}
+
+	_, err = beacon.DeleteBeacon(s.DB, bid)
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err == models.ErrBeaconHasHistory {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Entity", fmt.Sprintf("%d", bid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultCheckInClockSkew = 2 * time.Minute
+
+// defaultCheckInHistoryRange is how far back check-in history goes when no range is given
+const defaultCheckInHistoryRange = 30 * 24 * time.Hour
+
+type checkInResponse struct {
+	ID          uint64    `json:"id"`
+	BeaconID    uint64    `json:"beacon_id"`
+	PucID       uint64    `json:"puc_id"`
+	CheckedInAt time.Time `json:"checked_in_at"`
+	Duplicate   bool      `json:"duplicate"`
+}
+
+type checkInPageResponse struct {
+	CheckIns []models.CheckIn `json:"check_ins"`
+	Next     string           `json:"next,omitempty"`
+}
+
+// checkInClockSkew reads how far a check-in timestamp may drift from the server
+// clock from CHECKIN_CLOCK_SKEW, e.g. "30s" or "2m"
+func checkInClockSkew() time.Duration {
+	value := os.Getenv("CHECKIN_CLOCK_SKEW")
+	if value == "" {
+		return defaultCheckInClockSkew
+	}
+
+	skew, err := time.ParseDuration(value)
+	if err != nil || skew <= 0 {
+		log.Printf("invalid CHECKIN_CLOCK_SKEW %q, using %s", value, defaultCheckInClockSkew)
+		return defaultCheckInClockSkew
+	}
+	return skew
+}
+
+// checkInDedupeWindow reads how close together check-ins of a PUC to the same
+// beacon count as one from CHECKIN_DEDUPE_WINDOW, e.g. "1m". "0" turns it off.
+func checkInDedupeWindow() time.Duration {
+	value := os.Getenv("CHECKIN_DEDUPE_WINDOW")
+	if value == "" {
+		return models.DefaultCheckInDedupeWindow
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window < 0 {
+		log.Printf("invalid CHECKIN_DEDUPE_WINDOW %q, using %s", value, models.DefaultCheckInDedupeWindow)
+		return models.DefaultCheckInDedupeWindow
+	}
+	return window
+}
+
+// CreateCheckIn records a PUC checking in to a beacon. The check-in is
+// authenticated by its signature rather than a user token. A retry carrying the
+// same idempotency key, in the body or the Idempotency-Key header, or a repeat
+// within the dedupe window is acknowledged with 200 and duplicate set instead of
+// being recorded again.
+func (s *Server) CreateCheckIn(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	checkIn := models.SignedCheckIn{}
+	err = json.Unmarshal(body, &checkIn)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if checkIn.IdempotencyKey == "" {
+		checkIn.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	}
+	if len(checkIn.IdempotencyKey) > models.MaxIdempotencyKeyLength {
+		responses.ERROR(w, http.StatusUnprocessableEntity, fmt.Errorf("idempotency key must be at most %d characters", models.MaxIdempotencyKeyLength))
+		return
+	}
+
+	beacon := models.Beacon{}
+	if checkIn.EphemeralID != "" {
+		_, err = beacon.ResolveEphemeralID(s.DB, checkIn.EphemeralID, time.Unix(checkIn.Timestamp, 0), eidResolveWindow())
+		if err == nil && checkIn.BeaconID != 0 && checkIn.BeaconID != beacon.ID {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("ephemeral id does not belong to the beacon"))
+			return
+		}
+		checkIn.BeaconID = beacon.ID
+	} else {
+		_, err = beacon.FindBeaconByID(s.DB, checkIn.BeaconID)
+	}
+	if err == advertisement.ErrInvalidEphemeralID {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == models.ErrBeaconNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = beacon.VerifyCheckIn(s.DB, checkIn, time.Now(), checkInClockSkew())
+	switch err {
+	case nil:
+	case models.ErrCheckInBadSignature:
+		responses.ERROR(w, http.StatusUnauthorized, err)
+		return
+	case models.ErrCheckInReplayed:
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	case models.ErrCheckInUnsigned, models.ErrCheckInClockSkew, models.ErrCheckInNotProvisioned, models.ErrCheckInNotRegistered:
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	default:
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the signed timestamp is within the allowed skew, so it is when the PUC checked in
+	dedupe := models.CheckInDedupe{IdempotencyKey: checkIn.IdempotencyKey, Window: checkInDedupeWindow()}
+	recorded, duplicate, err := beacon.CheckInPUC(s.DB, checkIn.PucID, time.Unix(checkIn.Timestamp, 0), checkIn.RSSI, dedupe)
+	if errors.Is(err, models.ErrPucNotFound) {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if !duplicate {
+		s.recomputeCheckInVisits(recorded)
+	}
+	respondCheckIn(w, recorded, duplicate)
+}
+
+// respondCheckIn acknowledges a check-in, with 201 when it was recorded and 200
+// when it repeated one already recorded
+func respondCheckIn(w http.ResponseWriter, checkIn *models.CheckIn, duplicate bool) {
+	status := http.StatusCreated
+	if duplicate {
+		status = http.StatusOK
+	}
+	responses.JSON(w, status, checkInResponse{
+		ID:          checkIn.ID,
+		BeaconID:    checkIn.BeaconID,
+		PucID:       checkIn.PucID,
+		CheckedInAt: checkIn.CheckedInAt,
+		Duplicate:   duplicate,
+	})
+}
+
+// GetPucCheckIns pages through the beacons a PUC checked in to, newest first.
+// Only staff see every check-in, see authorizePucReader.
+func (s *Server) GetPucCheckIns(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok {
+		return
+	}
+	access, ok := s.authorizePucReader(w, puc, actorID)
+	if !ok {
+		return
+	}
+
+	page, ok := parseCheckInPage(w, r)
+	if !ok {
+		return
+	}
+	page.Access = access
+
+	checkIns, err := models.FindPucCheckIns(s.DB, puc.ID, page)
+	respondCheckInPage(w, r, checkIns, page, err)
+}
+
+// GetBeaconCheckIns pages through the PUCs that checked in to a beacon, newest first
+func (s *Server) GetBeaconCheckIns(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	page, ok := parseCheckInPage(w, r)
+	if !ok {
+		return
+	}
+	page.OrganisationID = s.beaconHistoryOrganisation(beacon, actorID)
+
+	checkIns, err := models.FindBeaconCheckIns(s.DB, beacon.ID, page)
+	respondCheckInPage(w, r, checkIns, page, err)
+}
+
+// parseCheckInPage reads the from and to range (defaulting to the last 30 days),
+// the before_id cursor and the page limit (at most 500), writing the error response itself on failure
+func parseCheckInPage(w http.ResponseWriter, r *http.Request) (models.CheckInPage, bool) {
+	from, to, err := parseTimeRange(r, defaultCheckInHistoryRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return models.CheckInPage{}, false
+	}
+	page := models.CheckInPage{From: from, To: to, Limit: models.DefaultCheckInPageSize}
+
+	query := r.URL.Query()
+	if value := query.Get("before_id"); value != "" {
+		page.BeforeID, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return models.CheckInPage{}, false
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		page.Limit, err = strconv.Atoi(value)
+		if err != nil || page.Limit <= 0 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+			return models.CheckInPage{}, false
+		}
+		if page.Limit > models.MaxCheckInPageSize {
+			page.Limit = models.MaxCheckInPageSize
+		}
+	}
+	return page, true
+}
+
+// respondCheckInPage writes a page of check-ins, with the query for the next page
+// when this one is full
+func respondCheckInPage(w http.ResponseWriter, r *http.Request, checkIns *[]models.CheckIn, page models.CheckInPage, err error) {
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := checkInPageResponse{CheckIns: *checkIns}
+	if n := len(*checkIns); n > 0 && n == page.Limit {
+		last := (*checkIns)[n-1]
+		next := url.Values{}
+		next.Set("from", page.From.Format(time.RFC3339))
+		next.Set("to", last.CheckedInAt.Format(time.RFC3339Nano))
+		next.Set("before_id", strconv.FormatUint(last.ID, 10))
+		next.Set("limit", strconv.Itoa(page.Limit))
+		response.Next = r.URL.Path + "?" + next.Encode()
+	}
+	responses.JSON(w, http.StatusOK, response)
+}
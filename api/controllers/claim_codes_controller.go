@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/ratelimit"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// claimCodeLimiter bounds how many codes a user can try, so the code space
+// cannot be searched through the redeem or QR endpoints
+var claimCodeLimiter = ratelimit.New(10, time.Minute)
+
+type redeemClaimCodeRequest struct {
+	Code           string `json:"code"`
+	OrganisationID uint64 `json:"organisation_id"`
+	Reason         string `json:"reason"`
+}
+
+// claimCodeTTL reads how long a claim code stays redeemable from CLAIM_CODE_TTL, e.g. "720h"
+func claimCodeTTL() time.Duration {
+	value := os.Getenv("CLAIM_CODE_TTL")
+	if value == "" {
+		return models.DefaultClaimCodeTTL
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("invalid CLAIM_CODE_TTL %q, using %s", value, models.DefaultClaimCodeTTL)
+		return models.DefaultClaimCodeTTL
+	}
+	return ttl
+}
+
+// allowClaimCodeAttempt applies the claim code rate limit to the acting user,
+// writing the error response itself when the limit is reached
+func allowClaimCodeAttempt(w http.ResponseWriter, actorID uint32) bool {
+	allowed, retryAfter := claimCodeLimiter.Allow(fmt.Sprintf("user:%d", actorID), time.Now())
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		responses.ERROR(w, http.StatusTooManyRequests, errors.New("too many claim code attempts, try again later"))
+		return false
+	}
+	return true
+}
+
+// IssueBeaconClaimCode generates a one-time claim code for an unclaimed beacon.
+// Only staff issue codes, as a code lets whoever holds it register the beacon.
+// The code is only ever shown in this response, any earlier code stops working.
+func (s *Server) IssueBeaconClaimCode(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeStaff(w, actorID) {
+		return
+	}
+
+	claimCode, err := beacon.IssueClaimCode(s.DB, actorID, claimCodeTTL())
+	if errors.Is(err, models.ErrInvalidBeaconTransition) {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, claimCode)
+}
+
+// GetClaimCodeQR renders a redeemable claim code as a QR code PNG for printing
+func (s *Server) GetClaimCodeQR(w http.ResponseWriter, r *http.Request) {
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !allowClaimCodeAttempt(w, actorID) {
+		return
+	}
+
+	code := mux.Vars(r)["code"]
+	claimCode := models.BeaconClaimCode{}
+	_, err = claimCode.FindRedeemableClaimCode(s.DB, code, time.Now())
+	if err == models.ErrInvalidClaimCode {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	size := 256
+	if value := r.URL.Query().Get("size"); value != "" {
+		size, err = strconv.Atoi(value)
+		if err != nil || size < 64 || size > 1024 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("size must be between 64 and 1024 pixels"))
+			return
+		}
+	}
+
+	png, err := qrcode.Encode(models.FormatClaimCode(code), qrcode.Medium, size)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(png)
+	if err != nil {
+		log.Printf("unable to write claim code qr: %v", err)
+	}
+}
+
+// RedeemClaimCode registers the beacon behind a claim code to the organisation
+// administered by the acting user
+func (s *Server) RedeemClaimCode(w http.ResponseWriter, r *http.Request) {
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !allowClaimCodeAttempt(w, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	redeemRequest := redeemClaimCodeRequest{}
+	err = json.Unmarshal(body, &redeemRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if !s.authorizeOrganisationAdministrator(w, redeemRequest.OrganisationID, actorID) {
+		return
+	}
+	organisation := models.Organisation{}
+	_, err = organisation.FindOrganisationByID(s.DB, redeemRequest.OrganisationID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	beacon, err := models.RedeemClaimCode(s.DB, redeemRequest.Code, organisation, actorID, redeemRequest.Reason)
+	if err == models.ErrInvalidClaimCode {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	s.respondBeaconTransition(w, beacon, err, registeredSecretKey(beacon, err))
+}
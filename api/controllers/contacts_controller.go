@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/SherbazHashmi/goblog/api/visits"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultContactRange is how far back contacts are traced when no range is given,
+// the usual infectious period
+const defaultContactRange = 14 * 24 * time.Hour
+
+// GetOrganisationContacts lists the PUCs present at the same beacons as a PUC,
+// given by puc_id, or as any PUC a user held, given by user_id, between from and
+// to. scope=zone or organisation compares presence more broadly and min_overlap,
+// e.g. "15m", leaves out brief contacts.
+func (s *Server) GetOrganisationContacts(w http.ResponseWriter, r *http.Request) {
+	query, ok := s.prepareContactQuery(w, r)
+	if !ok {
+		return
+	}
+
+	contacts, err := models.FindContacts(s.DB, query)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, contacts)
+}
+
+// ExportOrganisationContacts returns the same contacts as GetOrganisationContacts
+// as a CSV file with a row per encounter, for sharing with health authorities
+func (s *Server) ExportOrganisationContacts(w http.ResponseWriter, r *http.Request) {
+	query, ok := s.prepareContactQuery(w, r)
+	if !ok {
+		return
+	}
+
+	contacts, err := models.FindContacts(s.DB, query)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("contacts-organisation-%d-%s.csv", query.OrganisationID, query.To.UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"contact_puc_id", "contact_user_id", "scope", "scope_id", "start", "end", "overlap_seconds"})
+	for _, contact := range *contacts {
+		userID := ""
+		if contact.UserID != nil {
+			userID = strconv.FormatUint(uint64(*contact.UserID), 10)
+		}
+		for _, encounter := range contact.Encounters {
+			writer.Write([]string{
+				strconv.FormatUint(contact.PucID, 10),
+				userID,
+				encounter.Scope,
+				strconv.FormatUint(encounter.ScopeID, 10),
+				encounter.Start.UTC().Format(time.RFC3339),
+				encounter.End.UTC().Format(time.RFC3339),
+				strconv.FormatInt(encounter.OverlapSeconds, 10),
+			})
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("unable to write contacts export: %v", err)
+	}
+}
+
+// prepareContactQuery reads the contact query for the organisation in the path,
+// only letting its administrator through, writing the error response itself on failure
+func (s *Server) prepareContactQuery(w http.ResponseWriter, r *http.Request) (models.ContactQuery, bool) {
+	oid, ok := s.prepareAdministeredOrganisation(w, r)
+	if !ok {
+		return models.ContactQuery{}, false
+	}
+
+	from, to, err := parseTimeRange(r, defaultContactRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return models.ContactQuery{}, false
+	}
+	query := models.ContactQuery{
+		OrganisationID: oid,
+		Scope:          visits.ScopeBeacon,
+		From:           from,
+		To:             to,
+		Timeout:        visitInactivityTimeout(),
+	}
+
+	values := r.URL.Query()
+	if value := values.Get("puc_id"); value != "" {
+		query.PucID, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return models.ContactQuery{}, false
+		}
+	}
+	if value := values.Get("user_id"); value != "" {
+		uid, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return models.ContactQuery{}, false
+		}
+		query.UserID = uint32(uid)
+	}
+	if (query.PucID == 0) == (query.UserID == 0) {
+		responses.ERROR(w, http.StatusBadRequest, models.ErrContactSubjectRequired)
+		return models.ContactQuery{}, false
+	}
+
+	if value := values.Get("scope"); value != "" {
+		if !visits.ValidScope(value) {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("scope must be beacon, zone or organisation"))
+			return models.ContactQuery{}, false
+		}
+		query.Scope = value
+	}
+	if value := values.Get("min_overlap"); value != "" {
+		query.MinOverlap, err = time.ParseDuration(value)
+		if err != nil || query.MinOverlap < 0 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("min_overlap must be a duration such as 15m"))
+			return models.ContactQuery{}, false
+		}
+	}
+	return query, true
+}
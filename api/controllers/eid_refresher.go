@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"log"
+	"os"
+	"time"
+)
+
+// eidRefreshInterval reads how often the stored ephemeral ids are topped up from
+// EID_REFRESH_INTERVAL, e.g. "30s" or "5m"
+func eidRefreshInterval() time.Duration {
+	value := os.Getenv("EID_REFRESH_INTERVAL")
+	if value == "" {
+		return models.DefaultEIDRefreshInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("invalid EID_REFRESH_INTERVAL %q, using %s", value, models.DefaultEIDRefreshInterval)
+		return models.DefaultEIDRefreshInterval
+	}
+	return interval
+}
+
+// eidSchedule keeps enough ephemeral ids to resolve across the configured window
+func eidSchedule() models.EIDSchedule {
+	return models.EIDSchedule{Window: eidResolveWindow(), Interval: eidRefreshInterval()}
+}
+
+// runEIDRefresher periodically computes the ephemeral ids beacons are about to
+// broadcast, so observed ids resolve without recomputing them
+func (s *Server) runEIDRefresher(schedule models.EIDSchedule) {
+	ticker := time.NewTicker(schedule.Interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		refreshed, err := models.RefreshEphemeralIDs(s.DB, now, schedule)
+		if err != nil {
+			log.Printf("[ERROR] unable to refresh ephemeral ids: %v", err)
+			continue
+		}
+		if refreshed > 0 {
+			log.Printf("refreshed the ephemeral ids of %d beacon(s)", refreshed)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+type createGatewayRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateGateway issues a key a gateway reports the organisation's sightings
+// with. The key is only ever shown in this response.
+func (s *Server) CreateGateway(w http.ResponseWriter, r *http.Request) {
+	oid, ok := s.prepareAdministeredOrganisation(w, r)
+	if !ok {
+		return
+	}
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	gatewayRequest := createGatewayRequest{}
+	if !readOptionalJSON(w, r, &gatewayRequest) {
+		return
+	}
+
+	gateway, err := models.CreateGateway(s.DB, oid, gatewayRequest.Name, actorID)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusCreated, gateway)
+}
+
+func (s *Server) GetOrganisationGateways(w http.ResponseWriter, r *http.Request) {
+	oid, ok := s.prepareAdministeredOrganisation(w, r)
+	if !ok {
+		return
+	}
+
+	gateways, err := models.FindOrganisationGateways(s.DB, oid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, gateways)
+}
+
+// RevokeGateway stops a gateway's key from being accepted
+func (s *Server) RevokeGateway(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	gateway := models.Gateway{}
+	_, err = gateway.FindGatewayByID(s.DB, gid)
+	if err == models.ErrGatewayNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !s.authorizeOrganisationAdministrator(w, gateway.OrganisationID, actorID) {
+		return
+	}
+
+	err = gateway.RevokeGateway(s.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, gateway)
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/ingest"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxSightingBatchBytes bounds the size of a sighting batch request body
+const maxSightingBatchBytes = 16 << 20
+
+// gatewayKeyHeader carries the key a gateway authenticates sighting batches with
+const gatewayKeyHeader = "X-Gateway-Key"
+
+// sightingMaxAge reads how old a sighting may be when it arrives from
+// SIGHTING_MAX_AGE, e.g. "24h"
+func sightingMaxAge() time.Duration {
+	value := os.Getenv("SIGHTING_MAX_AGE")
+	if value == "" {
+		return ingest.DefaultMaxAge
+	}
+
+	maxAge, err := time.ParseDuration(value)
+	if err != nil || maxAge <= 0 {
+		log.Printf("invalid SIGHTING_MAX_AGE %q, using %s", value, ingest.DefaultMaxAge)
+		return ingest.DefaultMaxAge
+	}
+	return maxAge
+}
+
+// IngestSightings accepts a batch of gateway sightings as a JSON array, or as
+// NDJSON when sent as application/x-ndjson, and acknowledges how many were
+// accepted, duplicates or rejected. Batches are authenticated with a gateway
+// key, whose gateway every sighting is recorded against, and only sightings of
+// the key's organisation's beacons are accepted.
+func (s *Server) IngestSightings(w http.ResponseWriter, r *http.Request) {
+	gateway, err := models.FindGatewayByKey(s.DB, r.Header.Get(gatewayKeyHeader))
+	if err == models.ErrInvalidGatewayKey {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxSightingBatchBytes)
+	var batch *ingest.Batch
+	contentType := r.Header.Get("Content-Type")
+	if strings.Contains(contentType, "ndjson") || strings.Contains(contentType, "jsonl") {
+		batch, err = ingest.ParseNDJSON(body)
+	} else {
+		batch, err = ingest.ParseJSON(body)
+	}
+	if err == ingest.ErrBatchTooLarge {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	ack, err := ingest.Ingest(s.DB, batch, time.Now(), ingest.Options{
+		MaxAge:         sightingMaxAge(),
+		ClockSkew:      checkInClockSkew(),
+		EIDWindow:      eidResolveWindow(),
+		OrganisationID: gateway.OrganisationID,
+		GatewayID:      gateway.ID,
+	})
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, ack)
+}
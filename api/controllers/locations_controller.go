@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type organisationLocationsResponse struct {
+	OrganisationID uint64                `json:"organisation_id"`
+	Stats          *models.LocationStats `json:"stats"`
+	Locations      []*models.Location    `json:"locations"`
+}
+
+type beaconZoneRequest struct {
+	ZoneID *uint64 `json:"zone_id"`
+}
+
+func (s *Server) CreateLocation(w http.ResponseWriter, r *http.Request) {
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	location := models.Location{}
+	err = json.Unmarshal(body, &location)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	location.Prepare()
+	location.ID = 0
+
+	if !s.authorizeOrganisationAdministrator(w, location.OrganisationID, actorID) {
+		return
+	}
+
+	locationCreated, err := location.SaveLocation(s.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, locationCreated.ID))
+	responses.JSON(w, http.StatusCreated, locationCreated)
+}
+
+// GetLocation returns a location with everything below it and their rolled up stats
+func (s *Server) GetLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	lid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	location := models.Location{}
+	subtree, err := location.FindLocationSubtree(s.DB, lid)
+	if err == models.ErrLocationNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, subtree)
+}
+
+// UpdateLocation renames a location or moves it under another parent of the same kind
+func (s *Server) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	location, actorID, ok := s.prepareLocation(w, r)
+	if !ok || !s.authorizeOrganisationAdministrator(w, location.OrganisationID, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	locationUpdate := models.Location{}
+	err = json.Unmarshal(body, &locationUpdate)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	locationUpdate.Prepare()
+
+	// a location keeps its kind and organisation for life
+	locationUpdate.ID = location.ID
+	locationUpdate.Kind = location.Kind
+	locationUpdate.OrganisationID = location.OrganisationID
+
+	err = locationUpdate.UpdateLocation(s.DB, location.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, locationUpdate)
+}
+
+func (s *Server) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	location, actorID, ok := s.prepareLocation(w, r)
+	if !ok || !s.authorizeOrganisationAdministrator(w, location.OrganisationID, actorID) {
+		return
+	}
+
+	err := location.DeleteLocation(s.DB, location.ID)
+	if err == models.ErrLocationNotEmpty {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Entity", fmt.Sprintf("%d", location.ID))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// GetOrganisationLocations returns the organisation's whole site hierarchy with
+// beacon counts and online ratios rolled up at every level
+func (s *Server) GetOrganisationLocations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	oid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	organisation := models.Organisation{}
+	_, err = organisation.FindOrganisationByID(s.DB, oid)
+	if err == models.ErrOrganisationNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	location := models.Location{}
+	tree, err := location.FindOrganisationLocationTree(s.DB, oid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	stats, err := models.FindOrganisationBeaconStats(s.DB, oid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, organisationLocationsResponse{
+		OrganisationID: oid,
+		Stats:          stats,
+		Locations:      tree,
+	})
+}
+
+// AssignBeaconZone places a beacon in one of its organisation's zones, a null
+// zone_id removes it from its zone
+func (s *Server) AssignBeaconZone(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	zoneRequest := beaconZoneRequest{}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = json.Unmarshal(body, &zoneRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	err = beacon.AssignBeaconToZone(s.DB, zoneRequest.ZoneID)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, beacon)
+}
+
+// prepareLocation resolves the location in the path and the acting user, writing
+// the error response itself on failure
+func (s *Server) prepareLocation(w http.ResponseWriter, r *http.Request) (*models.Location, uint32, bool) {
+	vars := mux.Vars(r)
+	lid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, 0, false
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, 0, false
+	}
+
+	location := models.Location{}
+	_, err = location.FindLocationByID(s.DB, lid)
+	if err == models.ErrLocationNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return nil, 0, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, 0, false
+	}
+	return &location, actorID, true
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultOccupancySnapshotInterval = 5 * time.Minute
+
+// defaultOccupancyHistoryRange is how far back occupancy history goes when no range is given
+const defaultOccupancyHistoryRange = 24 * time.Hour
+
+// occupancySnapshotInterval reads how often occupancy snapshots are taken from
+// OCCUPANCY_SNAPSHOT_INTERVAL, e.g. "5m"
+func occupancySnapshotInterval() time.Duration {
+	value := os.Getenv("OCCUPANCY_SNAPSHOT_INTERVAL")
+	if value == "" {
+		return defaultOccupancySnapshotInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.Printf("invalid OCCUPANCY_SNAPSHOT_INTERVAL %q, using %s", value, defaultOccupancySnapshotInterval)
+		return defaultOccupancySnapshotInterval
+	}
+	return interval
+}
+
+// runOccupancySnapshotter periodically records the occupancy of every
+// organisation. Snapshots are stamped on the interval boundary so they line up
+// across organisations and restarts.
+func (s *Server) runOccupancySnapshotter(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		_, err := models.TakeOccupancySnapshots(s.DB, now.Truncate(interval), visitInactivityTimeout())
+		if err != nil {
+			log.Printf("[ERROR] unable to take occupancy snapshots: %v", err)
+		}
+	}
+}
+
+// GetOrganisationOccupancy counts the PUCs present in the organisation and each
+// of its zones now, or at=2021-06-01T15:00:00Z
+func (s *Server) GetOrganisationOccupancy(w http.ResponseWriter, r *http.Request) {
+	oid, ok := s.prepareAdministeredOrganisation(w, r)
+	if !ok {
+		return
+	}
+
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		at = parsed
+	}
+
+	occupancy, err := models.FindOccupancy(s.DB, oid, at, visitInactivityTimeout())
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, occupancy)
+}
+
+// GetOrganisationOccupancyHistory lists the organisation's occupancy snapshots
+// between from and to (defaulting to the last day), or a zone's with zone_id
+func (s *Server) GetOrganisationOccupancyHistory(w http.ResponseWriter, r *http.Request) {
+	oid, ok := s.prepareAdministeredOrganisation(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultOccupancyHistoryRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var zoneID *uint64
+	if value := r.URL.Query().Get("zone_id"); value != "" {
+		zid, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		zoneID = &zid
+	}
+
+	snapshots, err := models.FindOccupancySnapshots(s.DB, oid, zoneID, from, to)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, snapshots)
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultCustodyHistoryRange is how far back custody history goes when no range is given
+const defaultCustodyHistoryRange = 30 * 24 * time.Hour
+
+type pucCheckOutRequest struct {
+	UserID uint32 `json:"user_id"`
+	Notes  string `json:"notes"`
+}
+
+type pucReturnRequest struct {
+	Notes string `json:"notes"`
+}
+
+type pucCustodyResponse struct {
+	Puc     *models.Puc        `json:"puc"`
+	Custody *models.PucCustody `json:"custody"`
+}
+
+// pucCustodyAllowMultiple reads whether a user may hold several PUCs at once from
+// PUC_CUSTODY_ALLOW_MULTIPLE, e.g. "true"
+func pucCustodyAllowMultiple() bool {
+	value := os.Getenv("PUC_CUSTODY_ALLOW_MULTIPLE")
+	if value == "" {
+		return false
+	}
+
+	allowMultiple, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid PUC_CUSTODY_ALLOW_MULTIPLE %q, using false", value)
+		return false
+	}
+	return allowMultiple
+}
+
+// CheckOutPuc hands a PUC to a user, the acting user when none is given. Only
+// staff check PUCs out to someone else.
+func (s *Server) CheckOutPuc(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok {
+		return
+	}
+
+	checkOutRequest := pucCheckOutRequest{}
+	if !readOptionalJSON(w, r, &checkOutRequest) {
+		return
+	}
+	if checkOutRequest.UserID == 0 {
+		checkOutRequest.UserID = actorID
+	}
+	if checkOutRequest.UserID != actorID && !s.authorizeStaff(w, actorID) {
+		return
+	}
+
+	custody, err := puc.CheckOutPuc(s.DB, checkOutRequest.UserID, actorID, checkOutRequest.Notes, pucCustodyAllowMultiple())
+	s.respondPucCustody(w, puc, custody, err)
+}
+
+// ReturnPuc takes a PUC back from whoever holds it. Only the holder or staff
+// return a PUC.
+func (s *Server) ReturnPuc(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizePucHolder(w, puc, actorID) {
+		return
+	}
+
+	returnRequest := pucReturnRequest{}
+	if !readOptionalJSON(w, r, &returnRequest) {
+		return
+	}
+
+	custody, err := puc.ReturnPuc(s.DB, actorID, returnRequest.Notes)
+	s.respondPucCustody(w, puc, custody, err)
+}
+
+// GetPucCustodyHistory lists who held a PUC between from and to, or at a single
+// moment with at=2021-06-01T15:00:00Z. Only the PUC's holder and staff read it.
+func (s *Server) GetPucCustodyHistory(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizePucHolder(w, puc, actorID) {
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if value := r.URL.Query().Get("at"); value != "" {
+		from, err = time.Parse(time.RFC3339, value)
+		to = from
+	} else {
+		from, to, err = parseTimeRange(r, defaultCustodyHistoryRange)
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	history, err := models.FindPucCustodyHistory(s.DB, puc.ID, from, to)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, history)
+}
+
+func (s *Server) respondPucCustody(w http.ResponseWriter, puc *models.Puc, custody *models.PucCustody, err error) {
+	if err == models.ErrPucNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err == models.ErrUserNotFound {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err == models.ErrPucAlreadyCheckedOut || err == models.ErrPucNotCheckedOut || err == models.ErrUserAlreadyHoldsPuc {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, pucCustodyResponse{Puc: puc, Custody: custody})
+}
+
+// preparePucCustody resolves the PUC in the path and the acting user, writing the
+// error response itself on failure
+func (s *Server) preparePucCustody(w http.ResponseWriter, r *http.Request) (*models.Puc, uint32, bool) {
+	puc, ok := s.preparePuc(w, r)
+	if !ok {
+		return nil, 0, false
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, 0, false
+	}
+	return puc, actorID, true
+}
+
+// authorizePucHolder only lets whoever holds the PUC, or staff, through
+func (s *Server) authorizePucHolder(w http.ResponseWriter, puc *models.Puc, actorID uint32) bool {
+	if puc.CurrentUserID != nil && *puc.CurrentUserID == actorID {
+		return true
+	}
+	return s.authorizeStaff(w, actorID)
+}
+
+// readOptionalJSON decodes the request body into v when there is one, writing
+// the error response itself on failure
+func readOptionalJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+	if len(body) == 0 {
+		return true
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"net/http"
+	"time"
+)
+
+// defaultPucAlertRange is how far back lost PUC alerts go when no range is given
+const defaultPucAlertRange = 30 * 24 * time.Hour
+
+type pucLostRequest struct {
+	Notes       string `json:"notes"`
+	BlockCredit bool   `json:"block_credit"`
+}
+
+type pucFoundRequest struct {
+	Notes string `json:"notes"`
+}
+
+type pucLossResponse struct {
+	Puc        *models.Puc           `json:"puc"`
+	LossReport *models.PucLossReport `json:"loss_report"`
+}
+
+// ReportPucLost flags a PUC as lost so its next check-ins raise alerts. With
+// block_credit set its check-ins stop being credited to its holder. Only the
+// holder or staff report a PUC lost.
+func (s *Server) ReportPucLost(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizePucHolder(w, puc, actorID) {
+		return
+	}
+
+	lostRequest := pucLostRequest{}
+	if !readOptionalJSON(w, r, &lostRequest) {
+		return
+	}
+
+	report, err := puc.ReportPucLost(s.DB, actorID, lostRequest.Notes, lostRequest.BlockCredit)
+	s.respondPucLoss(w, puc, report, err)
+}
+
+// ReportPucFound clears a PUC's lost flag. Only the holder or staff report a
+// PUC found.
+func (s *Server) ReportPucFound(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizePucHolder(w, puc, actorID) {
+		return
+	}
+
+	foundRequest := pucFoundRequest{}
+	if !readOptionalJSON(w, r, &foundRequest) {
+		return
+	}
+
+	report, err := puc.ReportPucFound(s.DB, actorID, foundRequest.Notes)
+	s.respondPucLoss(w, puc, report, err)
+}
+
+// GetPucLossReports lists every time a PUC was reported lost and found, for its
+// holder and staff
+func (s *Server) GetPucLossReports(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizePucHolder(w, puc, actorID) {
+		return
+	}
+
+	reports, err := models.FindPucLossReports(s.DB, puc.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, reports)
+}
+
+// GetPucAlerts lists where a lost PUC was sighted between from and to, for its
+// holder and staff
+func (s *Server) GetPucAlerts(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizePucHolder(w, puc, actorID) {
+		return
+	}
+
+	from, to, err := parseTimeRange(r, defaultPucAlertRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	alerts, err := models.FindPucAlerts(s.DB, puc.ID, from, to)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, alerts)
+}
+
+func (s *Server) respondPucLoss(w http.ResponseWriter, puc *models.Puc, report *models.PucLossReport, err error) {
+	if err == models.ErrPucNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err == models.ErrPucAlreadyLost || err == models.ErrPucNotLost {
+		responses.ERROR(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, pucLossResponse{Puc: puc, LossReport: report})
+}
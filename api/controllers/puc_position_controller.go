@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/positioning"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// positioningWindow reads how far back readings are used to position a PUC from
+// POSITIONING_WINDOW, e.g. "30s"
+func positioningWindow() time.Duration {
+	value := os.Getenv("POSITIONING_WINDOW")
+	if value == "" {
+		return models.DefaultPositioningWindow
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		log.Printf("invalid POSITIONING_WINDOW %q, using %s", value, models.DefaultPositioningWindow)
+		return models.DefaultPositioningWindow
+	}
+	return window
+}
+
+// positioningPathLoss reads the path loss exponent used to turn RSSI into
+// distance from POSITIONING_PATH_LOSS, e.g. "2.5" for an office
+func positioningPathLoss() float64 {
+	value := os.Getenv("POSITIONING_PATH_LOSS")
+	if value == "" {
+		return positioning.DefaultPathLossExponent
+	}
+
+	exponent, err := strconv.ParseFloat(value, 64)
+	if err != nil || exponent <= 0 {
+		log.Printf("invalid POSITIONING_PATH_LOSS %q, using %v", value, positioning.DefaultPathLossExponent)
+		return positioning.DefaultPathLossExponent
+	}
+	return exponent
+}
+
+// GetPucPosition estimates where a PUC is from the beacons that heard it
+// recently, or as of at=2021-06-01T15:00:00Z. Only staff use every reading, see
+// authorizePucReader.
+func (s *Server) GetPucPosition(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok {
+		return
+	}
+	access, ok := s.authorizePucReader(w, puc, actorID)
+	if !ok {
+		return
+	}
+
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		at = parsed
+	}
+
+	position, err := models.EstimatePucPosition(s.DB, puc.ID, at, models.PositioningOptions{
+		Window:           positioningWindow(),
+		PathLossExponent: positioningPathLoss(),
+		Access:           access,
+	})
+	if err == models.ErrPositionUnknown {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, position)
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/formaterror"
+	"github.com/SherbazHashmi/goblog/api/labels"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+type pucLabelsRequest struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// CreatePuc adds a PUC to the fleet. Only staff manage PUCs.
+func (s *Server) CreatePuc(w http.ResponseWriter, r *http.Request) {
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !s.authorizeStaff(w, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	puc := models.Puc{}
+	err = json.Unmarshal(body, &puc)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	puc.Prepare()
+	puc.ID = 0
+
+	err = puc.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	pucCreated, err := puc.SavePuc(s.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, pucCreated.ID))
+	responses.JSON(w, http.StatusCreated, pucCreated)
+}
+
+// GetPucs lists PUCs, narrowed by an optional label selector such as
+// selector=team=kitchen. Who holds each PUC and where it was last seen is only
+// shown to staff and to the PUC's holder.
+func (s *Server) GetPucs(w http.ResponseWriter, r *http.Request) {
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	puc := models.Puc{}
+	pucs, err := puc.FindAllPucs(s.DB, selector)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	staff := s.isStaff(actorID)
+	for i := range *pucs {
+		redactPuc(&(*pucs)[i], actorID, staff)
+	}
+	responses.JSON(w, http.StatusOK, pucs)
+}
+
+// GetPuc shows a PUC, with its holder and where it was last seen only for staff
+// and the holder
+func (s *Server) GetPuc(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok {
+		return
+	}
+
+	redactPuc(puc, actorID, s.isStaff(actorID))
+	responses.JSON(w, http.StatusOK, puc)
+}
+
+// redactPuc hides a PUC's custody and whereabouts unless the actor is staff or holds it
+func redactPuc(puc *models.Puc, actorID uint32, staff bool) {
+	if staff || (puc.CurrentUserID != nil && *puc.CurrentUserID == actorID) {
+		return
+	}
+	puc.Redact()
+}
+
+// UpdatePuc changes a PUC's details. Only staff manage PUCs.
+func (s *Server) UpdatePuc(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizeStaff(w, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	pucUpdate := models.Puc{}
+	err = json.Unmarshal(body, &pucUpdate)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	pucUpdate.Prepare()
+
+	// labels have their own endpoint
+	pucUpdate.ID = puc.ID
+	pucUpdate.Labels = puc.Labels
+
+	pucUpdated, err := pucUpdate.UpdatePuc(s.DB, puc.ID)
+	if err == models.ErrPucNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusUnprocessableEntity, formattedError)
+		return
+	}
+	responses.JSON(w, http.StatusOK, pucUpdated)
+}
+
+// SetPucLabels replaces every label on a PUC. Only staff manage PUCs.
+func (s *Server) SetPucLabels(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok || !s.authorizeStaff(w, actorID) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	labelsRequest := pucLabelsRequest{}
+	err = json.Unmarshal(body, &labelsRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if labelsRequest.Labels == nil {
+		labelsRequest.Labels = map[string]string{}
+	}
+
+	err = puc.SetPucLabels(s.DB, labelsRequest.Labels)
+	if errors.Is(err, labels.ErrInvalidLabel) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, puc)
+}
+
+// DeletePuc retires a PUC, ending its current custody. Only staff manage PUCs.
+func (s *Server) DeletePuc(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !s.authorizeStaff(w, actorID) {
+		return
+	}
+
+	puc := models.Puc{}
+	_, err = puc.DeletePuc(s.DB, pid)
+	if err == models.ErrPucNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Entity", fmt.Sprintf("%d", pid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// preparePuc resolves the PUC in the path for an authenticated request, writing
+// the error response itself on failure
+func (s *Server) preparePuc(w http.ResponseWriter, r *http.Request) (*models.Puc, bool) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	_, err = auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+
+	puc := models.Puc{}
+	_, err = puc.FindPucByID(s.DB, pid)
+	if err == models.ErrPucNotFound {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return &puc, true
+}
+
+// authorizePucReader works out how much of a PUC's history the actor may read:
+// all of it for staff, what was credited to the actor for its holder, and what
+// happened at their beacons for organisation administrators. Anybody else is
+// refused, with the error response written here.
+func (s *Server) authorizePucReader(w http.ResponseWriter, puc *models.Puc, actorID uint32) (models.PucAccess, bool) {
+	if s.isStaff(actorID) {
+		return models.PucAccess{}, true
+	}
+
+	organisationIDs, err := models.FindAdministeredOrganisationIDs(s.DB, actorID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return models.PucAccess{}, false
+	}
+	holder := puc.CurrentUserID != nil && *puc.CurrentUserID == actorID
+	if !holder && len(organisationIDs) == 0 {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return models.PucAccess{}, false
+	}
+	return models.PucAccess{Restricted: true, UserID: actorID, OrganisationIDs: organisationIDs}, true
+}
@@ -22,4 +22,92 @@ func (s *Server) initializeRoutes() {
 	s.Router.HandleFunc("/tickets/{id}", middleware.SetMiddlewareJSON(s.GetTicket)).Methods("GET")
 	s.Router.HandleFunc("/tickets/{id}", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.UpdateTicket))).Methods("PUT")
 	s.Router.HandleFunc("/tickets/{id}", middleware.SetMiddlewareAuthentication(s.DeleteTicket)).Methods("DELETE")
+
+	// Beacon Routes
+	s.Router.HandleFunc("/beacons", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.CreateBeacon))).Methods("POST")
+	s.Router.HandleFunc("/beacons", middleware.SetMiddlewareJSON(s.GetBeacons)).Methods("GET")
+	s.Router.HandleFunc("/beacons/resolve", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.ResolveAdvertisement))).Methods("POST")
+	s.Router.HandleFunc("/beacons/import", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.ImportBeacons))).Methods("POST")
+	s.Router.HandleFunc("/beacons/nearby", middleware.SetMiddlewareJSON(s.GetNearbyBeacons)).Methods("GET")
+	s.Router.HandleFunc("/beacons/nearest", middleware.SetMiddlewareJSON(s.GetNearestBeacon)).Methods("GET")
+	s.Router.HandleFunc("/beacons/within", middleware.SetMiddlewareJSON(s.GetBeaconsInBoundingBox)).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}", middleware.SetMiddlewareJSON(s.GetBeacon)).Methods("GET")
+	s.Router.HandleFunc("/beacons/mac/{mac_address}", middleware.SetMiddlewareJSON(s.GetBeaconByMacAddress)).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.UpdateBeacon))).Methods("PUT")
+	s.Router.HandleFunc("/beacons/{id}", middleware.SetMiddlewareAuthentication(s.DeleteBeacon)).Methods("DELETE")
+	s.Router.HandleFunc("/beacons/{id}/heartbeat", middleware.SetMiddlewareJSON(s.BeaconHeartbeat)).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/telemetry", middleware.SetMiddlewareJSON(s.CreateBeaconTelemetry)).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/telemetry", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetBeaconTelemetry))).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}/events", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetBeaconEvents))).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}/checkin-rejections", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetBeaconCheckInRejections))).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}/checkins", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetBeaconCheckIns))).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}/visits", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetBeaconVisits))).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}/history", middleware.SetMiddlewareJSON(s.GetBeaconHistory)).Methods("GET")
+	s.Router.HandleFunc("/beacons/{id}/register", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.RegisterBeacon))).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/deregister", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.DeregisterBeacon))).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/suspend", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.SuspendBeacon))).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/claim-codes", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.IssueBeaconClaimCode))).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/transfers", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.RequestBeaconTransfer))).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/labels", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.SetBeaconLabels))).Methods("PUT")
+	s.Router.HandleFunc("/beacons/{id}/zone", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.AssignBeaconZone))).Methods("PUT")
+	s.Router.HandleFunc("/beacons/{id}/eid", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.ProvisionBeaconEID))).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/secret", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.RotateBeaconSecretKey))).Methods("POST")
+	s.Router.HandleFunc("/beacons/{id}/decommission", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.DecommissionBeacon))).Methods("POST")
+
+	// PUC Routes
+	s.Router.HandleFunc("/pucs", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.CreatePuc))).Methods("POST")
+	s.Router.HandleFunc("/pucs", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPucs))).Methods("GET")
+	s.Router.HandleFunc("/pucs/{id}", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPuc))).Methods("GET")
+	s.Router.HandleFunc("/pucs/{id}", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.UpdatePuc))).Methods("PUT")
+	s.Router.HandleFunc("/pucs/{id}", middleware.SetMiddlewareAuthentication(s.DeletePuc)).Methods("DELETE")
+	s.Router.HandleFunc("/pucs/{id}/labels", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.SetPucLabels))).Methods("PUT")
+	s.Router.HandleFunc("/pucs/{id}/checkout", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.CheckOutPuc))).Methods("POST")
+	s.Router.HandleFunc("/pucs/{id}/return", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.ReturnPuc))).Methods("POST")
+	s.Router.HandleFunc("/pucs/{id}/custody", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPucCustodyHistory))).Methods("GET")
+	s.Router.HandleFunc("/pucs/{id}/lost", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.ReportPucLost))).Methods("POST")
+	s.Router.HandleFunc("/pucs/{id}/found", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.ReportPucFound))).Methods("POST")
+	s.Router.HandleFunc("/pucs/{id}/loss-reports", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPucLossReports))).Methods("GET")
+	s.Router.HandleFunc("/pucs/{id}/alerts", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPucAlerts))).Methods("GET")
+	s.Router.HandleFunc("/pucs/{id}/checkins", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPucCheckIns))).Methods("GET")
+	s.Router.HandleFunc("/pucs/{id}/visits", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPucVisits))).Methods("GET")
+	s.Router.HandleFunc("/pucs/{id}/position", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetPucPosition))).Methods("GET")
+
+	// Check-in Routes
+	s.Router.HandleFunc("/checkins", middleware.SetMiddlewareJSON(s.CreateCheckIn)).Methods("POST")
+
+	// Gateway Routes
+	s.Router.HandleFunc("/gateways/{id}", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.RevokeGateway))).Methods("DELETE")
+
+	// Ingest Routes
+	s.Router.HandleFunc("/ingest/sightings", middleware.SetMiddlewareJSON(s.IngestSightings)).Methods("POST")
+
+	// Claim Code Routes
+	s.Router.HandleFunc("/claim-codes/redeem", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.RedeemClaimCode))).Methods("POST")
+	s.Router.HandleFunc("/claim-codes/{code}/qr", middleware.SetMiddlewareAuthentication(s.GetClaimCodeQR)).Methods("GET")
+
+	// Transfer Routes
+	s.Router.HandleFunc("/transfers/{id}", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetBeaconTransfer))).Methods("GET")
+	s.Router.HandleFunc("/transfers/{id}/accept", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.AcceptBeaconTransfer))).Methods("POST")
+	s.Router.HandleFunc("/transfers/{id}/reject", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.RejectBeaconTransfer))).Methods("POST")
+	s.Router.HandleFunc("/transfers/{id}/cancel", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.CancelBeaconTransfer))).Methods("POST")
+
+	// Location Routes
+	s.Router.HandleFunc("/locations", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.CreateLocation))).Methods("POST")
+	s.Router.HandleFunc("/locations/{id}", middleware.SetMiddlewareJSON(s.GetLocation)).Methods("GET")
+	s.Router.HandleFunc("/locations/{id}", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.UpdateLocation))).Methods("PUT")
+	s.Router.HandleFunc("/locations/{id}", middleware.SetMiddlewareAuthentication(s.DeleteLocation)).Methods("DELETE")
+
+	// Organisation Routes
+	s.Router.HandleFunc("/organisations/{id}/beacons", middleware.SetMiddlewareJSON(s.GetOrganisationBeacons)).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/beacons/offline", middleware.SetMiddlewareJSON(s.GetOfflineBeacons)).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/transfers", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetOrganisationBeaconTransfers))).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/gateways", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.CreateGateway))).Methods("POST")
+	s.Router.HandleFunc("/organisations/{id}/gateways", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetOrganisationGateways))).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/locations", middleware.SetMiddlewareJSON(s.GetOrganisationLocations)).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/visits", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetOrganisationVisits))).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/visits/recompute", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.RecomputeOrganisationVisits))).Methods("POST")
+	s.Router.HandleFunc("/organisations/{id}/occupancy", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetOrganisationOccupancy))).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/occupancy/history", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetOrganisationOccupancyHistory))).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/contacts", middleware.SetMiddlewareJSON(middleware.SetMiddlewareAuthentication(s.GetOrganisationContacts))).Methods("GET")
+	s.Router.HandleFunc("/organisations/{id}/contacts/export", middleware.SetMiddlewareAuthentication(s.ExportOrganisationContacts)).Methods("GET")
 }
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/auth"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/responses"
+	"github.com/SherbazHashmi/goblog/api/visits"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultVisitRange is how far back visits go when no range is given
+const defaultVisitRange = 30 * 24 * time.Hour
+
+type recomputeVisitsRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type recomputeVisitsResponse struct {
+	Pucs   int `json:"pucs"`
+	Visits int `json:"visits"`
+}
+
+// visitInactivityTimeout reads how long a PUC can go without checking in before
+// its visit ends from VISIT_INACTIVITY_TIMEOUT, e.g. "15m"
+func visitInactivityTimeout() time.Duration {
+	value := os.Getenv("VISIT_INACTIVITY_TIMEOUT")
+	if value == "" {
+		return models.DefaultVisitInactivityTimeout
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		log.Printf("invalid VISIT_INACTIVITY_TIMEOUT %q, using %s", value, models.DefaultVisitInactivityTimeout)
+		return models.DefaultVisitInactivityTimeout
+	}
+	return timeout
+}
+
+// GetPucVisits lists a PUC's visits between from and to, optionally at a single
+// scope with scope=beacon, zone or organisation. Only staff see every visit, see
+// authorizePucReader.
+func (s *Server) GetPucVisits(w http.ResponseWriter, r *http.Request) {
+	puc, actorID, ok := s.preparePucCustody(w, r)
+	if !ok {
+		return
+	}
+	access, ok := s.authorizePucReader(w, puc, actorID)
+	if !ok {
+		return
+	}
+
+	filter, ok := parseVisitFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.PucID = puc.ID
+	filter.Access = access
+
+	found, err := models.FindVisits(s.DB, filter)
+	s.respondVisits(w, found, err)
+}
+
+// GetBeaconVisits lists the visits PUCs made to a beacon between from and to
+func (s *Server) GetBeaconVisits(w http.ResponseWriter, r *http.Request) {
+	beacon, actorID, ok := s.prepareBeacon(w, r)
+	if !ok || !s.authorizeBeaconAdministrator(w, beacon, actorID) {
+		return
+	}
+
+	filter, ok := parseVisitFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Scope = visits.ScopeBeacon
+	filter.ScopeID = beacon.ID
+	filter.OrganisationID = s.beaconHistoryOrganisation(beacon, actorID)
+
+	found, err := models.FindVisits(s.DB, filter)
+	s.respondVisits(w, found, err)
+}
+
+// GetOrganisationVisits lists the visits made to an organisation's beacons and
+// zones between from and to. scope and scope_id narrow it to a single place.
+func (s *Server) GetOrganisationVisits(w http.ResponseWriter, r *http.Request) {
+	oid, ok := s.prepareAdministeredOrganisation(w, r)
+	if !ok {
+		return
+	}
+
+	filter, ok := parseVisitFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.OrganisationID = oid
+
+	if value := r.URL.Query().Get("scope_id"); value != "" {
+		scopeID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.ScopeID = scopeID
+	}
+
+	found, err := models.FindVisits(s.DB, filter)
+	s.respondVisits(w, found, err)
+}
+
+// RecomputeOrganisationVisits rebuilds the visits of every PUC that checked in to
+// the organisation between from and to, for when the inactivity timeout changes
+func (s *Server) RecomputeOrganisationVisits(w http.ResponseWriter, r *http.Request) {
+	oid, ok := s.prepareAdministeredOrganisation(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	recomputeRequest := recomputeVisitsRequest{}
+	err = json.Unmarshal(body, &recomputeRequest)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if recomputeRequest.From.IsZero() || !recomputeRequest.From.Before(recomputeRequest.To) {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("from must be before to"))
+		return
+	}
+
+	pucIDs, err := models.FindCheckedInPucs(s.DB, oid, recomputeRequest.From, recomputeRequest.To)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	written, err := models.RecomputeVisits(s.DB, pucIDs, recomputeRequest.From, recomputeRequest.To, visitInactivityTimeout())
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, recomputeVisitsResponse{Pucs: len(pucIDs), Visits: written})
+}
+
+// recomputeCheckInVisits brings the PUC's visits up to date with a new check-in.
+// Visits can always be rebuilt later, so a failure is logged rather than failing
+// the check-in.
+func (s *Server) recomputeCheckInVisits(checkIn *models.CheckIn) {
+	_, err := models.RecomputeVisits(s.DB, []uint64{checkIn.PucID}, checkIn.CheckedInAt, checkIn.CheckedInAt, visitInactivityTimeout())
+	if err != nil {
+		log.Printf("unable to recompute visits of puc %d: %v", checkIn.PucID, err)
+	}
+}
+
+func (s *Server) respondVisits(w http.ResponseWriter, found *[]models.Visit, err error) {
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusOK, found)
+}
+
+// prepareAdministeredOrganisation resolves the organisation in the path, only
+// letting its administrator through, writing the error response itself on failure
+func (s *Server) prepareAdministeredOrganisation(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	vars := mux.Vars(r)
+	oid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	actorID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return 0, false
+	}
+	if !s.authorizeOrganisationAdministrator(w, oid, actorID) {
+		return 0, false
+	}
+	return oid, true
+}
+
+// parseVisitFilter reads the from and to range (defaulting to the last 30 days)
+// and the scope, writing the error response itself on failure
+func parseVisitFilter(w http.ResponseWriter, r *http.Request) (models.VisitFilter, bool) {
+	from, to, err := parseTimeRange(r, defaultVisitRange)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return models.VisitFilter{}, false
+	}
+
+	scope := r.URL.Query().Get("scope")
+	if scope != "" && !visits.ValidScope(scope) {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("scope must be beacon, zone or organisation"))
+		return models.VisitFilter{}, false
+	}
+	return models.VisitFilter{Scope: scope, From: from, To: to}, true
+}
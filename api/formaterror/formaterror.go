@@ -19,6 +19,14 @@ func FormatError(err string) error {
 		return errors.New("title already taken")
 	}
 
+	if strings.Contains(err, "mac_address") {
+		return errors.New("Mac Address already registered")
+	}
+
+	if strings.Contains(err, "_identity") {
+		return errors.New("Broadcast identity already registered")
+	}
+
 	if strings.Contains(err, "hashedPassword") {
 		return errors.New("Incorrect password")
 	}
@@ -0,0 +1,333 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/SherbazHashmi/goblog/api/macaddress"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/jinzhu/gorm"
+	"io"
+	"time"
+)
+
+// MaxBatchSize is the most sightings a single batch may carry
+const MaxBatchSize = 5000
+
+// DefaultMaxAge is how old a sighting may be when it arrives unless configured otherwise
+const DefaultMaxAge = 24 * time.Hour
+
+// RSSI bounds a Bluetooth receiver can report, in dBm
+const (
+	MinRSSI = -127
+	MaxRSSI = 20
+)
+
+var ErrBatchTooLarge = fmt.Errorf("batch has more than %d sightings", MaxBatchSize)
+
+// Sighting is a single report from a gateway. The beacon is identified by exactly
+// one of BeaconID, MacAddress or EphemeralID, Timestamp is in unix seconds. The
+// gateway is the one the batch was authenticated as, never taken from the record.
+type Sighting struct {
+	BeaconID    uint64 `json:"beacon_id,omitempty"`
+	MacAddress  string `json:"mac_address,omitempty"`
+	EphemeralID string `json:"ephemeral_id,omitempty"`
+	PucID       uint64 `json:"puc_id"`
+	RSSI        *int   `json:"rssi"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// Rejection explains why a record was not accepted. Records are numbered from
+// one in the order they were supplied.
+type Rejection struct {
+	Record int    `json:"record"`
+	Error  string `json:"error"`
+}
+
+// Ack acknowledges a batch
+type Ack struct {
+	Accepted   int         `json:"accepted"`
+	Duplicate  int         `json:"duplicate"`
+	Rejected   int         `json:"rejected"`
+	Rejections []Rejection `json:"rejections"`
+}
+
+// Options controls which sightings are accepted
+type Options struct {
+	// MaxAge is how old a sighting may be when it arrives
+	MaxAge time.Duration
+	// ClockSkew is how far ahead of the server clock a sighting may be
+	ClockSkew time.Duration
+	// EIDWindow is how many rotation periods either side ephemeral ids are resolved over
+	EIDWindow int
+	// OrganisationID is the organisation the reporting gateway belongs to, only
+	// its beacons are resolved
+	OrganisationID uint64
+	// GatewayID is the reporting gateway, stamped on every sighting it sends
+	GatewayID uint64
+}
+
+// Batch is a parsed batch. Records that could not be parsed are already rejected.
+type Batch struct {
+	Sightings []Sighting
+	Records   []int
+	Malformed []Rejection
+}
+
+// ParseJSON reads a batch from a JSON array of sightings
+func ParseJSON(r io.Reader) (*Batch, error) {
+	var sightings []Sighting
+	err := json.NewDecoder(r).Decode(&sightings)
+	if err != nil {
+		return nil, err
+	}
+	if len(sightings) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	batch := Batch{Sightings: sightings}
+	for i := range sightings {
+		batch.Records = append(batch.Records, i+1)
+	}
+	return &batch, nil
+}
+
+// ParseNDJSON reads a batch with one sighting per line. A malformed line is
+// rejected on its own rather than failing the batch.
+func ParseNDJSON(r io.Reader) (*Batch, error) {
+	batch := Batch{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	record := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		record++
+		if record > MaxBatchSize {
+			return nil, ErrBatchTooLarge
+		}
+
+		sighting := Sighting{}
+		err := json.Unmarshal(line, &sighting)
+		if err != nil {
+			batch.Malformed = append(batch.Malformed, Rejection{Record: record, Error: err.Error()})
+			continue
+		}
+		batch.Sightings = append(batch.Sightings, sighting)
+		batch.Records = append(batch.Records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// Validate checks the fields of a sighting that need no lookups
+func (s Sighting) Validate(now time.Time, options Options) error {
+	if s.PucID == 0 {
+		return errors.New("puc_id is required")
+	}
+
+	identities := 0
+	for _, present := range []bool{s.BeaconID != 0, s.MacAddress != "", s.EphemeralID != ""} {
+		if present {
+			identities++
+		}
+	}
+	if identities != 1 {
+		return errors.New("exactly one of beacon_id, mac_address or ephemeral_id is required")
+	}
+
+	if s.RSSI == nil {
+		return errors.New("rssi is required")
+	}
+	if *s.RSSI < MinRSSI || *s.RSSI > MaxRSSI {
+		return fmt.Errorf("rssi must be between %d and %d", MinRSSI, MaxRSSI)
+	}
+
+	if s.Timestamp == 0 {
+		return errors.New("timestamp is required")
+	}
+	seenAt := time.Unix(s.Timestamp, 0)
+	if seenAt.After(now.Add(options.ClockSkew)) {
+		return errors.New("timestamp is in the future")
+	}
+	if options.MaxAge > 0 && seenAt.Before(now.Add(-options.MaxAge)) {
+		return errors.New("timestamp is too old")
+	}
+	return nil
+}
+
+// Ingest validates the batch, resolves each sighting's beacon and stores the
+// accepted sightings with bulk inserts. Invalid records are rejected and repeats
+// are counted as duplicates rather than failing the batch; only database errors
+// abort it.
+func Ingest(db *gorm.DB, batch *Batch, now time.Time, options Options) (*Ack, error) {
+	ack := Ack{Rejections: append([]Rejection{}, batch.Malformed...)}
+
+	resolver := newBeaconResolver(db, options.OrganisationID, options.EIDWindow)
+
+	var pucIDs []uint64
+	for _, sighting := range batch.Sightings {
+		pucIDs = append(pucIDs, sighting.PucID)
+	}
+	knownPucs, err := models.FindPucIDs(db, pucIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// a batch comes from a single gateway, so it plays no part in spotting repeats
+	type dedupeKey struct {
+		beaconID uint64
+		pucID    uint64
+		seenAt   int64
+	}
+	seen := map[dedupeKey]bool{}
+	lastSeen := map[uint64]time.Time{}
+
+	var accepted []models.Sighting
+	for i, sighting := range batch.Sightings {
+		reject := func(reason string) {
+			ack.Rejections = append(ack.Rejections, Rejection{Record: batch.Records[i], Error: reason})
+		}
+
+		err = sighting.Validate(now, options)
+		if err != nil {
+			reject(err.Error())
+			continue
+		}
+		if !knownPucs[sighting.PucID] {
+			reject(fmt.Sprintf("puc (ID: %d) not found", sighting.PucID))
+			continue
+		}
+
+		beaconID, reason, err := resolver.resolve(sighting)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			reject(reason)
+			continue
+		}
+
+		key := dedupeKey{beaconID, sighting.PucID, sighting.Timestamp}
+		if seen[key] {
+			ack.Duplicate++
+			continue
+		}
+		seen[key] = true
+
+		seenAt := time.Unix(sighting.Timestamp, 0)
+		accepted = append(accepted, models.Sighting{
+			GatewayID: options.GatewayID,
+			BeaconID:  beaconID,
+			PucID:     sighting.PucID,
+			RSSI:      *sighting.RSSI,
+			SeenAt:    seenAt,
+		})
+		if seenAt.After(lastSeen[beaconID]) {
+			lastSeen[beaconID] = seenAt
+		}
+	}
+
+	inserted, err := models.InsertSightings(db, accepted)
+	if err != nil {
+		return nil, err
+	}
+	ack.Accepted = int(inserted)
+	ack.Duplicate += len(accepted) - int(inserted)
+	ack.Rejected = len(ack.Rejections)
+
+	err = models.AlertLostPucSightings(db, accepted, resolver.beacons)
+	if err != nil {
+		return nil, err
+	}
+
+	// a beacon heard by a gateway is online, whether or not the sighting was new
+	for beaconID, seenAt := range lastSeen {
+		err = resolver.beacons[beaconID].MarkSeen(db, seenAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ack, nil
+}
+
+// beaconResolver looks up each beacon identity once per batch. Ephemeral ids
+// are cached by id alone as a batch spans far less than the ids' lifetime.
+type beaconResolver struct {
+	db             *gorm.DB
+	organisationID uint64
+	eidWindow      int
+	beacons        map[uint64]*models.Beacon
+	resolved       map[string]*models.Beacon
+}
+
+func newBeaconResolver(db *gorm.DB, organisationID uint64, eidWindow int) *beaconResolver {
+	return &beaconResolver{
+		db:             db,
+		organisationID: organisationID,
+		eidWindow:      eidWindow,
+		beacons:        map[uint64]*models.Beacon{},
+		resolved:       map[string]*models.Beacon{},
+	}
+}
+
+// resolve returns the sighting's beacon, or why it could not be resolved
+func (r *beaconResolver) resolve(sighting Sighting) (uint64, string, error) {
+	var key string
+	var find func(*models.Beacon) (*models.Beacon, error)
+
+	switch {
+	case sighting.BeaconID != 0:
+		key = fmt.Sprintf("id:%d", sighting.BeaconID)
+		find = func(b *models.Beacon) (*models.Beacon, error) {
+			return b.FindBeaconByID(r.db, sighting.BeaconID)
+		}
+	case sighting.MacAddress != "":
+		normalized, err := macaddress.Normalize(sighting.MacAddress)
+		if err != nil {
+			return 0, err.Error(), nil
+		}
+		key = "mac:" + normalized
+		find = func(b *models.Beacon) (*models.Beacon, error) {
+			return b.FindBeaconByMacAddress(r.db, normalized)
+		}
+	default:
+		ephemeralID, err := advertisement.NormalizeEphemeralID(sighting.EphemeralID)
+		if err != nil {
+			return 0, err.Error(), nil
+		}
+		key = "eid:" + ephemeralID
+		find = func(b *models.Beacon) (*models.Beacon, error) {
+			return b.ResolveEphemeralID(r.db, ephemeralID, time.Unix(sighting.Timestamp, 0), r.eidWindow)
+		}
+	}
+
+	beacon, cached := r.resolved[key]
+	if !cached {
+		found, err := find(&models.Beacon{})
+		if err != nil && err != models.ErrBeaconNotFound {
+			return 0, "", err
+		}
+		beacon = found
+		r.resolved[key] = beacon
+	}
+
+	// another organisation's beacons are reported as unknown so a gateway cannot
+	// probe for them
+	if beacon == nil || beacon.OrganisationID != r.organisationID {
+		return 0, "beacon not found", nil
+	}
+	if beacon.Status == models.BeaconStatusDecommissioned {
+		return 0, "beacon is decommissioned", nil
+	}
+	r.beacons[beacon.ID] = beacon
+	return beacon.ID, "", nil
+}
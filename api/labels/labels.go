@@ -0,0 +1,199 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Operators a selector requirement can apply to a label
+const (
+	Equals       = "="
+	NotEquals    = "!="
+	In           = "in"
+	NotIn        = "notin"
+	Exists       = "exists"
+	DoesNotExist = "!"
+)
+
+// MaxLength is the longest key or value a label may have
+const MaxLength = 63
+
+var ErrInvalidLabel = errors.New("invalid label")
+var ErrInvalidSelector = errors.New("invalid label selector")
+
+var (
+	keyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	valuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+	setPattern   = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+)
+
+// Requirement is a single comma separated term of a selector
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// Selector matches labels against every one of its requirements. An empty
+// selector matches everything.
+type Selector []Requirement
+
+// ValidateKey checks a label key, which may not be empty
+func ValidateKey(key string) error {
+	if len(key) > MaxLength || !keyPattern.MatchString(key) {
+		return fmt.Errorf("%w: key %q must be alphanumeric with '.', '_', '-' or '/' and at most %d characters", ErrInvalidLabel, key, MaxLength)
+	}
+	return nil
+}
+
+// ValidateValue checks a label value, which may be empty
+func ValidateValue(value string) error {
+	if len(value) > MaxLength || !valuePattern.MatchString(value) {
+		return fmt.Errorf("%w: value %q must be alphanumeric with '.', '_' or '-' and at most %d characters", ErrInvalidLabel, value, MaxLength)
+	}
+	return nil
+}
+
+// Validate checks every key and value of a label set
+func Validate(labels map[string]string) error {
+	for key, value := range labels {
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+		if err := ValidateValue(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Parse reads a Kubernetes style selector such as "floor in (1,2),type!=storage".
+// Supported terms are key=value, key==value, key!=value, key in (a,b),
+// key notin (a,b), key and !key.
+func Parse(selector string) (Selector, error) {
+	var parsed Selector
+	for _, term := range splitTerms(selector) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		requirement, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, requirement)
+	}
+	return parsed, nil
+}
+
+// splitTerms splits a selector on the commas that are not inside a value set
+func splitTerms(selector string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, r := range selector {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, selector[start:])
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	requirement := Requirement{}
+
+	if match := setPattern.FindStringSubmatch(term); match != nil {
+		requirement.Key, requirement.Operator = match[1], match[2]
+		for _, value := range strings.Split(match[3], ",") {
+			requirement.Values = append(requirement.Values, strings.TrimSpace(value))
+		}
+	} else if strings.HasPrefix(term, "!") && !strings.ContainsAny(term, "=") {
+		requirement.Key, requirement.Operator = strings.TrimSpace(term[1:]), DoesNotExist
+	} else if i := strings.Index(term, "!="); i >= 0 {
+		requirement.Key, requirement.Operator = strings.TrimSpace(term[:i]), NotEquals
+		requirement.Values = []string{strings.TrimSpace(term[i+2:])}
+	} else if i := strings.Index(term, "="); i >= 0 {
+		value := strings.TrimPrefix(term[i+1:], "=")
+		requirement.Key, requirement.Operator = strings.TrimSpace(term[:i]), Equals
+		requirement.Values = []string{strings.TrimSpace(value)}
+	} else {
+		requirement.Key, requirement.Operator = term, Exists
+	}
+
+	if err := ValidateKey(requirement.Key); err != nil {
+		return Requirement{}, fmt.Errorf("%w: %q: %v", ErrInvalidSelector, term, err)
+	}
+	for _, value := range requirement.Values {
+		if err := ValidateValue(value); err != nil {
+			return Requirement{}, fmt.Errorf("%w: %q: %v", ErrInvalidSelector, term, err)
+		}
+	}
+	return requirement, nil
+}
+
+// Matches reports whether a label set satisfies every requirement of the selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether a label set satisfies the requirement. As in
+// Kubernetes, != and notin also match labels that do not have the key at all.
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	case Equals, In:
+		return ok && contains(r.Values, value)
+	case NotEquals, NotIn:
+		return !ok || !contains(r.Values, value)
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the selector in its canonical form
+func (s Selector) String() string {
+	terms := make([]string, len(s))
+	for i, requirement := range s {
+		switch requirement.Operator {
+		case Exists:
+			terms[i] = requirement.Key
+		case DoesNotExist:
+			terms[i] = "!" + requirement.Key
+		case In, NotIn:
+			values := append([]string{}, requirement.Values...)
+			sort.Strings(values)
+			terms[i] = fmt.Sprintf("%s %s (%s)", requirement.Key, requirement.Operator, strings.Join(values, ","))
+		default:
+			terms[i] = requirement.Key + requirement.Operator + strings.Join(requirement.Values, "")
+		}
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,159 @@
+package macaddress
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Supported address lengths in bytes
+const (
+	EUI48Length = 6
+	EUI64Length = 8
+)
+
+// Kinds of random BLE device address, taken from the two most significant bits
+const (
+	RandomNonResolvable = "non_resolvable"
+	RandomResolvable    = "resolvable"
+	RandomStatic        = "static"
+	RandomReserved      = "reserved"
+)
+
+var ErrInvalidMacAddress = errors.New("invalid mac address")
+
+// Address is an EUI-48 or EUI-64 hardware address
+type Address []byte
+
+// Parse reads a hardware address regardless of case or separator. Colon, hyphen
+// and dot (Cisco style) separated forms are accepted as well as bare hex digits.
+func Parse(s string) (Address, error) {
+	digits := strings.TrimSpace(s)
+	digits = strings.NewReplacer(":", "", "-", "", ".", "", " ", "").Replace(digits)
+
+	if len(digits) != EUI48Length*2 && len(digits) != EUI64Length*2 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMacAddress, s)
+	}
+	if !validSeparators(strings.TrimSpace(s)) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMacAddress, s)
+	}
+
+	address, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMacAddress, s)
+	}
+	return address, nil
+}
+
+// Normalize returns the canonical form of a hardware address, upper case and
+// colon separated
+func Normalize(s string) (string, error) {
+	address, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return address.String(), nil
+}
+
+// validSeparators rejects addresses that mix separators or group digits unevenly
+func validSeparators(s string) bool {
+	var separator rune
+	groupLength, firstGroupLength := 0, 0
+	for _, c := range s {
+		switch c {
+		case ':', '-', '.':
+			if separator != 0 && separator != c {
+				return false
+			}
+			if groupLength == 0 {
+				return false
+			}
+			if firstGroupLength == 0 {
+				firstGroupLength = groupLength
+			} else if groupLength != firstGroupLength {
+				return false
+			}
+			separator = c
+			groupLength = 0
+		default:
+			groupLength++
+		}
+	}
+	if separator == 0 {
+		return true
+	}
+	if groupLength != firstGroupLength {
+		return false
+	}
+	// Cisco style addresses group four digits, every other style groups two
+	if separator == '.' {
+		return firstGroupLength == 4
+	}
+	return firstGroupLength == 2
+}
+
+func (a Address) String() string {
+	octets := make([]string, len(a))
+	for i, octet := range a {
+		octets[i] = fmt.Sprintf("%02X", octet)
+	}
+	return strings.Join(octets, ":")
+}
+
+// IsEUI64 reports whether the address is eight bytes long
+func (a Address) IsEUI64() bool {
+	return len(a) == EUI64Length
+}
+
+// IsMulticast reports whether the group bit of the first octet is set
+func (a Address) IsMulticast() bool {
+	return len(a) > 0 && a[0]&0x01 == 0x01
+}
+
+// IsLocallyAdministered reports whether the address was assigned locally rather
+// than from a manufacturer's OUI
+func (a Address) IsLocallyAdministered() bool {
+	return len(a) > 0 && a[0]&0x02 == 0x02
+}
+
+// OUI returns the manufacturer prefix of the address as six upper case hex digits
+func (a Address) OUI() string {
+	if len(a) < 3 {
+		return ""
+	}
+	return strings.ToUpper(hex.EncodeToString(a[:3]))
+}
+
+// RandomSubtype classifies the address as a BLE random device address using its
+// two most significant bits. The result is only meaningful for addresses that are
+// known to be random.
+func (a Address) RandomSubtype() string {
+	if len(a) == 0 {
+		return ""
+	}
+	switch a[0] >> 6 {
+	case 0x00:
+		return RandomNonResolvable
+	case 0x01:
+		return RandomResolvable
+	case 0x03:
+		return RandomStatic
+	}
+	return RandomReserved
+}
+
+// IsRandom reports whether the address looks like a random rather than a public
+// device address. Only addresses carrying a bit no public address can have are
+// treated as random: locally administered addresses, and BLE random static
+// addresses with the group bit set. An OUI missing from the vendor table says
+// nothing either way, so any other address is treated as public.
+func (a Address) IsRandom() bool {
+	if a.IsEUI64() || len(a) == 0 {
+		return false
+	}
+	if Vendor(a) != "" {
+		return false
+	}
+	return a.IsLocallyAdministered() || (a.IsMulticast() && a.RandomSubtype() == RandomStatic)
+}
@@ -0,0 +1,61 @@
+package macaddress
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"log"
+	"strings"
+	"sync"
+)
+
+//go:generate go run ../../cmd/ouiupdate -out oui.csv
+
+// oui.csv follows the layout of the IEEE MA-L registry export with the address
+// column removed, so it can be refreshed straight from the published registry.
+// The checked in table is a stub covering a few common vendors; run go generate
+// to replace it with the full registry before relying on vendor lookups.
+//
+//go:embed oui.csv
+var ouiTable string
+
+var (
+	vendors     map[string]string
+	vendorsOnce sync.Once
+)
+
+func loadVendors() {
+	vendors = map[string]string{}
+
+	records, err := csv.NewReader(strings.NewReader(ouiTable)).ReadAll()
+	if err != nil {
+		log.Printf("unable to read embedded oui table: %v", err)
+		return
+	}
+
+	// skip the header row
+	for _, record := range records[1:] {
+		if len(record) < 3 {
+			continue
+		}
+		vendors[strings.ToUpper(record[1])] = record[2]
+	}
+}
+
+// Vendor returns the manufacturer registered for the address's OUI, or an empty
+// string when the OUI is unknown or the address is locally administered
+func Vendor(a Address) string {
+	if a.IsLocallyAdministered() {
+		return ""
+	}
+	vendorsOnce.Do(loadVendors)
+	return vendors[a.OUI()]
+}
+
+// LookupVendor parses a hardware address in any supported form and returns its manufacturer
+func LookupVendor(s string) string {
+	address, err := Parse(s)
+	if err != nil {
+		return ""
+	}
+	return Vendor(address)
+}
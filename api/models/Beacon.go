@@ -3,23 +3,48 @@ package models
 import (
 	"errors"
 	"fmt"
+	"github.com/SherbazHashmi/goblog/api/labels"
+	"github.com/SherbazHashmi/goblog/api/macaddress"
 	"github.com/jinzhu/gorm"
+	"html"
+	"strings"
 	"time"
 )
 
 type Beacon struct {
 	ID           uint64       `gorm:"primary;auto_increment" json:"id"`
-	MacAddress   string       `gorm:"size:17; not null; unique" json:"mac_address"`
+	MacAddress   string       `gorm:"size:23; not null; unique" json:"mac_address"`
+	Vendor       string       `gorm:"-" json:"vendor"`
+	RandomAddress bool        `gorm:"-" json:"random_address"`
+	IBeaconUUID  string       `gorm:"column:ibeacon_uuid; size:36" json:"ibeacon_uuid"`
+	IBeaconMajor uint16       `gorm:"column:ibeacon_major" json:"ibeacon_major"`
+	IBeaconMinor uint16       `gorm:"column:ibeacon_minor" json:"ibeacon_minor"`
+	EddystoneNamespace string `gorm:"size:20" json:"eddystone_namespace"`
+	EddystoneInstance  string `gorm:"size:12" json:"eddystone_instance"`
+	EIDIdentityKey string     `gorm:"column:eid_identity_key; size:32" json:"-"`
+	EIDRotationExponent uint8 `gorm:"column:eid_rotation_exponent; default:10" json:"eid_rotation_exponent"`
+	EIDEnabled   bool         `gorm:"-" json:"eid_enabled"`
 	OrganisationID uint64	`json:"organisation_id"`
 	Organization Organisation `json:"organisation,omitempty"`
+	ZoneID       *uint64      `gorm:"index" json:"zone_id"`
+	Placement    string       `gorm:"size:255" json:"placement"`
+	Labels       map[string]string `gorm:"-" json:"labels"`
+	Latitude     *float64     `gorm:"index:idx_beacons_location" json:"latitude"`
+	Longitude    *float64     `gorm:"index:idx_beacons_location" json:"longitude"`
+	Floor        *int         `json:"floor"`
+	TxPower      *int         `gorm:"column:tx_power" json:"tx_power"`
 	IsRegistered     bool         `gorm:"default:false " json:"is_registered"`
+	Status       string       `gorm:"size:20; not null; default:'unclaimed'" json:"status"`
 	LastUpdated time.Time `gorm:"default: CURRENT_TIMESTAMP" json:"last_updated"`
+	LastSeenAt   *time.Time   `json:"last_seen_at"`
+	IsOnline     bool         `gorm:"default:false" json:"is_online"`
 	RegisteredOn time.Time `json:"registered_on"`
+	SecretKey    string       `gorm:"size:64" json:"-"`
 }
 
-type BeaconEventType struct {
-	EventType string `gorm:"primary;not null; unique" json:"event_type"`
-}
+// ErrBeaconNotFound is returned by lookups against a beacon ID that does not exist
+var ErrBeaconNotFound = errors.New("beacon not found")
+var ErrBeaconHasHistory = errors.New("beacon has recorded events, decommission it instead")
 
 
 func (b *Beacon) BeforeSave() {
@@ -27,39 +52,142 @@ func (b *Beacon) BeforeSave() {
 }
 
 func (b *Beacon) Prepare() error {
+	b.MacAddress = strings.TrimSpace(b.MacAddress)
+	b.Placement = html.EscapeString(strings.TrimSpace(b.Placement))
+	b.Organization = Organisation{}
+
 	if b.MacAddress == "" {
 		return errors.New("unable to update Beacon object as no Mac Address provided")
 	}
 
+	err := b.normalizeBroadcastIdentity()
+	if err != nil {
+		return err
+	}
+	err = b.validatePlacement()
+	if err != nil {
+		return err
+	}
+	err = labels.Validate(b.Labels)
+	if err != nil {
+		return err
+	}
+	return b.normalizeMacAddress()
+}
+
+// AfterFind fills in the details derived from the beacon's mac address and keys
+func (b *Beacon) AfterFind() error {
+	b.describeMacAddress()
+	b.EIDEnabled = b.EIDIdentityKey != ""
+	return nil
+}
+
+// normalizeMacAddress rewrites the mac address into its canonical form so the
+// same hardware is never stored under two spellings
+func (b *Beacon) normalizeMacAddress() error {
+	address, err := macaddress.Parse(b.MacAddress)
+	if err != nil {
+		return err
+	}
+	b.MacAddress = address.String()
+	b.describeMacAddress()
 	return nil
 }
 
+func (b *Beacon) describeMacAddress() {
+	address, err := macaddress.Parse(b.MacAddress)
+	if err != nil {
+		return
+	}
+	b.Vendor = macaddress.Vendor(address)
+	b.RandomAddress = address.IsRandom()
+}
+
 // Implementing CRUD for beacons
 
+func (b *Beacon) SaveBeacon(db *gorm.DB) (*Beacon, error) {
+	err := b.Prepare()
+	if err != nil {
+		return &Beacon{}, err
+	}
+	err = b.checkBroadcastIdentity(db, 0)
+	if err != nil {
+		return &Beacon{}, err
+	}
+
+	err = db.Debug().Model(&Beacon{}).Create(&b).Error
+	if err != nil {
+		return &Beacon{}, err
+	}
+
+	if len(b.Labels) > 0 {
+		err = b.SetBeaconLabels(db, b.Labels)
+		if err != nil {
+			return &Beacon{}, err
+		}
+	}
+	return b, nil
+}
+
 func (b *Beacon) FindBeaconByID(db *gorm.DB, id uint64) (*Beacon, error) {
 	err := db.Debug().Model(&Beacon{}).Where("id = ?", id).Take(&b).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrBeaconNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sets, err := FindLabels(db, LabelResourceBeacon, []uint64{b.ID})
 	if err != nil {
-		return b, nil
+		return nil, err
 	}
+	b.Labels = sets[b.ID]
+	return b, nil
+}
+
+func (b *Beacon) FindBeaconByMacAddress(db *gorm.DB, macAddress string) (*Beacon, error) {
+	normalized, err := macaddress.Normalize(macAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Debug().Model(&Beacon{}).Where("mac_address = ?", normalized).Take(&b).Error
 	if gorm.IsRecordNotFoundError(err) {
-		return nil, errors.New(fmt.Sprintf(
-			"beacon (ID: %d) not found", id))
+		return nil, ErrBeaconNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+	return b, nil
 }
 
-func (b *Beacon) FindAllBeacons(db *gorm.DB) (*[]Beacon, error) {
+// FindAllBeacons lists beacons whose labels match the selector, which may be empty
+func (b *Beacon) FindAllBeacons(db *gorm.DB, selector labels.Selector) (*[]Beacon, error) {
 	var beacons []Beacon
-	err := db.Debug().Model(&Beacon{}).Limit(100).Find(&beacons).Error
+	query := whereLabelsMatch(db.Debug().Model(&Beacon{}), LabelResourceBeacon, "beacons.id", selector)
+	err := query.Order("id").Limit(100).Find(&beacons).Error
+	if err != nil {
+		return &[]Beacon{}, err
+	}
+
+	err = attachBeaconLabels(db, beacons)
 	if err != nil {
 		return &[]Beacon{}, err
 	}
 	return &beacons, err
 }
 
-func (b *Beacon) FindOrganisationBeacons(db *gorm.DB, organisationID uint64) (*[]Beacon, error) {
+// FindOrganisationBeacons lists an organisation's beacons whose labels match the selector, which may be empty
+func (b *Beacon) FindOrganisationBeacons(db *gorm.DB, organisationID uint64, selector labels.Selector) (*[]Beacon, error) {
 	var beacons []Beacon
-	err := db.Debug().Model(&Beacon{}).Limit(100).Find("organisation_id = ?", organisationID).Take(&beacons).Error
+	query := whereLabelsMatch(db.Debug().Model(&Beacon{}), LabelResourceBeacon, "beacons.id", selector)
+	err := query.Where("organisation_id = ?", organisationID).Order("id").Limit(100).Find(&beacons).Error
+	if err != nil {
+		return &[]Beacon{}, err
+	}
+
+	err = attachBeaconLabels(db, beacons)
 	if err != nil {
 		return &[]Beacon{}, err
 	}
@@ -69,96 +197,247 @@ func (b *Beacon) FindOrganisationBeacons(db *gorm.DB, organisationID uint64) (*[
 func (b *Beacon) UpdateBeacon(db *gorm.DB, uid uint64) error {
 	// do pre-update operations
 	b.BeforeSave()
+	err := b.normalizeMacAddress()
+	if err != nil {
+		return err
+	}
+
+	existing := Beacon{}
+	err = db.Debug().Model(&Beacon{}).Where("id = ?", uid).Take(&existing).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrBeaconNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = b.checkBroadcastIdentity(db, uid)
+	if err != nil {
+		return err
+	}
 
 	// update object
-	db = db.Debug().Model(&Beacon{}).Where("id = ?", uid).Take(&Beacon{}).UpdateColumns(
+	err = db.Debug().Model(&Beacon{}).Where("id = ?", uid).UpdateColumns(
 		map[string]interface{}{
 			"mac_address": b.MacAddress,
-			"organisation": b.Organization,
 			"organisation_id": b.OrganisationID,
+			"placement": b.Placement,
+			"latitude": b.Latitude,
+			"longitude": b.Longitude,
+			"floor": b.Floor,
+			"tx_power": b.TxPower,
+			"ibeacon_uuid": b.IBeaconUUID,
+			"ibeacon_major": b.IBeaconMajor,
+			"ibeacon_minor": b.IBeaconMinor,
+			"eddystone_namespace": b.EddystoneNamespace,
+			"eddystone_instance": b.EddystoneInstance,
 			"is_registered": b.IsRegistered,
+			"status": b.Status,
+			"registered_on": b.RegisteredOn,
 			"last_updated": time.Now(),
-		})
+		}).Error
 
-	if db.Error != nil {
-		return db.Error
+	if err != nil {
+		return err
+	}
+
+	if changes := existing.configChanges(b); len(changes) > 0 {
+		err = RecordBeaconEvent(db, uid, existing.OrganisationID, BeaconEventConfigChanged, "changed "+strings.Join(changes, ", "), time.Now())
+		if err != nil {
+			return err
+		}
 	}
 
 	// retrieve updated object for return
-	err := db.Debug().Model(&Beacon{}).Where("id = ?", uid).Take(&b).Error
+	err = db.Debug().Model(&Beacon{}).Where("id = ?", uid).Take(&b).Error
 
 	if err != nil {
-		return nil
+		return err
 	}
 	return nil
 }
 
+// configChanges lists the configurable fields that differ in the updated beacon
+func (b *Beacon) configChanges(updated *Beacon) []string {
+	var changes []string
+	if b.MacAddress != updated.MacAddress {
+		changes = append(changes, "mac_address")
+	}
+	if b.Placement != updated.Placement {
+		changes = append(changes, "placement")
+	}
+	if !equalFloatPointers(b.Latitude, updated.Latitude) || !equalFloatPointers(b.Longitude, updated.Longitude) {
+		changes = append(changes, "location")
+	}
+	if (b.Floor == nil) != (updated.Floor == nil) || (b.Floor != nil && *b.Floor != *updated.Floor) {
+		changes = append(changes, "floor")
+	}
+	if (b.TxPower == nil) != (updated.TxPower == nil) || (b.TxPower != nil && *b.TxPower != *updated.TxPower) {
+		changes = append(changes, "tx_power")
+	}
+	if b.IBeaconUUID != updated.IBeaconUUID || b.IBeaconMajor != updated.IBeaconMajor || b.IBeaconMinor != updated.IBeaconMinor {
+		changes = append(changes, "ibeacon")
+	}
+	if b.EddystoneNamespace != updated.EddystoneNamespace || b.EddystoneInstance != updated.EddystoneInstance {
+		changes = append(changes, "eddystone")
+	}
+	return changes
+}
+
+func equalFloatPointers(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (b *Beacon) DeleteBeacon(db *gorm.DB, uid uint64) (int64, error) {
+	// the event log is an audit trail, so a beacon that has one is kept and
+	// decommissioned rather than deleted
+	events := 0
+	err := db.Debug().Model(&BeaconEvent{}).Where("beacon_id = ?", uid).Count(&events).Error
+	if err != nil {
+		return 0, err
+	}
+	if events > 0 {
+		return 0, ErrBeaconHasHistory
+	}
+
 	db = db.Debug().Model(&Beacon{}).Where("id = ?", uid).Take(&Beacon{}).Delete(&Beacon{})
 
+	if gorm.IsRecordNotFoundError(db.Error) {
+		return 0, ErrBeaconNotFound
+	}
 	if db.Error != nil {
 		return 0, db.Error
 	}
 
+	// labels are shared with PUCs so are not removed by a foreign key
+	err = db.New().Debug().Where("resource_type = ? AND resource_id = ?", LabelResourceBeacon, uid).Delete(&Label{}).Error
+	if err != nil {
+		return 0, err
+	}
+
 	return db.RowsAffected, nil
 }
 
-func (b *Beacon) RegisterBeacon(db *gorm.DB, organisation Organisation) error {
-	err := b.changeBeaconRegistration(db, organisation, false)
+// CheckInPUC records a PUC checking in to the beacon at the given time, appending
+// to the check-in history and refreshing the PUC's last check-in. A check-in that
+// repeats one already recorded, as decided by dedupe, is not recorded again; the
+// existing check-in is returned and reported as a duplicate. A check-in of a PUC
+// reported lost raises an alert.
+func (b *Beacon) CheckInPUC(db *gorm.DB, pucID uint64, checkedInAt time.Time, rssi *int, dedupe CheckInDedupe) (*CheckIn, bool, error) {
+	p := Puc{}
+	// Check if PUC is registered
+	_, err := p.FindPucByID(db, pucID)
+	if err == ErrPucNotFound {
+		return nil, false, fmt.Errorf("%w with the following ID: %d", ErrPucNotFound, pucID)
+	}
 	if err != nil {
-		return err
+		return nil, false, err
+	}
+
+	checkIn := CheckIn{
+		PucID:          p.ID,
+		BeaconID:       b.ID,
+		OrganisationID: b.OrganisationID,
+		ZoneID:         b.ZoneID,
+		UserID:         p.CurrentUserID,
+		RSSI:           rssi,
+		CheckedInAt:    checkedInAt,
+	}
+	if dedupe.IdempotencyKey != "" {
+		checkIn.IdempotencyKey = &dedupe.IdempotencyKey
 	}
-	return nil
-}
 
-func (b *Beacon) DeregisterBeacon(db *gorm.DB, organisation Organisation) error {
-	err := b.changeBeaconRegistration(db, organisation, true)
+	tx := db.Begin()
+	// locking the PUC serialises its check-ins so concurrent repeats are caught
+	locked := Puc{}
+	err = tx.Debug().Model(&Puc{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", p.ID).Take(&locked).Error
 	if err != nil {
-		return err
+		tx.Rollback()
+		return nil, false, err
 	}
-	return nil
-}
 
-// changeBeaconRegistration Associates a Beacon to an Organisation
-func (b *Beacon) changeBeaconRegistration(db *gorm.DB, organisation Organisation, isRegistration bool) error {
-	b.RegisteredOn = time.Now()
-	b.LastUpdated = time.Now()
+	var lossReport *PucLossReport
+	if locked.LostAt != nil {
+		lossReport, err = findOpenLossReport(tx, p.ID)
+		if err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
+		if lossReport.BlockCredit {
+			// whoever has the PUC now is not its holder
+			checkIn.UserID = nil
+		}
+	}
 
-	if isRegistration {
-		if organisation.ID == 0 {
-			return errors.New("unable to change registration of unresolved organisation")
+	duplicate, err := findDuplicateCheckIn(tx, checkIn, dedupe)
+	if err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+	if duplicate != nil {
+		// a repeat still places the lost PUC at the beacon
+		if lossReport != nil {
+			err = alertRepeatedCheckIn(tx, lossReport, b, duplicate, checkedInAt)
+			if err != nil {
+				tx.Rollback()
+				return nil, false, err
+			}
 		}
-		b.Organization = organisation
-		b.OrganisationID = organisation.ID
-	} else {
-		b.IsRegistered = true
+
+		// the beacon was still heard, so it is online
+		err = b.MarkSeen(tx, checkedInAt)
+		if err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
+		err = tx.Commit().Error
+		if err != nil {
+			return nil, false, err
+		}
+		return duplicate, true, nil
 	}
 
-	err := b.UpdateBeacon(db, b.ID)
+	err = tx.Debug().Model(&CheckIn{}).Create(&checkIn).Error
+	if isIdempotencyKeyConflict(err) {
+		tx.Rollback()
+		return nil, false, ErrIdempotencyKeyReused
+	}
 	if err != nil {
-		return errors.New("unable to register beacon")
+		tx.Rollback()
+		return nil, false, err
 	}
-	return nil
-}
 
-// CheckInPUC Logs interaction of PUC with Beacon
-func (b *Beacon) CheckInPUC(db *gorm.DB, pucID uint32) error{
-	p := Puc{}
-	// Check if PUC is registered to the beacon
-	err := db.Debug().Model(&Puc{}).Where("id = ?", pucID).Take(&p).Error
+	if lossReport != nil {
+		err = raiseLostPucAlert(tx, lossReport, b, checkIn.PucID, checkIn.CheckedInAt, &checkIn.ID)
+		if err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
+	}
+
+	err = p.RecordCheckIn(tx, b.ID, checkedInAt)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to find PUC with the following ID: %d", pucID))
+		tx.Rollback()
+		return nil, false, errors.New(fmt.Sprintf("unable to update PUC with the following ID: %d", pucID))
 	}
-	p.LastBeaconCheckedInto = *b
-	p.LastCheckedIn = time.Now()
-	updatedPuc, err := p.UpdatePuc(db, pucID)
 
+	err = RecordBeaconEvent(tx, b.ID, b.OrganisationID, BeaconEventCheckIn, fmt.Sprintf("puc %d", pucID), checkedInAt)
 	if err != nil {
-		return errors.New(fmt.Sprintf("unable to update PUC with the following ID: %d", pucID))
+		tx.Rollback()
+		return nil, false, err
 	}
 
-	if updatedPuc.LastCheckedIn != p.LastCheckedIn || updatedPuc.LastBeaconCheckedIntoID != p.LastBeaconCheckedIntoID{
-		return errors.New(fmt.Sprintf("update operation on puc with the following ID: %d failed", pucID))
+	err = b.MarkSeen(tx, checkedInAt)
+	if err != nil {
+		tx.Rollback()
+		return nil, false, err
 	}
-	return nil
-}
\ No newline at end of file
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, false, err
+	}
+	return &checkIn, false, nil
+}
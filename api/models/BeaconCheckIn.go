@@ -0,0 +1,172 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// Reasons a signed check-in is rejected
+var (
+	ErrCheckInUnsigned       = errors.New("check-in is not signed")
+	ErrCheckInBadSignature   = errors.New("check-in signature is invalid")
+	ErrCheckInClockSkew      = errors.New("check-in timestamp is outside the allowed clock skew")
+	ErrCheckInReplayed       = errors.New("check-in nonce has already been used")
+	ErrCheckInNotProvisioned = errors.New("beacon has no check-in key, register it first")
+	ErrCheckInNotRegistered  = errors.New("beacon is not registered")
+)
+
+// SignedCheckIn is a check-in submitted by a PUC. Signature is the hex encoded
+// HMAC-SHA256 of CheckInMessage under the beacon's secret key. Beacons broadcasting
+// ephemeral ids are identified by EphemeralID instead of BeaconID, the signature
+// still covers the resolved beacon's ID. RSSI is what the PUC measured and is not
+// covered by the signature, nor is the IdempotencyKey a gateway attaches so its
+// retries are recognised.
+type SignedCheckIn struct {
+	BeaconID       uint64 `json:"beacon_id"`
+	EphemeralID    string `json:"ephemeral_id,omitempty"`
+	PucID          uint64 `json:"puc_id"`
+	Timestamp      int64  `json:"timestamp"`
+	Nonce          string `json:"nonce"`
+	Signature      string `json:"signature"`
+	RSSI           *int   `json:"rssi,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// CheckInNonce remembers a nonce already used with a beacon so the check-in cannot be replayed
+type CheckInNonce struct {
+	ID        uint64    `gorm:"primary_key;auto_increment"`
+	BeaconID  uint64    `gorm:"not null;unique_index:idx_check_in_nonces_beacon_nonce"`
+	Nonce     string    `gorm:"size:64;not null;unique_index:idx_check_in_nonces_beacon_nonce"`
+	CreatedAt time.Time `gorm:"not null;index"`
+}
+
+// CheckInMessage is the string a check-in signature is computed over
+func CheckInMessage(beaconID uint64, pucID uint64, timestamp int64, nonce string) string {
+	return fmt.Sprintf("%d:%d:%d:%s", beaconID, pucID, timestamp, nonce)
+}
+
+// SignCheckIn computes the signature a PUC attaches to a check-in
+func SignCheckIn(secretKey string, beaconID uint64, pucID uint64, timestamp int64, nonce string) (string, error) {
+	key, err := hex.DecodeString(secretKey)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(CheckInMessage(beaconID, pucID, timestamp, nonce)))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func generateSecretKey() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
+
+// RotateSecretKey provisions the beacon with a new check-in signing key,
+// invalidating the previous one
+func (b *Beacon) RotateSecretKey(db *gorm.DB) error {
+	secretKey, err := generateSecretKey()
+	if err != nil {
+		return err
+	}
+
+	err = db.Debug().Model(&Beacon{}).Where("id = ?", b.ID).UpdateColumn("secret_key", secretKey).Error
+	if err != nil {
+		return err
+	}
+	b.SecretKey = secretKey
+	return nil
+}
+
+// clearSecretKey withdraws the beacon's check-in signing key when it leaves service
+func (b *Beacon) clearSecretKey(db *gorm.DB) error {
+	err := db.Debug().Model(&Beacon{}).Where("id = ?", b.ID).UpdateColumn("secret_key", "").Error
+	if err != nil {
+		return err
+	}
+	b.SecretKey = ""
+	return nil
+}
+
+// VerifyCheckIn checks the signature, freshness and uniqueness of a signed
+// check-in against the beacon. A gateway's retry reuses the nonce, so a check-in
+// whose idempotency key names the check-in it signs is not rejected as a replay.
+// Rejected attempts are counted by reason, see CheckInRejection.
+func (b *Beacon) VerifyCheckIn(db *gorm.DB, checkIn SignedCheckIn, now time.Time, clockSkew time.Duration) error {
+	err := b.verifyCheckIn(db, checkIn, now, clockSkew)
+	if err != nil {
+		recordErr := RecordCheckInRejection(db, b.ID, b.OrganisationID, err.Error(), checkIn.PucID, now)
+		if recordErr != nil {
+			return recordErr
+		}
+	}
+	return err
+}
+
+func (b *Beacon) verifyCheckIn(db *gorm.DB, checkIn SignedCheckIn, now time.Time, clockSkew time.Duration) error {
+	if b.Status != BeaconStatusRegistered {
+		return ErrCheckInNotRegistered
+	}
+	if b.SecretKey == "" {
+		return ErrCheckInNotProvisioned
+	}
+	if checkIn.Signature == "" || checkIn.Nonce == "" || len(checkIn.Nonce) > 64 {
+		return ErrCheckInUnsigned
+	}
+
+	expected, err := SignCheckIn(b.SecretKey, b.ID, checkIn.PucID, checkIn.Timestamp, checkIn.Nonce)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(checkIn.Signature))) {
+		return ErrCheckInBadSignature
+	}
+
+	signedAt := time.Unix(checkIn.Timestamp, 0)
+	if signedAt.Before(now.Add(-clockSkew)) || signedAt.After(now.Add(clockSkew)) {
+		return ErrCheckInClockSkew
+	}
+
+	if checkIn.IdempotencyKey != "" {
+		existing, err := FindCheckInByIdempotencyKey(db, checkIn.IdempotencyKey)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.BeaconID == b.ID && existing.PucID == uint64(checkIn.PucID) &&
+			existing.CheckedInAt.Unix() == checkIn.Timestamp {
+			return nil
+		}
+	}
+
+	// nonces only need remembering for as long as their timestamp would be accepted
+	err = db.Debug().Where("created_at < ?", now.Add(-2*clockSkew)).Delete(&CheckInNonce{}).Error
+	if err != nil {
+		return err
+	}
+
+	var used int
+	err = db.Debug().Model(&CheckInNonce{}).Where("beacon_id = ? AND nonce = ?", b.ID, checkIn.Nonce).Count(&used).Error
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrCheckInReplayed
+	}
+
+	err = db.Debug().Create(&CheckInNonce{BeaconID: b.ID, Nonce: checkIn.Nonce, CreatedAt: now}).Error
+	if err != nil && strings.Contains(err.Error(), "idx_check_in_nonces_beacon_nonce") {
+		// a concurrent submission of the same check-in won the race
+		return ErrCheckInReplayed
+	}
+	return err
+}
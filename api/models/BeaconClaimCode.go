@@ -0,0 +1,180 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// DefaultClaimCodeTTL is how long a claim code can be redeemed for, long enough
+// for a printed code to ship with the hardware
+const DefaultClaimCodeTTL = 30 * 24 * time.Hour
+
+// claimCodeAlphabet leaves out characters that are easily misread on a label
+const claimCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// claimCodeLength characters of a 32 letter alphabet give 60 bits of entropy
+const claimCodeLength = 12
+
+// ErrInvalidClaimCode does not say whether a code was unknown, used or expired so
+// redemption cannot be used to probe for codes
+var ErrInvalidClaimCode = errors.New("invalid or expired claim code")
+
+// BeaconClaimCode is a one-time code that lets an organisation administrator
+// register an unclaimed beacon without knowing its ID. Only a hash of the code is stored.
+type BeaconClaimCode struct {
+	ID                       uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	BeaconID                 uint64     `gorm:"not null;index" json:"beacon_id"`
+	CodeHash                 string     `gorm:"size:64;not null;unique_index" json:"-"`
+	Code                     string     `gorm:"-" json:"code,omitempty"`
+	IssuedByID               uint32     `gorm:"not null" json:"issued_by_id"`
+	CreatedAt                time.Time  `json:"created_at"`
+	ExpiresAt                time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt                *time.Time `json:"revoked_at"`
+	RedeemedAt               *time.Time `json:"redeemed_at"`
+	RedeemedByID             *uint32    `json:"redeemed_by_id"`
+	RedeemedByOrganisationID *uint64    `json:"redeemed_by_organisation_id"`
+}
+
+func generateClaimCode() (string, error) {
+	random := make([]byte, claimCodeLength)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	code := make([]byte, claimCodeLength)
+	for i, b := range random {
+		code[i] = claimCodeAlphabet[int(b)%len(claimCodeAlphabet)]
+	}
+	return string(code), nil
+}
+
+// NormalizeClaimCode strips the separators and case a code may be typed with
+func NormalizeClaimCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// FormatClaimCode groups a code into blocks of four for printing
+func FormatClaimCode(code string) string {
+	code = NormalizeClaimCode(code)
+	var groups []string
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(groups, code), "-")
+}
+
+func hashClaimCode(code string) string {
+	sum := sha256.Sum256([]byte(NormalizeClaimCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueClaimCode generates a new claim code for an unclaimed beacon, revoking any
+// code issued for it before. The plain code is only available on the returned value.
+func (b *Beacon) IssueClaimCode(db *gorm.DB, actorID uint32, ttl time.Duration) (*BeaconClaimCode, error) {
+	if b.Status != BeaconStatusUnclaimed && b.Status != "" {
+		return nil, fmt.Errorf("%w: only unclaimed beacons can be given a claim code", ErrInvalidBeaconTransition)
+	}
+	if ttl <= 0 {
+		ttl = DefaultClaimCodeTTL
+	}
+
+	code, err := generateClaimCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = db.Debug().Model(&BeaconClaimCode{}).
+		Where("beacon_id = ? AND redeemed_at IS NULL AND revoked_at IS NULL", b.ID).
+		UpdateColumn("revoked_at", now).Error
+	if err != nil {
+		return nil, err
+	}
+
+	claimCode := BeaconClaimCode{
+		BeaconID:   b.ID,
+		CodeHash:   hashClaimCode(code),
+		IssuedByID: actorID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	err = db.Debug().Model(&BeaconClaimCode{}).Create(&claimCode).Error
+	if err != nil {
+		return nil, err
+	}
+	claimCode.Code = FormatClaimCode(code)
+	return &claimCode, nil
+}
+
+// FindRedeemableClaimCode looks up a code that has not been used, revoked or expired
+func (c *BeaconClaimCode) FindRedeemableClaimCode(db *gorm.DB, code string, now time.Time) (*BeaconClaimCode, error) {
+	err := db.Debug().Model(&BeaconClaimCode{}).
+		Where("code_hash = ? AND redeemed_at IS NULL AND revoked_at IS NULL AND expires_at > ?", hashClaimCode(code), now).
+		Take(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrInvalidClaimCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RedeemClaimCode registers the code's beacon to the organisation through
+// RegisterBeacon. The code is spent before registering, so two redemptions racing
+// each other cannot both succeed, and is handed back if registration fails.
+// Registering issues a new check-in key, so nobody who held the beacon before
+// can keep signing check-ins for it.
+func RedeemClaimCode(db *gorm.DB, code string, organisation Organisation, actorID uint32, reason string) (*Beacon, error) {
+	now := time.Now()
+	claimCode := BeaconClaimCode{}
+	_, err := claimCode.FindRedeemableClaimCode(db, code, now)
+	if err != nil {
+		return nil, err
+	}
+
+	spent := db.Debug().Model(&BeaconClaimCode{}).
+		Where("id = ? AND redeemed_at IS NULL AND revoked_at IS NULL AND expires_at > ?", claimCode.ID, now).
+		UpdateColumns(map[string]interface{}{
+			"redeemed_at":                 now,
+			"redeemed_by_id":              actorID,
+			"redeemed_by_organisation_id": organisation.ID,
+		})
+	if spent.Error != nil {
+		return nil, spent.Error
+	}
+	if spent.RowsAffected == 0 {
+		return nil, ErrInvalidClaimCode
+	}
+
+	beacon := Beacon{}
+	_, err = beacon.FindBeaconByID(db, claimCode.BeaconID)
+	if err == nil {
+		if reason == "" {
+			reason = "claimed with a claim code"
+		}
+		err = beacon.RegisterBeacon(db, organisation, actorID, reason)
+	}
+	if err != nil {
+		restoreErr := db.Debug().Model(&BeaconClaimCode{}).Where("id = ?", claimCode.ID).UpdateColumns(
+			map[string]interface{}{
+				"redeemed_at":                 nil,
+				"redeemed_by_id":              nil,
+				"redeemed_by_organisation_id": nil,
+			}).Error
+		if restoreErr != nil {
+			return nil, restoreErr
+		}
+		return nil, err
+	}
+	return &beacon, nil
+}
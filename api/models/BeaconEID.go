@@ -0,0 +1,183 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// DefaultEIDRotationExponent rotates ephemeral ids every 2^10 seconds, about 17 minutes
+const DefaultEIDRotationExponent = 10
+
+// DefaultEIDResolveWindow is how many rotation periods either side of the
+// observation time are searched, allowing for drift in the beacon's clock
+const DefaultEIDResolveWindow = 1
+
+// DefaultEIDRefreshInterval is how often the stored ephemeral ids are topped up
+const DefaultEIDRefreshInterval = time.Minute
+
+// BeaconEphemeralID is an ephemeral id a beacon broadcasts between ValidFrom and
+// ValidUntil. They are computed ahead of time so an observed id is resolved with
+// a single indexed lookup.
+type BeaconEphemeralID struct {
+	ID          uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	BeaconID    uint64    `gorm:"not null;index" json:"beacon_id"`
+	EphemeralID string    `gorm:"size:16;not null;index:idx_beacon_ephemeral_ids_eid" json:"ephemeral_id"`
+	ValidFrom   time.Time `gorm:"not null" json:"valid_from"`
+	ValidUntil  time.Time `gorm:"not null" json:"valid_until"`
+}
+
+// EIDSchedule says which ephemeral ids are kept: window rotation periods either
+// side of the current time, topped up every interval
+type EIDSchedule struct {
+	Window   int
+	Interval time.Duration
+}
+
+// ProvisionEID registers the identity key the beacon derives its ephemeral ids
+// from, generating one when identityKey is empty. The previous key stops resolving.
+func (b *Beacon) ProvisionEID(db *gorm.DB, identityKey string, rotationExponent uint8, schedule EIDSchedule) error {
+	identityKey = strings.ToUpper(strings.TrimSpace(identityKey))
+	if identityKey == "" {
+		key := make([]byte, 16)
+		_, err := rand.Read(key)
+		if err != nil {
+			return err
+		}
+		identityKey = strings.ToUpper(hex.EncodeToString(key))
+	}
+
+	// computing an id checks the key and exponent are usable before they are stored
+	_, err := advertisement.ComputeEID(identityKey, rotationExponent, 0)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	err = tx.Debug().Model(&Beacon{}).Where("id = ?", b.ID).UpdateColumns(
+		map[string]interface{}{
+			"eid_identity_key":      identityKey,
+			"eid_rotation_exponent": rotationExponent,
+		}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	provisioned := *b
+	provisioned.EIDIdentityKey = identityKey
+	provisioned.EIDRotationExponent = rotationExponent
+	err = provisioned.refreshEphemeralIDs(tx, time.Now(), schedule)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return err
+	}
+	b.EIDIdentityKey = identityKey
+	b.EIDRotationExponent = rotationExponent
+	b.EIDEnabled = true
+	return nil
+}
+
+// RefreshEphemeralIDs computes the upcoming ephemeral ids of every provisioned
+// beacon that would run out before the next refresh, and returns how many
+// beacons were refreshed
+func RefreshEphemeralIDs(db *gorm.DB, now time.Time, schedule EIDSchedule) (int, error) {
+	// a beacon is due when its stored ids end before the window past the next refresh
+	var beacons []Beacon
+	err := db.Debug().Model(&Beacon{}).
+		Where("eid_identity_key <> '' AND status <> ?", BeaconStatusDecommissioned).
+		Where(`NOT EXISTS (SELECT 1 FROM beacon_ephemeral_ids
+			WHERE beacon_ephemeral_ids.beacon_id = beacons.id
+			AND beacon_ephemeral_ids.valid_until >= ?::timestamptz + (? * power(2, beacons.eid_rotation_exponent) + ?) * interval '1 second')`,
+			now, schedule.Window, int64(schedule.Interval.Seconds())).
+		Find(&beacons).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i, _ := range beacons {
+		tx := db.Begin()
+		err = beacons[i].refreshEphemeralIDs(tx, now, schedule)
+		if err != nil {
+			tx.Rollback()
+			return i, err
+		}
+		err = tx.Commit().Error
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(beacons), nil
+}
+
+// refreshEphemeralIDs replaces the beacon's stored ephemeral ids with those from
+// window rotation periods before now until window periods past the refresh after next
+func (b *Beacon) refreshEphemeralIDs(tx *gorm.DB, now time.Time, schedule EIDSchedule) error {
+	err := tx.Debug().Where("beacon_id = ?", b.ID).Delete(&BeaconEphemeralID{}).Error
+	if err != nil {
+		return err
+	}
+
+	period := advertisement.EIDRotationPeriod(b.EIDRotationExponent)
+	window := time.Duration(schedule.Window) * period
+	last := now.Add(window + 2*schedule.Interval)
+	// periods start on multiples of the period counting from the unix epoch
+	first := time.Unix(now.Add(-window).Unix()&^(int64(period/time.Second)-1), 0)
+	for at := first; !at.After(last); at = at.Add(period) {
+		eid, err := advertisement.ComputeEID(b.EIDIdentityKey, b.EIDRotationExponent, advertisement.EIDCounter(at))
+		if err != nil {
+			return err
+		}
+		stored := BeaconEphemeralID{
+			BeaconID:    b.ID,
+			EphemeralID: eid,
+			ValidFrom:   at,
+			ValidUntil:  at.Add(period),
+		}
+		err = tx.Debug().Model(&BeaconEphemeralID{}).Create(&stored).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveEphemeralID finds the beacon that broadcast an ephemeral id observed at
+// the given time, allowing window rotation periods either side of it. Only the
+// ids kept by RefreshEphemeralIDs resolve.
+func (b *Beacon) ResolveEphemeralID(db *gorm.DB, ephemeralID string, observedAt time.Time, window int) (*Beacon, error) {
+	ephemeralID, err := advertisement.NormalizeEphemeralID(ephemeralID)
+	if err != nil {
+		return nil, err
+	}
+	if window < 0 {
+		return nil, errors.New("eid resolve window cannot be negative")
+	}
+
+	beacon := Beacon{}
+	err = db.Debug().Model(&Beacon{}).
+		Joins("JOIN beacon_ephemeral_ids ON beacon_ephemeral_ids.beacon_id = beacons.id").
+		Where("beacon_ephemeral_ids.ephemeral_id = ? AND beacons.status <> ?", ephemeralID, BeaconStatusDecommissioned).
+		Where(`beacon_ephemeral_ids.valid_from - (beacon_ephemeral_ids.valid_until - beacon_ephemeral_ids.valid_from) * ? <= ?::timestamptz
+			AND beacon_ephemeral_ids.valid_until + (beacon_ephemeral_ids.valid_until - beacon_ephemeral_ids.valid_from) * ? > ?::timestamptz`,
+			window, observedAt, window, observedAt).
+		Select("beacons.*").
+		Take(&beacon).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrBeaconNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	*b = beacon
+	return b, nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// Beacon event types, seeded by SeedBeaconEventTypes
+const (
+	BeaconEventRegistered          = "registered"
+	BeaconEventRegistrationPending = "registration_pending"
+	BeaconEventDeregistered        = "deregistered"
+	BeaconEventSuspended           = "suspended"
+	BeaconEventDecommissioned      = "decommissioned"
+	BeaconEventCheckIn             = "check_in"
+	BeaconEventOffline             = "offline"
+	BeaconEventOnline              = "online"
+	BeaconEventConfigChanged       = "config_changed"
+	BeaconEventBatteryLow          = "battery_low"
+	BeaconEventTransferRequested   = "transfer_requested"
+	BeaconEventTransferred         = "transferred"
+	BeaconEventLostPucSighted      = "lost_puc_sighted"
+)
+
+// BatteryLowMillivolts is the battery level below which a beacon reports battery_low
+const BatteryLowMillivolts = 2500
+
+var beaconEventTypes = []BeaconEventType{
+	{EventType: BeaconEventRegistered, Description: "beacon registered to an organisation"},
+	{EventType: BeaconEventRegistrationPending, Description: "registration awaiting the organisation administrator"},
+	{EventType: BeaconEventDeregistered, Description: "beacon released from its organisation"},
+	{EventType: BeaconEventSuspended, Description: "beacon taken out of service"},
+	{EventType: BeaconEventDecommissioned, Description: "beacon permanently retired"},
+	{EventType: BeaconEventCheckIn, Description: "a PUC checked in to the beacon"},
+	{EventType: BeaconEventOffline, Description: "beacon not heard within its offline threshold"},
+	{EventType: BeaconEventOnline, Description: "beacon heard again after being offline"},
+	{EventType: BeaconEventConfigChanged, Description: "beacon details edited"},
+	{EventType: BeaconEventBatteryLow, Description: "beacon battery dropped below the low threshold"},
+	{EventType: BeaconEventTransferRequested, Description: "transfer to another organisation requested"},
+	{EventType: BeaconEventTransferred, Description: "beacon moved to another organisation"},
+	{EventType: BeaconEventLostPucSighted, Description: "security: a PUC reported lost checked in to the beacon"},
+}
+
+// lifecycleEvents maps the state a beacon moves to onto the event it records
+var lifecycleEvents = map[string]string{
+	BeaconStatusPending:        BeaconEventRegistrationPending,
+	BeaconStatusRegistered:     BeaconEventRegistered,
+	BeaconStatusUnclaimed:      BeaconEventDeregistered,
+	BeaconStatusSuspended:      BeaconEventSuspended,
+	BeaconStatusDecommissioned: BeaconEventDecommissioned,
+}
+
+var ErrBeaconEventImmutable = errors.New("beacon events are append-only")
+
+type BeaconEventType struct {
+	EventType   string `gorm:"primary_key;size:30" json:"event_type"`
+	Description string `gorm:"size:255" json:"description"`
+}
+
+// BeaconEvent is an entry in a beacon's append-only event log
+type BeaconEvent struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	BeaconID       uint64    `gorm:"not null;index:idx_beacon_events_beacon_occurred" json:"beacon_id"`
+	EventType      string    `gorm:"size:30;not null" json:"event_type"`
+	OrganisationID uint64    `json:"organisation_id"`
+	Details        string    `gorm:"type:text" json:"details"`
+	OccurredAt     time.Time `gorm:"not null;index:idx_beacon_events_beacon_occurred" json:"occurred_at"`
+}
+
+// SeedBeaconEventTypes creates any event types missing from the database
+func SeedBeaconEventTypes(db *gorm.DB) error {
+	for i, _ := range beaconEventTypes {
+		eventType := beaconEventTypes[i]
+		err := db.Debug().Where(BeaconEventType{EventType: eventType.EventType}).FirstOrCreate(&eventType).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *BeaconEvent) BeforeUpdate() error {
+	return ErrBeaconEventImmutable
+}
+
+func (e *BeaconEvent) BeforeDelete() error {
+	return ErrBeaconEventImmutable
+}
+
+// RecordBeaconEvent appends an event to a beacon's log
+func RecordBeaconEvent(db *gorm.DB, beaconID, organisationID uint64, eventType, details string, occurredAt time.Time) error {
+	event := BeaconEvent{
+		BeaconID:       beaconID,
+		EventType:      eventType,
+		OrganisationID: organisationID,
+		Details:        details,
+		OccurredAt:     occurredAt,
+	}
+	return db.Debug().Model(&BeaconEvent{}).Create(&event).Error
+}
+
+// FindBeaconEvents returns the beacon's events in [from, to), newest first,
+// optionally restricted to the given event types
+func (e *BeaconEvent) FindBeaconEvents(db *gorm.DB, beaconID uint64, eventTypes []string, from, to time.Time) (*[]BeaconEvent, error) {
+	var events []BeaconEvent
+	query := db.Debug().Model(&BeaconEvent{}).
+		Where("beacon_id = ? AND occurred_at >= ? AND occurred_at < ?", beaconID, from, to)
+	if len(eventTypes) > 0 {
+		query = query.Where("event_type IN (?)", eventTypes)
+	}
+
+	err := query.Order("occurred_at desc, id desc").Limit(100).Find(&events).Error
+	if err != nil {
+		return &[]BeaconEvent{}, err
+	}
+	return &events, nil
+}
+
+// ValidateBeaconEventTypes checks a comma separated list of event types
+func ValidateBeaconEventTypes(list string) ([]string, error) {
+	var eventTypes []string
+	for _, eventType := range strings.Split(list, ",") {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" {
+			continue
+		}
+
+		known := false
+		for _, seeded := range beaconEventTypes {
+			known = known || seeded.EventType == eventType
+		}
+		if !known {
+			return nil, errors.New("unknown beacon event type " + eventType)
+		}
+		eventTypes = append(eventTypes, eventType)
+	}
+	return eventTypes, nil
+}
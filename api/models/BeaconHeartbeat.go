@@ -0,0 +1,123 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// DefaultOfflineThresholdMinutes applies to beacons that do not belong to an organisation
+const DefaultOfflineThresholdMinutes = 30
+
+// OfflineBeacon is a registered beacon that has not been heard within its organisation's threshold
+type OfflineBeacon struct {
+	Beacon        Beacon `json:"beacon"`
+	SilentSeconds *int64 `json:"silent_seconds"`
+	SilentFor     string `json:"silent_for"`
+}
+
+// MarkSeen records that the beacon was heard at the given time, bringing it back
+// online if it had been marked offline. LastUpdated is left alone as the beacon
+// itself has not been edited.
+func (b *Beacon) MarkSeen(db *gorm.DB, seenAt time.Time) error {
+	// sightings can arrive out of order, never move last seen backwards
+	newer := "id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)"
+
+	// a beacon heard for the first time was never online, so it has not come back
+	cameOnline := db.Debug().Model(&Beacon{}).Where(newer+" AND is_online = false AND last_seen_at IS NOT NULL", b.ID, seenAt).UpdateColumn("is_online", true)
+	if cameOnline.Error != nil {
+		return cameOnline.Error
+	}
+	if cameOnline.RowsAffected > 0 {
+		err := RecordBeaconEvent(db, b.ID, b.OrganisationID, BeaconEventOnline, "", seenAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	seen := db.Debug().Model(&Beacon{}).Where(newer, b.ID, seenAt).UpdateColumns(
+		map[string]interface{}{
+			"last_seen_at": seenAt,
+			"is_online":    true,
+		})
+	if seen.Error != nil {
+		return seen.Error
+	}
+
+	if seen.RowsAffected > 0 {
+		b.LastSeenAt = &seenAt
+		b.IsOnline = true
+	}
+	return nil
+}
+
+// MarkOfflineBeacons flags every online beacon that has been silent for longer
+// than its organisation's offline threshold, records an offline event for each
+// and returns how many were flagged
+func MarkOfflineBeacons(db *gorm.DB, now time.Time) (int64, error) {
+	rows, err := db.Debug().Raw(`
+		UPDATE beacons SET is_online = false
+		WHERE is_online = true
+		AND last_seen_at < ?::timestamptz - COALESCE(
+			(SELECT offline_threshold_minutes FROM organisations WHERE organisations.id = beacons.organisation_id),
+			?) * interval '1 minute'
+		RETURNING id, organisation_id, last_seen_at`, now, DefaultOfflineThresholdMinutes).Rows()
+	if err != nil {
+		return 0, err
+	}
+
+	type offlineBeacon struct {
+		id             uint64
+		organisationID uint64
+		lastSeenAt     time.Time
+	}
+	var marked []offlineBeacon
+	for rows.Next() {
+		beacon := offlineBeacon{}
+		err = rows.Scan(&beacon.id, &beacon.organisationID, &beacon.lastSeenAt)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		marked = append(marked, beacon)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, beacon := range marked {
+		details := "last seen " + beacon.lastSeenAt.Format(time.RFC3339)
+		err = RecordBeaconEvent(db, beacon.id, beacon.organisationID, BeaconEventOffline, details, now)
+		if err != nil {
+			return int64(len(marked)), err
+		}
+	}
+	return int64(len(marked)), nil
+}
+
+// FindOfflineBeacons lists the organisation's registered beacons that are offline,
+// longest silent first. Beacons that have never been heard are listed first.
+func (b *Beacon) FindOfflineBeacons(db *gorm.DB, organisationID uint64, now time.Time) (*[]OfflineBeacon, error) {
+	var beacons []Beacon
+	err := db.Debug().Model(&Beacon{}).
+		Where("organisation_id = ? AND status = ? AND is_online = false", organisationID, BeaconStatusRegistered).
+		Order("last_seen_at asc nulls first").
+		Limit(100).
+		Find(&beacons).Error
+	if err != nil {
+		return &[]OfflineBeacon{}, err
+	}
+
+	offline := make([]OfflineBeacon, len(beacons))
+	for i, beacon := range beacons {
+		offline[i] = OfflineBeacon{Beacon: beacon, SilentFor: "never seen"}
+		if beacon.LastSeenAt != nil {
+			silent := now.Sub(*beacon.LastSeenAt).Truncate(time.Second)
+			seconds := int64(silent.Seconds())
+			offline[i].SilentSeconds = &seconds
+			offline[i].SilentFor = silent.String()
+		}
+	}
+	return &offline, nil
+}
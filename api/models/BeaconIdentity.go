@@ -0,0 +1,139 @@
+package models
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// ErrBeaconIdentityTaken is returned when another beacon already broadcasts the
+// same iBeacon or Eddystone UID identity
+var ErrBeaconIdentityTaken = errors.New("broadcast identity already registered to another beacon")
+
+// CreateBeaconIdentityIndexes makes each iBeacon and Eddystone UID identity
+// unique among the beacons that have one. gorm cannot declare partial indexes,
+// so they are created here after migrating, replacing the plain indexes of old.
+func CreateBeaconIdentityIndexes(db *gorm.DB) error {
+	statements := []string{
+		"DROP INDEX IF EXISTS idx_beacons_ibeacon",
+		"DROP INDEX IF EXISTS idx_beacons_eddystone",
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_beacons_ibeacon_identity
+			ON beacons (ibeacon_uuid, ibeacon_major, ibeacon_minor) WHERE ibeacon_uuid <> ''`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_beacons_eddystone_identity
+			ON beacons (eddystone_namespace, eddystone_instance) WHERE eddystone_namespace <> ''`,
+	}
+	for _, statement := range statements {
+		err := db.Debug().Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBroadcastIdentity makes sure no beacon other than the one with the given
+// ID, which is 0 for a new beacon, broadcasts the same identity
+func (b *Beacon) checkBroadcastIdentity(db *gorm.DB, id uint64) error {
+	var conditions []string
+	var values []interface{}
+	if b.IBeaconUUID != "" {
+		conditions = append(conditions, "(ibeacon_uuid = ? AND ibeacon_major = ? AND ibeacon_minor = ?)")
+		values = append(values, b.IBeaconUUID, b.IBeaconMajor, b.IBeaconMinor)
+	}
+	if b.EddystoneNamespace != "" {
+		conditions = append(conditions, "(eddystone_namespace = ? AND eddystone_instance = ?)")
+		values = append(values, b.EddystoneNamespace, b.EddystoneInstance)
+	}
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	taken := 0
+	err := db.Debug().Model(&Beacon{}).
+		Where("id <> ?", id).
+		Where(strings.Join(conditions, " OR "), values...).
+		Count(&taken).Error
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrBeaconIdentityTaken
+	}
+	return nil
+}
+
+// normalizeBroadcastIdentity rewrites the iBeacon and Eddystone identifiers into
+// the same form the advertisement parser produces, so decoded frames match
+func (b *Beacon) normalizeBroadcastIdentity() error {
+	if b.IBeaconUUID != "" {
+		uuid, err := advertisement.NormalizeUUID(b.IBeaconUUID)
+		if err != nil {
+			return errors.New("invalid iBeacon UUID provided")
+		}
+		b.IBeaconUUID = uuid
+	}
+
+	b.EddystoneNamespace = strings.ToUpper(strings.TrimSpace(b.EddystoneNamespace))
+	b.EddystoneInstance = strings.ToUpper(strings.TrimSpace(b.EddystoneInstance))
+	if (b.EddystoneNamespace == "") != (b.EddystoneInstance == "") {
+		return errors.New("eddystone namespace and instance must be provided together")
+	}
+	if b.EddystoneNamespace != "" {
+		if _, err := hex.DecodeString(b.EddystoneNamespace); err != nil || len(b.EddystoneNamespace) != 20 {
+			return errors.New("invalid eddystone namespace provided")
+		}
+		if _, err := hex.DecodeString(b.EddystoneInstance); err != nil || len(b.EddystoneInstance) != 12 {
+			return errors.New("invalid eddystone instance provided")
+		}
+	}
+	return nil
+}
+
+// ResolveAdvertisement finds the beacon that broadcast a decoded advertisement,
+// trying its iBeacon identity, then its Eddystone UID, then its Eddystone EID as
+// of observedAt and finally the mac address the gateway heard it from, which may be empty
+func (b *Beacon) ResolveAdvertisement(db *gorm.DB, adv *advertisement.Advertisement, macAddress string, observedAt time.Time, eidWindow int) (*Beacon, error) {
+	if adv.IBeacon != nil {
+		err := db.Debug().Model(&Beacon{}).Where(
+			"ibeacon_uuid = ? AND ibeacon_major = ? AND ibeacon_minor = ?",
+			adv.IBeacon.UUID, adv.IBeacon.Major, adv.IBeacon.Minor,
+		).Take(&b).Error
+		if err == nil {
+			return b, nil
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+	}
+
+	if adv.EddystoneUID != nil {
+		err := db.Debug().Model(&Beacon{}).Where(
+			"eddystone_namespace = ? AND eddystone_instance = ?",
+			adv.EddystoneUID.Namespace, adv.EddystoneUID.Instance,
+		).Take(&b).Error
+		if err == nil {
+			return b, nil
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+	}
+
+	if adv.EddystoneEID != nil {
+		_, err := b.ResolveEphemeralID(db, adv.EddystoneEID.EphemeralID, observedAt, eidWindow)
+		if err == nil {
+			return b, nil
+		}
+		if err != ErrBeaconNotFound {
+			return nil, err
+		}
+	}
+
+	if macAddress != "" {
+		return b.FindBeaconByMacAddress(db, macAddress)
+	}
+	return nil, ErrBeaconNotFound
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Beacon lifecycle states
+const (
+	BeaconStatusUnclaimed      = "unclaimed"
+	BeaconStatusPending        = "pending"
+	BeaconStatusRegistered     = "registered"
+	BeaconStatusSuspended      = "suspended"
+	BeaconStatusDecommissioned = "decommissioned"
+)
+
+// beaconTransitions lists the states a beacon may move to from each state
+var beaconTransitions = map[string][]string{
+	BeaconStatusUnclaimed: {
+		BeaconStatusPending, BeaconStatusRegistered, BeaconStatusDecommissioned,
+	},
+	BeaconStatusPending: {
+		BeaconStatusRegistered, BeaconStatusUnclaimed, BeaconStatusDecommissioned,
+	},
+	BeaconStatusRegistered: {
+		BeaconStatusSuspended, BeaconStatusUnclaimed, BeaconStatusDecommissioned,
+	},
+	BeaconStatusSuspended: {
+		BeaconStatusRegistered, BeaconStatusUnclaimed, BeaconStatusDecommissioned,
+	},
+	BeaconStatusDecommissioned: {},
+}
+
+// ErrInvalidBeaconTransition is returned when a lifecycle change is not allowed from the beacon's current state
+var ErrInvalidBeaconTransition = errors.New("invalid beacon status transition")
+
+// BeaconStatusTransition records a single change in a beacon's lifecycle
+type BeaconStatusTransition struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	BeaconID       uint64    `gorm:"not null;index" json:"beacon_id"`
+	FromStatus     string    `gorm:"size:20; not null" json:"from_status"`
+	ToStatus       string    `gorm:"size:20; not null" json:"to_status"`
+	ActorID        uint32    `gorm:"not null" json:"actor_id"`
+	OrganisationID uint64    `json:"organisation_id"`
+	Reason         string    `gorm:"size:255" json:"reason"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// CanTransitionBeacon reports whether a beacon may move between the given states
+func CanTransitionBeacon(from, to string) bool {
+	if from == "" {
+		from = BeaconStatusUnclaimed
+	}
+	for _, allowed := range beaconTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterBeacon associates a beacon with an organisation. Registrations made by
+// anyone other than the organisation's administrator are left pending until the
+// administrator registers the beacon themselves. A registered beacon is given a
+// new check-in key, available on SecretKey.
+func (b *Beacon) RegisterBeacon(db *gorm.DB, organisation Organisation, actorID uint32, reason string) error {
+	if organisation.ID == 0 {
+		return errors.New("unable to change registration of unresolved organisation")
+	}
+	if b.OrganisationID != 0 && b.OrganisationID != organisation.ID {
+		return fmt.Errorf("%w: beacon belongs to another organisation", ErrInvalidBeaconTransition)
+	}
+
+	status := BeaconStatusPending
+	if organisation.AdministratorID == uint64(actorID) {
+		status = BeaconStatusRegistered
+	}
+	return b.changeBeaconRegistration(db, status, organisation.ID, actorID, reason)
+}
+
+// DeregisterBeacon releases a beacon from its organisation so it can be claimed again
+func (b *Beacon) DeregisterBeacon(db *gorm.DB, actorID uint32, reason string) error {
+	return b.changeBeaconRegistration(db, BeaconStatusUnclaimed, 0, actorID, reason)
+}
+
+// SuspendBeacon temporarily takes a registered beacon out of service
+func (b *Beacon) SuspendBeacon(db *gorm.DB, actorID uint32, reason string) error {
+	return b.changeBeaconRegistration(db, BeaconStatusSuspended, b.OrganisationID, actorID, reason)
+}
+
+// DecommissionBeacon permanently retires a beacon, no further transitions are possible
+func (b *Beacon) DecommissionBeacon(db *gorm.DB, actorID uint32, reason string) error {
+	return b.changeBeaconRegistration(db, BeaconStatusDecommissioned, 0, actorID, reason)
+}
+
+// FindBeaconHistory returns every lifecycle transition of the beacon, oldest first
+func (b *Beacon) FindBeaconHistory(db *gorm.DB) (*[]BeaconStatusTransition, error) {
+	var history []BeaconStatusTransition
+	err := db.Debug().Model(&BeaconStatusTransition{}).Where("beacon_id = ?", b.ID).Order("created_at asc, id asc").Find(&history).Error
+	if err != nil {
+		return &[]BeaconStatusTransition{}, err
+	}
+	return &history, nil
+}
+
+// RegisterImportedBeacon registers a newly created beacon, from a bulk import or
+// CreateBeacon, with its organisation, within the transaction that created it.
+// The caller has already checked the actor administers the organisation.
+func (b *Beacon) RegisterImportedBeacon(tx *gorm.DB, organisationID uint64, actorID uint32, reason string) error {
+	return b.applyBeaconRegistration(tx, BeaconStatusRegistered, organisationID, actorID, reason)
+}
+
+// changeBeaconRegistration moves a beacon to a new lifecycle state and records the
+// transition, both within a single transaction
+func (b *Beacon) changeBeaconRegistration(db *gorm.DB, to string, organisationID uint64, actorID uint32, reason string) error {
+	tx := db.Begin()
+	err := b.applyBeaconRegistration(tx, to, organisationID, actorID, reason)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// applyBeaconRegistration makes the lifecycle change of changeBeaconRegistration
+// within the given transaction
+func (b *Beacon) applyBeaconRegistration(tx *gorm.DB, to string, organisationID uint64, actorID uint32, reason string) error {
+	from := b.Status
+	if from == "" {
+		from = BeaconStatusUnclaimed
+	}
+	if !CanTransitionBeacon(from, to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidBeaconTransition, from, to)
+	}
+
+	// the transition is attributed to the organisation the beacon is joining, or leaving
+	transition := BeaconStatusTransition{
+		BeaconID:       b.ID,
+		FromStatus:     from,
+		ToStatus:       to,
+		ActorID:        actorID,
+		OrganisationID: organisationID,
+		Reason:         reason,
+		CreatedAt:      time.Now(),
+	}
+	if organisationID == 0 {
+		transition.OrganisationID = b.OrganisationID
+	}
+
+	leavingOrganisation := b.OrganisationID != organisationID
+
+	b.Status = to
+	b.IsRegistered = to == BeaconStatusRegistered
+	b.OrganisationID = organisationID
+	b.Organization = Organisation{}
+	if to == BeaconStatusRegistered && from != BeaconStatusSuspended {
+		b.RegisteredOn = time.Now()
+	}
+
+	err := b.UpdateBeacon(tx, b.ID)
+	if err != nil {
+		return err
+	}
+
+	// zones belong to an organisation, so the beacon loses its zone along with it
+	if leavingOrganisation && b.ZoneID != nil {
+		err = b.AssignBeaconToZone(tx, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// every registration provisions a fresh check-in signing key, so nobody who
+	// knew an earlier one can sign check-ins, and a beacon out of service has none
+	if to == BeaconStatusRegistered {
+		err = b.RotateSecretKey(tx)
+	} else if b.SecretKey != "" {
+		err = b.clearSecretKey(tx)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.Debug().Model(&BeaconStatusTransition{}).Create(&transition).Error
+	if err != nil {
+		return err
+	}
+
+	return RecordBeaconEvent(tx, b.ID, transition.OrganisationID, lifecycleEvents[to], reason, transition.CreatedAt)
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"math"
+)
+
+// earthRadiusMetres is the mean radius used for great-circle distances
+const earthRadiusMetres = 6371000.0
+
+// haversineSQL is the great-circle distance in metres from a beacon to the point
+// bound to its three placeholders: latitude, latitude again and longitude
+const haversineSQL = `2 * 6371000 * asin(sqrt(least(1,
+	power(sin(radians(beacons.latitude - ?) / 2), 2) +
+	cos(radians(?)) * cos(radians(beacons.latitude)) * power(sin(radians(beacons.longitude - ?) / 2), 2))))`
+
+var ErrInvalidCoordinates = errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+
+// NearbyBeacon is a beacon along with its distance from the queried point
+type NearbyBeacon struct {
+	Beacon
+	DistanceMetres float64 `json:"distance_metres"`
+}
+
+// BoundingBox is a latitude/longitude rectangle. A box whose MinLongitude is
+// greater than its MaxLongitude crosses the antimeridian.
+type BoundingBox struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// ValidCoordinates reports whether a latitude and longitude lie on the globe
+func ValidCoordinates(latitude, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
+
+// validatePlacement requires coordinates to be given as a pair and to be in range
+func (b *Beacon) validatePlacement() error {
+	if (b.Latitude == nil) != (b.Longitude == nil) {
+		return errors.New("latitude and longitude must be provided together")
+	}
+	if b.Latitude != nil && !ValidCoordinates(*b.Latitude, *b.Longitude) {
+		return ErrInvalidCoordinates
+	}
+	if b.TxPower != nil && (*b.TxPower < -100 || *b.TxPower > 20) {
+		return errors.New("tx power must be between -100 and 20 dBm")
+	}
+	return nil
+}
+
+func (box BoundingBox) validate() error {
+	if !ValidCoordinates(box.MinLatitude, box.MinLongitude) || !ValidCoordinates(box.MaxLatitude, box.MaxLongitude) {
+		return ErrInvalidCoordinates
+	}
+	if box.MinLatitude > box.MaxLatitude {
+		return errors.New("bounding box minimum latitude is above its maximum")
+	}
+	return nil
+}
+
+// where narrows a query to beacons placed inside the box
+func (box BoundingBox) where(db *gorm.DB) *gorm.DB {
+	db = db.Where("beacons.latitude BETWEEN ? AND ?", box.MinLatitude, box.MaxLatitude)
+	if box.MinLongitude > box.MaxLongitude {
+		return db.Where("(beacons.longitude >= ? OR beacons.longitude <= ?)", box.MinLongitude, box.MaxLongitude)
+	}
+	return db.Where("beacons.longitude BETWEEN ? AND ?", box.MinLongitude, box.MaxLongitude)
+}
+
+// boundingBoxAround is the smallest box holding every point within radiusMetres of
+// the given point, used to narrow a radius search before distances are computed
+func boundingBoxAround(latitude, longitude, radiusMetres float64) BoundingBox {
+	latitudeDelta := radiusMetres / earthRadiusMetres * 180 / math.Pi
+	box := BoundingBox{
+		MinLatitude:  math.Max(latitude-latitudeDelta, -90),
+		MaxLatitude:  math.Min(latitude+latitudeDelta, 90),
+		MinLongitude: -180,
+		MaxLongitude: 180,
+	}
+
+	// a circle reaching a pole covers every longitude
+	if box.MinLatitude > -90 && box.MaxLatitude < 90 {
+		longitudeDelta := latitudeDelta / math.Cos((math.Abs(latitude)+latitudeDelta)*math.Pi/180)
+		if longitudeDelta < 180 {
+			box.MinLongitude = wrapLongitude(longitude - longitudeDelta)
+			box.MaxLongitude = wrapLongitude(longitude + longitudeDelta)
+		}
+	}
+	return box
+}
+
+func wrapLongitude(longitude float64) float64 {
+	if longitude < -180 {
+		return longitude + 360
+	}
+	if longitude > 180 {
+		return longitude - 360
+	}
+	return longitude
+}
+
+// placedBeacons selects the placed beacons with their distance from a point,
+// optionally restricted to a floor
+func placedBeacons(db *gorm.DB, latitude, longitude float64, floor *int) *gorm.DB {
+	query := db.Debug().Table("beacons").
+		Select("beacons.*, "+haversineSQL+" AS distance_metres", latitude, latitude, longitude).
+		Where("beacons.latitude IS NOT NULL AND beacons.longitude IS NOT NULL")
+	if floor != nil {
+		query = query.Where("beacons.floor = ?", *floor)
+	}
+	return query
+}
+
+// FindBeaconsWithinRadius lists the beacons placed within radiusMetres of a point, nearest first
+func (b *Beacon) FindBeaconsWithinRadius(db *gorm.DB, latitude, longitude, radiusMetres float64, floor *int) (*[]NearbyBeacon, error) {
+	if !ValidCoordinates(latitude, longitude) {
+		return &[]NearbyBeacon{}, ErrInvalidCoordinates
+	}
+	if radiusMetres <= 0 {
+		return &[]NearbyBeacon{}, errors.New("radius must be greater than zero")
+	}
+
+	var beacons []NearbyBeacon
+	query := boundingBoxAround(latitude, longitude, radiusMetres).where(placedBeacons(db, latitude, longitude, floor))
+	err := query.Where(haversineSQL+" <= ?", latitude, latitude, longitude, radiusMetres).
+		Order("distance_metres").Limit(100).Find(&beacons).Error
+	if err != nil {
+		return &[]NearbyBeacon{}, err
+	}
+	return &beacons, nil
+}
+
+// FindBeaconsInBoundingBox lists the beacons placed inside a latitude/longitude rectangle
+func (b *Beacon) FindBeaconsInBoundingBox(db *gorm.DB, box BoundingBox, floor *int) (*[]Beacon, error) {
+	err := box.validate()
+	if err != nil {
+		return &[]Beacon{}, err
+	}
+
+	var beacons []Beacon
+	query := db.Debug().Model(&Beacon{}).Where("beacons.latitude IS NOT NULL AND beacons.longitude IS NOT NULL")
+	if floor != nil {
+		query = query.Where("beacons.floor = ?", *floor)
+	}
+	err = box.where(query).Order("beacons.id").Limit(100).Find(&beacons).Error
+	if err != nil {
+		return &[]Beacon{}, err
+	}
+	return &beacons, nil
+}
+
+// FindNearestBeacon finds the placed beacon closest to a point
+func (b *Beacon) FindNearestBeacon(db *gorm.DB, latitude, longitude float64, floor *int) (*NearbyBeacon, error) {
+	if !ValidCoordinates(latitude, longitude) {
+		return nil, ErrInvalidCoordinates
+	}
+
+	nearest := NearbyBeacon{}
+	err := placedBeacons(db, latitude, longitude, floor).Order("distance_metres").Take(&nearest).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrBeaconNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &nearest, nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Aggregation buckets supported by AggregateBeaconTelemetry
+const (
+	TelemetryBucketHour = "hour"
+	TelemetryBucketDay  = "day"
+)
+
+// BeaconTelemetry is a single telemetry sample reported by a beacon. Temperature
+// is nil when the beacon does not report it. OrganisationID is the organisation
+// that held the beacon when the sample was saved, and does not follow transfers.
+type BeaconTelemetry struct {
+	ID                 uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	BeaconID           uint64    `gorm:"not null;index:idx_beacon_telemetries_beacon_recorded" json:"beacon_id"`
+	OrganisationID     uint64    `gorm:"index" json:"organisation_id"`
+	BatteryMillivolts  uint16    `json:"battery_millivolts"`
+	Temperature        *float64  `json:"temperature"`
+	AdvertisementCount uint32    `json:"advertisement_count"`
+	UptimeDeciseconds  uint32    `json:"uptime_deciseconds"`
+	RecordedAt         time.Time `gorm:"not null;index:idx_beacon_telemetries_beacon_recorded" json:"recorded_at"`
+}
+
+// TelemetryBucket summarises the samples recorded within one hour or day
+type TelemetryBucket struct {
+	BucketStart           time.Time `json:"bucket_start"`
+	Samples               int       `json:"samples"`
+	BatteryMillivoltsMin  float64   `json:"battery_millivolts_min"`
+	BatteryMillivoltsAvg  float64   `json:"battery_millivolts_avg"`
+	BatteryMillivoltsMax  float64   `json:"battery_millivolts_max"`
+	TemperatureMin        *float64  `json:"temperature_min"`
+	TemperatureAvg        *float64  `json:"temperature_avg"`
+	TemperatureMax        *float64  `json:"temperature_max"`
+	AdvertisementCountMax float64   `json:"advertisement_count_max"`
+	UptimeDecisecondsMax  float64   `json:"uptime_deciseconds_max"`
+}
+
+// NewTelemetryFromTLM converts a decoded Eddystone TLM frame into a sample
+func NewTelemetryFromTLM(beaconID uint64, tlm *advertisement.EddystoneTLM, recordedAt time.Time) BeaconTelemetry {
+	return BeaconTelemetry{
+		BeaconID:           beaconID,
+		BatteryMillivolts:  tlm.BatteryMillivolts,
+		Temperature:        tlm.Temperature,
+		AdvertisementCount: tlm.AdvertisementCount,
+		UptimeDeciseconds:  tlm.UptimeDeciseconds,
+		RecordedAt:         recordedAt,
+	}
+}
+
+func (t *BeaconTelemetry) Validate() error {
+	if t.BeaconID == 0 {
+		return errors.New("Required Beacon")
+	}
+	if t.RecordedAt.IsZero() {
+		return errors.New("Required Recorded At")
+	}
+	if t.RecordedAt.After(time.Now().Add(time.Minute)) {
+		return errors.New("telemetry cannot be recorded in the future")
+	}
+	return nil
+}
+
+func (t *BeaconTelemetry) SaveTelemetry(db *gorm.DB) (*BeaconTelemetry, error) {
+	err := t.Validate()
+	if err != nil {
+		return &BeaconTelemetry{}, err
+	}
+
+	// battery_low is only raised when the battery first drops below the threshold
+	raiseBatteryLow := false
+	if t.BatteryMillivolts > 0 && t.BatteryMillivolts < BatteryLowMillivolts {
+		previous := BeaconTelemetry{}
+		err = db.Debug().Model(&BeaconTelemetry{}).
+			Where("beacon_id = ? AND recorded_at < ? AND battery_millivolts > 0", t.BeaconID, t.RecordedAt).
+			Order("recorded_at desc").
+			Take(&previous).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return &BeaconTelemetry{}, err
+		}
+		raiseBatteryLow = gorm.IsRecordNotFoundError(err) || previous.BatteryMillivolts >= BatteryLowMillivolts
+	}
+
+	beacon := Beacon{}
+	err = db.Debug().Model(&Beacon{}).Where("id = ?", t.BeaconID).Take(&beacon).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &BeaconTelemetry{}, ErrBeaconNotFound
+	}
+	if err != nil {
+		return &BeaconTelemetry{}, err
+	}
+	t.OrganisationID = beacon.OrganisationID
+
+	err = db.Debug().Model(&BeaconTelemetry{}).Create(&t).Error
+	if err != nil {
+		return &BeaconTelemetry{}, err
+	}
+
+	if raiseBatteryLow {
+		details := fmt.Sprintf("battery at %d mV", t.BatteryMillivolts)
+		err = RecordBeaconEvent(db, t.BeaconID, beacon.OrganisationID, BeaconEventBatteryLow, details, t.RecordedAt)
+		if err != nil {
+			return &BeaconTelemetry{}, err
+		}
+	}
+	return t, nil
+}
+
+// FindBeaconTelemetry returns the raw samples recorded in [from, to), oldest first.
+// A non-zero organisationID only returns the samples recorded while the beacon
+// belonged to it.
+func (t *BeaconTelemetry) FindBeaconTelemetry(db *gorm.DB, beaconID, organisationID uint64, from, to time.Time) (*[]BeaconTelemetry, error) {
+	var samples []BeaconTelemetry
+	query := db.Debug().Model(&BeaconTelemetry{}).
+		Where("beacon_id = ? AND recorded_at >= ? AND recorded_at < ?", beaconID, from, to)
+	if organisationID != 0 {
+		query = query.Where("organisation_id = ?", organisationID)
+	}
+	err := query.Order("recorded_at asc").
+		Limit(1000).
+		Find(&samples).Error
+	if err != nil {
+		return &[]BeaconTelemetry{}, err
+	}
+	return &samples, nil
+}
+
+// AggregateBeaconTelemetry summarises the samples recorded in [from, to) per hour
+// or per day. A non-zero organisationID only counts the samples recorded while the
+// beacon belonged to it.
+func (t *BeaconTelemetry) AggregateBeaconTelemetry(db *gorm.DB, beaconID, organisationID uint64, from, to time.Time, bucket string) (*[]TelemetryBucket, error) {
+	if bucket != TelemetryBucketHour && bucket != TelemetryBucketDay {
+		return &[]TelemetryBucket{}, errors.New("bucket must be hour or day")
+	}
+
+	buckets := []TelemetryBucket{}
+	err := db.Debug().Raw(`
+		SELECT date_trunc(?, recorded_at) AS bucket_start,
+			count(*) AS samples,
+			min(battery_millivolts) AS battery_millivolts_min,
+			avg(battery_millivolts) AS battery_millivolts_avg,
+			max(battery_millivolts) AS battery_millivolts_max,
+			min(temperature) AS temperature_min,
+			avg(temperature) AS temperature_avg,
+			max(temperature) AS temperature_max,
+			max(advertisement_count) AS advertisement_count_max,
+			max(uptime_deciseconds) AS uptime_deciseconds_max
+		FROM beacon_telemetries
+		WHERE beacon_id = ? AND recorded_at >= ? AND recorded_at < ?
+			AND (? = 0 OR organisation_id = ?)
+		GROUP BY 1
+		ORDER BY 1`, bucket, beaconID, from, to, organisationID, organisationID).Scan(&buckets).Error
+	if err != nil {
+		return &[]TelemetryBucket{}, err
+	}
+	return &buckets, nil
+}
@@ -0,0 +1,277 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Beacon transfer states
+const (
+	BeaconTransferPending   = "pending"
+	BeaconTransferAccepted  = "accepted"
+	BeaconTransferRejected  = "rejected"
+	BeaconTransferCancelled = "cancelled"
+	BeaconTransferExpired   = "expired"
+)
+
+// DefaultBeaconTransferTTL is how long a transfer waits for the receiving organisation
+const DefaultBeaconTransferTTL = 7 * 24 * time.Hour
+
+var ErrBeaconTransferNotFound = errors.New("beacon transfer not found")
+var ErrBeaconTransferNotPending = errors.New("beacon transfer is no longer pending")
+var ErrBeaconTransferInProgress = errors.New("beacon already has a pending transfer")
+
+// BeaconTransfer is a request to move a beacon from the organisation that holds
+// it to another, which only takes effect once the receiving organisation's
+// administrator accepts it
+type BeaconTransfer struct {
+	ID                 uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	BeaconID           uint64     `gorm:"not null;index" json:"beacon_id"`
+	FromOrganisationID uint64     `gorm:"not null;index" json:"from_organisation_id"`
+	ToOrganisationID   uint64     `gorm:"not null;index" json:"to_organisation_id"`
+	Status             string     `gorm:"size:20;not null;index" json:"status"`
+	RequestedByID      uint32     `gorm:"not null" json:"requested_by_id"`
+	RespondedByID      *uint32    `json:"responded_by_id"`
+	Reason             string     `gorm:"size:255" json:"reason"`
+	CreatedAt          time.Time  `json:"created_at"`
+	ExpiresAt          time.Time  `gorm:"not null" json:"expires_at"`
+	RespondedAt        *time.Time `json:"responded_at"`
+}
+
+// RequestBeaconTransfer asks the receiving organisation to take over the beacon.
+// The beacon stays with its current organisation until the transfer is accepted.
+func (b *Beacon) RequestBeaconTransfer(db *gorm.DB, toOrganisationID uint64, actorID uint32, reason string, ttl time.Duration) (*BeaconTransfer, error) {
+	if b.OrganisationID == 0 {
+		return nil, errors.New("only beacons belonging to an organisation can be transferred")
+	}
+	if b.OrganisationID == toOrganisationID {
+		return nil, errors.New("beacon already belongs to the organisation")
+	}
+	if b.Status == BeaconStatusDecommissioned {
+		return nil, fmt.Errorf("%w: decommissioned beacons cannot be transferred", ErrInvalidBeaconTransition)
+	}
+	if ttl <= 0 {
+		ttl = DefaultBeaconTransferTTL
+	}
+
+	_, err := (&Organisation{}).FindOrganisationByID(db, toOrganisationID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = ExpireBeaconTransfers(db, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// the beacon row is locked so concurrent requests cannot both see no pending transfer
+	tx := db.Begin()
+	locked := Beacon{}
+	err = tx.Debug().Model(&Beacon{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", b.ID).Take(&locked).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, ErrBeaconNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if locked.OrganisationID != b.OrganisationID || locked.Status == BeaconStatusDecommissioned {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: beacon changed while the transfer was requested", ErrInvalidBeaconTransition)
+	}
+
+	var pending int
+	err = tx.Debug().Model(&BeaconTransfer{}).Where("beacon_id = ? AND status = ?", b.ID, BeaconTransferPending).Count(&pending).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if pending > 0 {
+		tx.Rollback()
+		return nil, ErrBeaconTransferInProgress
+	}
+
+	transfer := BeaconTransfer{
+		BeaconID:           b.ID,
+		FromOrganisationID: b.OrganisationID,
+		ToOrganisationID:   toOrganisationID,
+		Status:             BeaconTransferPending,
+		RequestedByID:      actorID,
+		Reason:             reason,
+		CreatedAt:          now,
+		ExpiresAt:          now.Add(ttl),
+	}
+	err = tx.Debug().Model(&BeaconTransfer{}).Create(&transfer).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	details := fmt.Sprintf("transfer %d to organisation %d requested", transfer.ID, toOrganisationID)
+	err = RecordBeaconEvent(tx, b.ID, b.OrganisationID, BeaconEventTransferRequested, details, now)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (t *BeaconTransfer) FindBeaconTransferByID(db *gorm.DB, id uint64) (*BeaconTransfer, error) {
+	err := db.Debug().Model(&BeaconTransfer{}).Where("id = ?", id).Take(&t).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrBeaconTransferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// transfers past their expiry read as expired even before the sweep runs
+	if t.Status == BeaconTransferPending && !time.Now().Before(t.ExpiresAt) {
+		t.Status = BeaconTransferExpired
+	}
+	return t, nil
+}
+
+// FindOrganisationBeaconTransfers lists the transfers an organisation is sending
+// or receiving, newest first, optionally restricted to one status
+func (t *BeaconTransfer) FindOrganisationBeaconTransfers(db *gorm.DB, organisationID uint64, status string) (*[]BeaconTransfer, error) {
+	_, err := ExpireBeaconTransfers(db, time.Now())
+	if err != nil {
+		return &[]BeaconTransfer{}, err
+	}
+
+	var transfers []BeaconTransfer
+	query := db.Debug().Model(&BeaconTransfer{}).Where("from_organisation_id = ? OR to_organisation_id = ?", organisationID, organisationID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Order("created_at desc, id desc").Limit(100).Find(&transfers).Error
+	if err != nil {
+		return &[]BeaconTransfer{}, err
+	}
+	return &transfers, nil
+}
+
+// AcceptBeaconTransfer moves the beacon to the receiving organisation. History
+// recorded before now stays attributed to the organisation that held the beacon.
+func (t *BeaconTransfer) AcceptBeaconTransfer(db *gorm.DB, actorID uint32) (*Beacon, error) {
+	now := time.Now()
+	tx := db.Begin()
+
+	err := t.respond(tx, BeaconTransferAccepted, actorID, now)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	beacon := Beacon{}
+	err = tx.Debug().Model(&Beacon{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", t.BeaconID).Take(&beacon).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if beacon.OrganisationID != t.FromOrganisationID || beacon.Status == BeaconStatusDecommissioned {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: beacon has left organisation %d since the transfer was requested", ErrBeaconTransferNotPending, t.FromOrganisationID)
+	}
+
+	err = tx.Debug().Model(&Beacon{}).Where("id = ?", beacon.ID).UpdateColumns(
+		map[string]interface{}{
+			"organisation_id": t.ToOrganisationID,
+			"zone_id":         nil,
+			"last_updated":    now,
+		}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	beacon.OrganisationID = t.ToOrganisationID
+	beacon.ZoneID = nil
+
+	// the previous owner knew the check-in key, so the new owner gets a fresh one
+	if beacon.SecretKey != "" {
+		err = beacon.RotateSecretKey(tx)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	transition := BeaconStatusTransition{
+		BeaconID:       beacon.ID,
+		FromStatus:     beacon.Status,
+		ToStatus:       beacon.Status,
+		ActorID:        actorID,
+		OrganisationID: t.ToOrganisationID,
+		Reason:         fmt.Sprintf("transferred from organisation %d", t.FromOrganisationID),
+		CreatedAt:      now,
+	}
+	err = tx.Debug().Model(&BeaconStatusTransition{}).Create(&transition).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	details := fmt.Sprintf("transfer %d from organisation %d", t.ID, t.FromOrganisationID)
+	err = RecordBeaconEvent(tx, beacon.ID, t.ToOrganisationID, BeaconEventTransferred, details, now)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+	return &beacon, nil
+}
+
+// RejectBeaconTransfer declines the transfer on behalf of the receiving organisation
+func (t *BeaconTransfer) RejectBeaconTransfer(db *gorm.DB, actorID uint32) error {
+	return t.respond(db, BeaconTransferRejected, actorID, time.Now())
+}
+
+// CancelBeaconTransfer withdraws the transfer on behalf of the sending organisation
+func (t *BeaconTransfer) CancelBeaconTransfer(db *gorm.DB, actorID uint32) error {
+	return t.respond(db, BeaconTransferCancelled, actorID, time.Now())
+}
+
+// respond closes a pending transfer. The status check is part of the update so
+// two responses racing each other cannot both succeed.
+func (t *BeaconTransfer) respond(db *gorm.DB, status string, actorID uint32, now time.Time) error {
+	result := db.Debug().Model(&BeaconTransfer{}).
+		Where("id = ? AND status = ? AND expires_at > ?", t.ID, BeaconTransferPending, now).
+		UpdateColumns(map[string]interface{}{
+			"status":          status,
+			"responded_by_id": actorID,
+			"responded_at":    now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBeaconTransferNotPending
+	}
+
+	t.Status = status
+	t.RespondedByID = &actorID
+	t.RespondedAt = &now
+	return nil
+}
+
+// ExpireBeaconTransfers closes every pending transfer whose expiry has passed
+func ExpireBeaconTransfers(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Debug().Model(&BeaconTransfer{}).
+		Where("status = ? AND expires_at <= ?", BeaconTransferPending, now).
+		UpdateColumn("status", BeaconTransferExpired)
+	return result.RowsAffected, result.Error
+}
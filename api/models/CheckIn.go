@@ -0,0 +1,183 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// DefaultCheckInPageSize and MaxCheckInPageSize bound how many check-ins a page returns
+const (
+	DefaultCheckInPageSize = 100
+	MaxCheckInPageSize     = 500
+)
+
+// DefaultCheckInDedupeWindow is how close together check-ins of a PUC to the same
+// beacon are treated as one unless configured otherwise
+const DefaultCheckInDedupeWindow = time.Minute
+
+// MaxIdempotencyKeyLength bounds the idempotency key a check-in may carry
+const MaxIdempotencyKeyLength = 128
+
+var ErrCheckInImmutable = errors.New("check-ins are append-only")
+var ErrIdempotencyKeyReused = errors.New("idempotency key has already been used for a different check-in")
+
+// CheckIn is an immutable record of a PUC checking in to a beacon. The beacon's
+// organisation and zone and the user holding the PUC are captured as they were
+// at the time.
+type CheckIn struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	PucID          uint64    `gorm:"not null;index:idx_check_ins_puc_checked_in" json:"puc_id"`
+	BeaconID       uint64    `gorm:"not null;index:idx_check_ins_beacon_checked_in" json:"beacon_id"`
+	OrganisationID uint64    `gorm:"index" json:"organisation_id"`
+	ZoneID         *uint64   `json:"zone_id"`
+	UserID         *uint32   `gorm:"index" json:"user_id"`
+	RSSI           *int      `gorm:"column:rssi" json:"rssi"`
+	IdempotencyKey *string   `gorm:"size:128;unique_index:idx_check_ins_idempotency_key" json:"idempotency_key,omitempty"`
+	CheckedInAt    time.Time `gorm:"not null;index:idx_check_ins_puc_checked_in,idx_check_ins_beacon_checked_in,idx_check_ins_checked_in" json:"checked_in_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CheckInDedupe controls when a check-in repeats one already recorded. A check-in
+// carrying an IdempotencyKey that was seen before is a retry, and one of the same
+// PUC to the same beacon within Window of a recorded check-in is the same visit
+// heard again. A zero Window only de-duplicates by key.
+type CheckInDedupe struct {
+	IdempotencyKey string
+	Window         time.Duration
+}
+
+// CheckInPage selects a page of check-ins in [From, To), newest first. The next
+// page starts at the last check-in returned, passing its time as To and its ID
+// as BeforeID so check-ins sharing a timestamp are not skipped. Access narrows
+// it to the check-ins the reader may see.
+type CheckInPage struct {
+	From     time.Time
+	To       time.Time
+	BeforeID uint64
+	Limit    int
+	Access   PucAccess
+	// OrganisationID, when set, only returns the check-ins made while the beacon
+	// belonged to it
+	OrganisationID uint64
+}
+
+// PucAccess narrows a PUC's history to what a reader may see: the records
+// credited to UserID, and those at the beacons of OrganisationIDs. The zero value
+// is unrestricted.
+type PucAccess struct {
+	Restricted      bool
+	UserID          uint32
+	OrganisationIDs []uint64
+}
+
+// apply limits a query on a table with user_id and organisation_id columns to
+// the records the reader may see
+func (a PucAccess) apply(query *gorm.DB, table string) *gorm.DB {
+	if !a.Restricted {
+		return query
+	}
+	if len(a.OrganisationIDs) == 0 {
+		return query.Where(table+".user_id = ?", a.UserID)
+	}
+	return query.Where("("+table+".user_id = ? OR "+table+".organisation_id IN (?))", a.UserID, a.OrganisationIDs)
+}
+
+func (c *CheckIn) BeforeUpdate() error {
+	return ErrCheckInImmutable
+}
+
+func (c *CheckIn) BeforeDelete() error {
+	return ErrCheckInImmutable
+}
+
+// FindCheckInByIdempotencyKey returns the check-in recorded with the key, or nil
+// when there is none
+func FindCheckInByIdempotencyKey(db *gorm.DB, key string) (*CheckIn, error) {
+	checkIn := CheckIn{}
+	err := db.Debug().Model(&CheckIn{}).Where("idempotency_key = ?", key).Take(&checkIn).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &checkIn, nil
+}
+
+// findDuplicateCheckIn returns the recorded check-in that the new one repeats, or
+// nil when it is new. A key used for another PUC or beacon is an error.
+func findDuplicateCheckIn(db *gorm.DB, checkIn CheckIn, dedupe CheckInDedupe) (*CheckIn, error) {
+	if dedupe.IdempotencyKey != "" {
+		existing, err := FindCheckInByIdempotencyKey(db, dedupe.IdempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if existing.PucID != checkIn.PucID || existing.BeaconID != checkIn.BeaconID {
+				return nil, ErrIdempotencyKeyReused
+			}
+			return existing, nil
+		}
+	}
+
+	if dedupe.Window <= 0 {
+		return nil, nil
+	}
+	existing := CheckIn{}
+	err := db.Debug().Model(&CheckIn{}).
+		Where("puc_id = ? AND beacon_id = ? AND checked_in_at > ? AND checked_in_at < ?",
+			checkIn.PucID, checkIn.BeaconID, checkIn.CheckedInAt.Add(-dedupe.Window), checkIn.CheckedInAt.Add(dedupe.Window)).
+		Order("checked_in_at desc").Take(&existing).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// isIdempotencyKeyConflict reports whether an insert failed because a concurrent
+// check-in took the same key
+func isIdempotencyKeyConflict(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "idx_check_ins_idempotency_key")
+}
+
+// FindPucCheckIns returns a page of the beacons a PUC checked in to
+func FindPucCheckIns(db *gorm.DB, pucID uint64, page CheckInPage) (*[]CheckIn, error) {
+	return findCheckIns(db, "puc_id", pucID, page)
+}
+
+// FindBeaconCheckIns returns a page of the PUCs that checked in to a beacon
+func FindBeaconCheckIns(db *gorm.DB, beaconID uint64, page CheckInPage) (*[]CheckIn, error) {
+	return findCheckIns(db, "beacon_id", beaconID, page)
+}
+
+func findCheckIns(db *gorm.DB, column string, id uint64, page CheckInPage) (*[]CheckIn, error) {
+	if page.Limit <= 0 {
+		page.Limit = DefaultCheckInPageSize
+	}
+	if page.Limit > MaxCheckInPageSize {
+		page.Limit = MaxCheckInPageSize
+	}
+
+	query := db.Debug().Model(&CheckIn{}).Where(column+" = ? AND checked_in_at >= ?", id, page.From)
+	query = page.Access.apply(query, "check_ins")
+	if page.OrganisationID != 0 {
+		query = query.Where("organisation_id = ?", page.OrganisationID)
+	}
+	if page.BeforeID > 0 {
+		query = query.Where("checked_in_at < ? OR (checked_in_at = ? AND id < ?)", page.To, page.To, page.BeforeID)
+	} else {
+		query = query.Where("checked_in_at < ?", page.To)
+	}
+
+	var checkIns []CheckIn
+	err := query.Order("checked_in_at desc, id desc").Limit(page.Limit).Find(&checkIns).Error
+	if err != nil {
+		return &[]CheckIn{}, err
+	}
+	return &checkIns, nil
+}
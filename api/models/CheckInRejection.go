@@ -0,0 +1,60 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// CheckInRejectionWindow is the period rejected check-ins are counted over
+const CheckInRejectionWindow = time.Hour
+
+// checkInRejectionReasonSize bounds the stored reason
+const checkInRejectionReasonSize = 100
+
+// CheckInRejection counts the check-ins a beacon rejected for one reason within
+// one window. Check-ins arrive unauthenticated, so rejections are counted
+// rather than each written to the event log, which keeps what a flood of forged
+// check-ins can store bounded and leaves the beacon free to be deleted.
+type CheckInRejection struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	BeaconID       uint64    `gorm:"not null;unique_index:idx_check_in_rejections_window" json:"beacon_id"`
+	OrganisationID uint64    `gorm:"not null;unique_index:idx_check_in_rejections_window" json:"organisation_id"`
+	Reason         string    `gorm:"size:100;not null;unique_index:idx_check_in_rejections_window" json:"reason"`
+	WindowStart    time.Time `gorm:"not null;unique_index:idx_check_in_rejections_window" json:"window_start"`
+	Attempts       int       `gorm:"not null" json:"attempts"`
+	LastPucID      uint64    `gorm:"not null" json:"last_puc_id"`
+	LastAttemptAt  time.Time `gorm:"not null" json:"last_attempt_at"`
+}
+
+// RecordCheckInRejection counts a rejected check-in against the beacon's current window
+func RecordCheckInRejection(db *gorm.DB, beaconID, organisationID uint64, reason string, pucID uint64, at time.Time) error {
+	if len(reason) > checkInRejectionReasonSize {
+		reason = reason[:checkInRejectionReasonSize]
+	}
+	at = at.UTC()
+
+	return db.Debug().Exec(`INSERT INTO check_in_rejections
+		(beacon_id, organisation_id, reason, window_start, attempts, last_puc_id, last_attempt_at)
+		VALUES (?, ?, ?, ?, 1, ?, ?)
+		ON CONFLICT (beacon_id, organisation_id, reason, window_start) DO UPDATE SET
+		attempts = check_in_rejections.attempts + 1,
+		last_puc_id = EXCLUDED.last_puc_id,
+		last_attempt_at = GREATEST(check_in_rejections.last_attempt_at, EXCLUDED.last_attempt_at)`,
+		beaconID, organisationID, reason, at.Truncate(CheckInRejectionWindow), pucID, at).Error
+}
+
+// FindCheckInRejections returns the rejected check-in counts recorded while the
+// beacon belonged to the organisation, for the windows overlapping [from, to),
+// newest first
+func FindCheckInRejections(db *gorm.DB, beaconID, organisationID uint64, from, to time.Time) (*[]CheckInRejection, error) {
+	var rejections []CheckInRejection
+	err := db.Debug().Model(&CheckInRejection{}).
+		Where("beacon_id = ? AND organisation_id = ? AND window_start >= ? AND window_start < ?",
+			beaconID, organisationID, from.UTC().Truncate(CheckInRejectionWindow), to).
+		Order("window_start desc, reason asc").
+		Find(&rejections).Error
+	if err != nil {
+		return &[]CheckInRejection{}, err
+	}
+	return &rejections, nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/visits"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"time"
+)
+
+var ErrContactSubjectRequired = errors.New("exactly one of puc_id or user_id is required")
+
+// ContactQuery asks who was present at the same places as a PUC, or as any PUC
+// held by a user, within [From, To). Scope is the granularity presence is
+// compared at, a beacon for close contact or the organisation for the whole venue.
+// A visit ends at its last check-in, but the PUC is taken to be present for
+// Timeout after it, the inactivity timeout the visits were computed with.
+type ContactQuery struct {
+	OrganisationID uint64
+	PucID          uint64
+	UserID         uint32
+	Scope          string
+	From           time.Time
+	To             time.Time
+	MinOverlap     time.Duration
+	Timeout        time.Duration
+}
+
+// Encounter is a stretch of time a contact was present at the same place as the
+// subject, clipped to the query window
+type Encounter struct {
+	Scope          string    `json:"scope"`
+	ScopeID        uint64    `json:"scope_id"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	OverlapSeconds int64     `json:"overlap_seconds"`
+}
+
+// Contact is a PUC that was present at the same place as the subject. UserID is
+// whoever held the PUC when it checked in.
+type Contact struct {
+	PucID          uint64      `json:"puc_id"`
+	UserID         *uint32     `json:"user_id"`
+	OverlapSeconds int64       `json:"overlap_seconds"`
+	FirstContact   time.Time   `json:"first_contact"`
+	LastContact    time.Time   `json:"last_contact"`
+	Encounters     []Encounter `json:"encounters"`
+}
+
+type overlappingVisit struct {
+	PucID        uint64
+	UserID       *uint32
+	ScopeID      uint64
+	OverlapStart time.Time
+	OverlapEnd   time.Time
+}
+
+// FindContacts returns every other PUC whose visits overlapped the subject's at
+// the query's scope within the organisation, most overlap first. Contacts whose
+// total overlap is below MinOverlap are left out.
+func FindContacts(db *gorm.DB, query ContactQuery) (*[]Contact, error) {
+	if (query.PucID == 0) == (query.UserID == 0) {
+		return &[]Contact{}, ErrContactSubjectRequired
+	}
+	if query.Scope == "" {
+		query.Scope = visits.ScopeBeacon
+	}
+	if query.Timeout <= 0 {
+		query.Timeout = DefaultVisitInactivityTimeout
+	}
+	timeout := query.Timeout.Seconds()
+
+	subject, subjectID := "source.puc_id = ?", interface{}(query.PucID)
+	if query.UserID != 0 {
+		// the user's own PUCs are not contacts of theirs
+		subject = "source.user_id = ? AND (other.user_id IS NULL OR other.user_id <> source.user_id)"
+		subjectID = query.UserID
+	}
+
+	var overlaps []overlappingVisit
+	err := db.Debug().Table("visits source").
+		Select(`other.puc_id, other.user_id, source.scope_id,
+			GREATEST(source.entered_at, other.entered_at, ?) AS overlap_start,
+			LEAST(source.exited_at + make_interval(secs => ?), other.exited_at + make_interval(secs => ?), ?) AS overlap_end`,
+			query.From, timeout, timeout, query.To).
+		Joins(`JOIN visits other ON other.scope = source.scope AND other.scope_id = source.scope_id
+			AND other.puc_id <> source.puc_id
+			AND other.entered_at < source.exited_at + make_interval(secs => ?)
+			AND other.exited_at + make_interval(secs => ?) > source.entered_at`, timeout, timeout).
+		Where("source.organisation_id = ? AND source.scope = ?", query.OrganisationID, query.Scope).
+		Where("source.entered_at < ? AND source.exited_at + make_interval(secs => ?) > ?", query.To, timeout, query.From).
+		Where("other.entered_at < ? AND other.exited_at + make_interval(secs => ?) > ?", query.To, timeout, query.From).
+		Where(subject, subjectID).
+		Order("overlap_start asc").
+		Scan(&overlaps).Error
+	if err != nil {
+		return &[]Contact{}, err
+	}
+
+	byPuc := map[uint64]*Contact{}
+	var order []uint64
+	for _, overlap := range overlaps {
+		contact, ok := byPuc[overlap.PucID]
+		if !ok {
+			contact = &Contact{PucID: overlap.PucID, FirstContact: overlap.OverlapStart}
+			byPuc[overlap.PucID] = contact
+			order = append(order, overlap.PucID)
+		}
+		// the most recent holder is the one to contact
+		if overlap.UserID != nil {
+			contact.UserID = overlap.UserID
+		}
+
+		seconds := int64(overlap.OverlapEnd.Sub(overlap.OverlapStart) / time.Second)
+		contact.OverlapSeconds += seconds
+		if overlap.OverlapEnd.After(contact.LastContact) {
+			contact.LastContact = overlap.OverlapEnd
+		}
+		contact.Encounters = append(contact.Encounters, Encounter{
+			Scope:          query.Scope,
+			ScopeID:        overlap.ScopeID,
+			Start:          overlap.OverlapStart,
+			End:            overlap.OverlapEnd,
+			OverlapSeconds: seconds,
+		})
+	}
+
+	contacts := []Contact{}
+	for _, pucID := range order {
+		contact := byPuc[pucID]
+		if time.Duration(contact.OverlapSeconds)*time.Second < query.MinOverlap {
+			continue
+		}
+		contacts = append(contacts, *contact)
+	}
+	sort.SliceStable(contacts, func(i, j int) bool {
+		return contacts[i].OverlapSeconds > contacts[j].OverlapSeconds
+	})
+	return &contacts, nil
+}
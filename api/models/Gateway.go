@@ -0,0 +1,125 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// gatewayKeyBytes of randomness in every gateway key
+const gatewayKeyBytes = 32
+
+// ErrInvalidGatewayKey does not say whether a key was unknown or revoked
+var ErrInvalidGatewayKey = errors.New("invalid gateway key")
+
+// ErrGatewayNotFound is returned by lookups against a gateway ID that does not exist
+var ErrGatewayNotFound = errors.New("gateway not found")
+
+// Gateway is a credential a gateway uses to report sightings for one
+// organisation. Only a hash of the key is stored.
+type Gateway struct {
+	ID             uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	OrganisationID uint64     `gorm:"not null;index" json:"organisation_id"`
+	Name           string     `gorm:"size:100;not null" json:"name"`
+	KeyHash        string     `gorm:"size:64;not null;unique_index" json:"-"`
+	Key            string     `gorm:"-" json:"key,omitempty"`
+	CreatedByID    uint32     `gorm:"not null" json:"created_by_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+}
+
+func hashGatewayKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateGateway issues a new gateway key for the organisation. The plain key is
+// only available on the returned value.
+func CreateGateway(db *gorm.DB, organisationID uint64, name string, actorID uint32) (*Gateway, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("Required Name")
+	}
+
+	random := make([]byte, gatewayKeyBytes)
+	_, err := rand.Read(random)
+	if err != nil {
+		return nil, err
+	}
+	key := hex.EncodeToString(random)
+
+	gateway := Gateway{
+		OrganisationID: organisationID,
+		Name:           name,
+		KeyHash:        hashGatewayKey(key),
+		CreatedByID:    actorID,
+	}
+	err = db.Debug().Model(&Gateway{}).Create(&gateway).Error
+	if err != nil {
+		return nil, err
+	}
+	gateway.Key = key
+	return &gateway, nil
+}
+
+// FindGatewayByKey looks up the gateway a key belongs to, as long as it has not been revoked
+func FindGatewayByKey(db *gorm.DB, key string) (*Gateway, error) {
+	if key == "" {
+		return nil, ErrInvalidGatewayKey
+	}
+
+	gateway := Gateway{}
+	err := db.Debug().Model(&Gateway{}).
+		Where("key_hash = ? AND revoked_at IS NULL", hashGatewayKey(key)).
+		Take(&gateway).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrInvalidGatewayKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &gateway, nil
+}
+
+// FindOrganisationGateways lists the organisation's gateways, newest first
+func FindOrganisationGateways(db *gorm.DB, organisationID uint64) (*[]Gateway, error) {
+	gateways := []Gateway{}
+	err := db.Debug().Model(&Gateway{}).
+		Where("organisation_id = ?", organisationID).
+		Order("created_at desc, id desc").
+		Find(&gateways).Error
+	if err != nil {
+		return &[]Gateway{}, err
+	}
+	return &gateways, nil
+}
+
+func (g *Gateway) FindGatewayByID(db *gorm.DB, id uint64) (*Gateway, error) {
+	err := db.Debug().Model(&Gateway{}).Where("id = ?", id).Take(&g).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrGatewayNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// RevokeGateway stops the gateway's key from being accepted
+func (g *Gateway) RevokeGateway(db *gorm.DB) error {
+	if g.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	err := db.Debug().Model(&Gateway{}).Where("id = ?", g.ID).UpdateColumn("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	g.RevokedAt = &now
+	return nil
+}
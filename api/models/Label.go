@@ -0,0 +1,125 @@
+package models
+
+import (
+	"github.com/SherbazHashmi/goblog/api/labels"
+	"github.com/jinzhu/gorm"
+)
+
+// Kinds of resource that can carry labels
+const (
+	LabelResourceBeacon = "beacon"
+	LabelResourcePuc    = "puc"
+)
+
+// Label is a key/value tag on a beacon or PUC. Selectors are evaluated against the
+// (resource_type, key, value) index rather than by loading every resource.
+type Label struct {
+	ID           uint64 `gorm:"primary_key;auto_increment" json:"-"`
+	ResourceType string `gorm:"size:10;not null;unique_index:idx_labels_resource_key;index:idx_labels_lookup" json:"-"`
+	ResourceID   uint64 `gorm:"not null;unique_index:idx_labels_resource_key" json:"-"`
+	Key          string `gorm:"size:63;not null;unique_index:idx_labels_resource_key;index:idx_labels_lookup" json:"key"`
+	Value        string `gorm:"size:63;not null;index:idx_labels_lookup" json:"value"`
+}
+
+// SetLabels replaces every label of a resource with the given set
+func SetLabels(db *gorm.DB, resourceType string, resourceID uint64, set map[string]string) error {
+	err := labels.Validate(set)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	err = tx.Debug().Where("resource_type = ? AND resource_id = ?", resourceType, resourceID).Delete(&Label{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for key, value := range set {
+		label := Label{ResourceType: resourceType, ResourceID: resourceID, Key: key, Value: value}
+		err = tx.Debug().Create(&label).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// FindLabels loads the labels of several resources at once, keyed by resource ID.
+// Resources without labels get an empty set.
+func FindLabels(db *gorm.DB, resourceType string, resourceIDs []uint64) (map[uint64]map[string]string, error) {
+	sets := make(map[uint64]map[string]string, len(resourceIDs))
+	for _, id := range resourceIDs {
+		sets[id] = map[string]string{}
+	}
+	if len(resourceIDs) == 0 {
+		return sets, nil
+	}
+
+	var found []Label
+	err := db.Debug().Where("resource_type = ? AND resource_id IN (?)", resourceType, resourceIDs).Find(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range found {
+		sets[label.ResourceID][label.Key] = label.Value
+	}
+	return sets, nil
+}
+
+// whereLabelsMatch narrows a query over a resource table to the rows whose labels
+// satisfy the selector. idColumn is the qualified primary key of that table.
+func whereLabelsMatch(db *gorm.DB, resourceType, idColumn string, selector labels.Selector) *gorm.DB {
+	labelled := "EXISTS (SELECT 1 FROM labels WHERE labels.resource_type = ? AND labels.resource_id = " + idColumn + " AND labels.key = ?"
+	for _, requirement := range selector {
+		switch requirement.Operator {
+		case labels.Exists:
+			db = db.Where(labelled+")", resourceType, requirement.Key)
+		case labels.DoesNotExist:
+			db = db.Where("NOT "+labelled+")", resourceType, requirement.Key)
+		case labels.Equals, labels.In:
+			db = db.Where(labelled+" AND labels.value IN (?))", resourceType, requirement.Key, requirement.Values)
+		case labels.NotEquals, labels.NotIn:
+			db = db.Where("NOT "+labelled+" AND labels.value IN (?))", resourceType, requirement.Key, requirement.Values)
+		}
+	}
+	return db
+}
+
+// attachBeaconLabels fills in the labels of each beacon
+func attachBeaconLabels(db *gorm.DB, beacons []Beacon) error {
+	ids := make([]uint64, len(beacons))
+	for i, _ := range beacons {
+		ids[i] = beacons[i].ID
+	}
+
+	sets, err := FindLabels(db, LabelResourceBeacon, ids)
+	if err != nil {
+		return err
+	}
+	for i, _ := range beacons {
+		beacons[i].Labels = sets[beacons[i].ID]
+	}
+	return nil
+}
+
+// SetBeaconLabels replaces the beacon's labels
+func (b *Beacon) SetBeaconLabels(db *gorm.DB, set map[string]string) error {
+	err := SetLabels(db, LabelResourceBeacon, b.ID, set)
+	if err != nil {
+		return err
+	}
+	b.Labels = set
+	return nil
+}
+
+// SetPucLabels replaces the PUC's labels
+func (p *Puc) SetPucLabels(db *gorm.DB, set map[string]string) error {
+	err := SetLabels(db, LabelResourcePuc, p.ID, set)
+	if err != nil {
+		return err
+	}
+	p.Labels = set
+	return nil
+}
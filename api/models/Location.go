@@ -0,0 +1,305 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"html"
+	"strings"
+	"time"
+)
+
+// Kinds of location, each nested directly under the one before it
+const (
+	LocationKindSite     = "site"
+	LocationKindBuilding = "building"
+	LocationKindFloor    = "floor"
+	LocationKindZone     = "zone"
+)
+
+// locationParentKinds maps each kind of location to the kind it must be nested
+// under, sites sit directly under the organisation
+var locationParentKinds = map[string]string{
+	LocationKindSite:     "",
+	LocationKindBuilding: LocationKindSite,
+	LocationKindFloor:    LocationKindBuilding,
+	LocationKindZone:     LocationKindFloor,
+}
+
+var ErrLocationNotFound = errors.New("location not found")
+var ErrLocationNotEmpty = errors.New("location still has child locations or beacons assigned")
+
+// Location is a site, building, floor or zone within an organisation's hierarchy.
+// Beacons are assigned to zones.
+type Location struct {
+	ID             uint64         `gorm:"primary_key;auto_increment" json:"id"`
+	OrganisationID uint64         `gorm:"not null;index" json:"organisation_id"`
+	ParentID       *uint64        `gorm:"index" json:"parent_id"`
+	Kind           string         `gorm:"size:20;not null" json:"kind"`
+	Name           string         `gorm:"size:255;not null" json:"name"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Stats          *LocationStats `gorm:"-" json:"stats,omitempty"`
+	Children       []*Location    `gorm:"-" json:"children,omitempty"`
+}
+
+// LocationStats rolls up the beacons assigned to a location and everything below it
+type LocationStats struct {
+	LocationID  uint64  `json:"-"`
+	BeaconCount int     `json:"beacon_count"`
+	OnlineCount int     `json:"online_count"`
+	OnlineRatio float64 `json:"online_ratio"`
+}
+
+func (l *Location) Prepare() {
+	l.Name = html.EscapeString(strings.TrimSpace(l.Name))
+	l.Kind = strings.ToLower(strings.TrimSpace(l.Kind))
+	l.Stats = nil
+	l.Children = nil
+}
+
+// Validate checks the location's kind and that it is nested under the right kind
+// of parent belonging to the same organisation
+func (l *Location) Validate(db *gorm.DB) error {
+	parentKind, ok := locationParentKinds[l.Kind]
+	if !ok {
+		return errors.New("location kind must be one of site, building, floor or zone")
+	}
+	if l.Name == "" {
+		return errors.New("required name")
+	}
+	if l.OrganisationID == 0 {
+		return errors.New("required organisation")
+	}
+
+	if parentKind == "" {
+		if l.ParentID != nil {
+			return errors.New("sites cannot have a parent location")
+		}
+		return nil
+	}
+	if l.ParentID == nil {
+		return errors.New("a " + l.Kind + " must be placed within a " + parentKind)
+	}
+
+	parent := Location{}
+	_, err := parent.FindLocationByID(db, *l.ParentID)
+	if err == ErrLocationNotFound {
+		return errors.New("parent location not found")
+	}
+	if err != nil {
+		return err
+	}
+	if parent.Kind != parentKind || parent.OrganisationID != l.OrganisationID {
+		return errors.New("a " + l.Kind + " must be placed within a " + parentKind + " of the same organisation")
+	}
+	return nil
+}
+
+func (l *Location) SaveLocation(db *gorm.DB) (*Location, error) {
+	err := l.Validate(db)
+	if err != nil {
+		return &Location{}, err
+	}
+
+	err = db.Debug().Model(&Location{}).Create(&l).Error
+	if err != nil {
+		return &Location{}, err
+	}
+	return l, nil
+}
+
+func (l *Location) FindLocationByID(db *gorm.DB, id uint64) (*Location, error) {
+	err := db.Debug().Model(&Location{}).Where("id = ?", id).Take(&l).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrLocationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// UpdateLocation renames or moves a location. The kind and organisation of a
+// location never change, so moving it cannot create a cycle.
+func (l *Location) UpdateLocation(db *gorm.DB, id uint64) error {
+	err := l.Validate(db)
+	if err != nil {
+		return err
+	}
+
+	err = db.Debug().Model(&Location{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"name":       l.Name,
+			"parent_id":  l.ParentID,
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Debug().Model(&Location{}).Where("id = ?", id).Take(&l).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteLocation removes a location that no longer has anything beneath it
+func (l *Location) DeleteLocation(db *gorm.DB, id uint64) error {
+	_, err := l.FindLocationByID(db, id)
+	if err != nil {
+		return err
+	}
+
+	var children, beacons int
+	err = db.Debug().Model(&Location{}).Where("parent_id = ?", id).Count(&children).Error
+	if err != nil {
+		return err
+	}
+	err = db.Debug().Model(&Beacon{}).Where("zone_id = ?", id).Count(&beacons).Error
+	if err != nil {
+		return err
+	}
+	if children > 0 || beacons > 0 {
+		return ErrLocationNotEmpty
+	}
+
+	return db.Debug().Model(&Location{}).Where("id = ?", id).Delete(&Location{}).Error
+}
+
+// FindOrganisationLocationTree returns the organisation's sites with every
+// location below them nested as children, each carrying its rolled up stats
+func (l *Location) FindOrganisationLocationTree(db *gorm.DB, organisationID uint64) ([]*Location, error) {
+	var locations []Location
+	err := db.Debug().Model(&Location{}).Where("organisation_id = ?", organisationID).Order("kind, name, id").Find(&locations).Error
+	if err != nil {
+		return []*Location{}, err
+	}
+
+	stats, err := FindLocationStats(db, organisationID)
+	if err != nil {
+		return []*Location{}, err
+	}
+
+	byID := make(map[uint64]*Location, len(locations))
+	for i, _ := range locations {
+		locations[i].Stats = &LocationStats{}
+		if found, ok := stats[locations[i].ID]; ok {
+			locations[i].Stats = found
+		}
+		byID[locations[i].ID] = &locations[i]
+	}
+
+	roots := []*Location{}
+	for i, _ := range locations {
+		location := &locations[i]
+		if location.ParentID == nil {
+			roots = append(roots, location)
+			continue
+		}
+		if parent, ok := byID[*location.ParentID]; ok {
+			parent.Children = append(parent.Children, location)
+		}
+	}
+	return roots, nil
+}
+
+// FindLocationSubtree loads the location with everything below it nested as children
+func (l *Location) FindLocationSubtree(db *gorm.DB, id uint64) (*Location, error) {
+	_, err := l.FindLocationByID(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := l.FindOrganisationLocationTree(db, l.OrganisationID)
+	if err != nil {
+		return nil, err
+	}
+	return findLocationInTree(roots, id), nil
+}
+
+func findLocationInTree(locations []*Location, id uint64) *Location {
+	for _, location := range locations {
+		if location.ID == id {
+			return location
+		}
+		if found := findLocationInTree(location.Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindLocationStats counts the beacons assigned at or below every location of an
+// organisation, keyed by location ID
+func FindLocationStats(db *gorm.DB, organisationID uint64) (map[uint64]*LocationStats, error) {
+	var rows []LocationStats
+	err := db.Debug().Raw(`
+		WITH RECURSIVE descendants AS (
+			SELECT id AS location_id, id AS descendant_id FROM locations WHERE organisation_id = ?
+			UNION ALL
+			SELECT descendants.location_id, locations.id
+			FROM locations JOIN descendants ON locations.parent_id = descendants.descendant_id
+		)
+		SELECT descendants.location_id,
+			COUNT(beacons.id) AS beacon_count,
+			COUNT(beacons.id) FILTER (WHERE beacons.is_online) AS online_count
+		FROM descendants LEFT JOIN beacons ON beacons.zone_id = descendants.descendant_id
+		GROUP BY descendants.location_id`, organisationID).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[uint64]*LocationStats, len(rows))
+	for i, _ := range rows {
+		rows[i].OnlineRatio = onlineRatio(rows[i].OnlineCount, rows[i].BeaconCount)
+		stats[rows[i].LocationID] = &rows[i]
+	}
+	return stats, nil
+}
+
+// FindOrganisationBeaconStats counts every beacon of an organisation, whether or
+// not it has been assigned to a zone
+func FindOrganisationBeaconStats(db *gorm.DB, organisationID uint64) (*LocationStats, error) {
+	stats := LocationStats{}
+	err := db.Debug().Raw(`
+		SELECT COUNT(id) AS beacon_count, COUNT(id) FILTER (WHERE is_online) AS online_count
+		FROM beacons WHERE organisation_id = ?`, organisationID).Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.OnlineRatio = onlineRatio(stats.OnlineCount, stats.BeaconCount)
+	return &stats, nil
+}
+
+func onlineRatio(online, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(online) / float64(total)
+}
+
+// AssignBeaconToZone places the beacon in a zone of its organisation, or removes
+// it from its zone when zoneID is nil
+func (b *Beacon) AssignBeaconToZone(db *gorm.DB, zoneID *uint64) error {
+	if zoneID != nil {
+		zone := Location{}
+		_, err := zone.FindLocationByID(db, *zoneID)
+		if err != nil {
+			return err
+		}
+		if zone.Kind != LocationKindZone {
+			return errors.New("beacons can only be assigned to a zone")
+		}
+		if b.OrganisationID == 0 || zone.OrganisationID != b.OrganisationID {
+			return errors.New("beacons can only be assigned to a zone of their own organisation")
+		}
+	}
+
+	err := db.Debug().Model(&Beacon{}).Where("id = ?", b.ID).UpdateColumn("zone_id", zoneID).Error
+	if err != nil {
+		return err
+	}
+	b.ZoneID = zoneID
+	return nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// latestCheckIns selects each PUC's most recent check-in in (from, to], so a PUC
+// that moved on is only counted where it was last seen. The range is served by
+// idx_check_ins_checked_in rather than scanning every check-in.
+const latestCheckIns = `SELECT DISTINCT ON (puc_id) puc_id, organisation_id, zone_id FROM check_ins
+	WHERE checked_in_at > ? AND checked_in_at <= ?
+	ORDER BY puc_id, checked_in_at DESC, id DESC`
+
+// ZoneOccupancy is how many PUCs are present in a zone
+type ZoneOccupancy struct {
+	ZoneID uint64 `json:"zone_id"`
+	Count  int    `json:"count"`
+}
+
+// Occupancy is how many PUCs are present in an organisation at a moment. A PUC is
+// present when it checked in within the inactivity timeout, the same rule that
+// ends a visit. PUCs at beacons outside any zone count only towards the total.
+type Occupancy struct {
+	OrganisationID uint64          `json:"organisation_id"`
+	Count          int             `json:"count"`
+	Zones          []ZoneOccupancy `json:"zones"`
+	At             time.Time       `json:"at"`
+}
+
+// OccupancySnapshot records an organisation's occupancy, or one of its zones'
+// when ZoneID is set, at TakenAt for charting occupancy over time
+type OccupancySnapshot struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	OrganisationID uint64    `gorm:"not null;index:idx_occupancy_snapshots_organisation_taken" json:"organisation_id"`
+	ZoneID         *uint64   `json:"zone_id"`
+	Count          int       `gorm:"not null" json:"count"`
+	TakenAt        time.Time `gorm:"not null;index:idx_occupancy_snapshots_organisation_taken" json:"taken_at"`
+}
+
+type occupancyCount struct {
+	OrganisationID uint64
+	ZoneID         *uint64
+	Count          int
+}
+
+func countOccupancy(db *gorm.DB, organisationID uint64, at time.Time, timeout time.Duration) ([]occupancyCount, error) {
+	if timeout <= 0 {
+		timeout = DefaultVisitInactivityTimeout
+	}
+
+	query := "SELECT organisation_id, zone_id, COUNT(*) AS count FROM (" + latestCheckIns + ") latest"
+	values := []interface{}{at.Add(-timeout), at}
+	if organisationID != 0 {
+		query += " WHERE organisation_id = ?"
+		values = append(values, organisationID)
+	}
+	query += " GROUP BY organisation_id, zone_id"
+
+	var counts []occupancyCount
+	err := db.Debug().Raw(query, values...).Scan(&counts).Error
+	return counts, err
+}
+
+// FindOccupancy returns how many PUCs were present in the organisation and each
+// of its occupied zones at the given time
+func FindOccupancy(db *gorm.DB, organisationID uint64, at time.Time, timeout time.Duration) (*Occupancy, error) {
+	counts, err := countOccupancy(db, organisationID, at, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	occupancy := Occupancy{OrganisationID: organisationID, Zones: []ZoneOccupancy{}, At: at}
+	for _, count := range counts {
+		occupancy.Count += count.Count
+		if count.ZoneID != nil {
+			occupancy.Zones = append(occupancy.Zones, ZoneOccupancy{ZoneID: *count.ZoneID, Count: count.Count})
+		}
+	}
+	return &occupancy, nil
+}
+
+// TakeOccupancySnapshots records the occupancy of every organisation at the given
+// time, returning how many snapshots were written. Every organisation gets a total
+// even when empty, zones only when occupied, so a zone missing from a snapshot
+// had nobody in it.
+func TakeOccupancySnapshots(db *gorm.DB, at time.Time, timeout time.Duration) (int, error) {
+	counts, err := countOccupancy(db, 0, at, timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	var organisationIDs []uint64
+	err = db.Debug().Model(&Organisation{}).Pluck("id", &organisationIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	totals := map[uint64]int{}
+	var snapshots []OccupancySnapshot
+	for _, count := range counts {
+		totals[count.OrganisationID] += count.Count
+		if count.ZoneID != nil {
+			snapshots = append(snapshots, OccupancySnapshot{OrganisationID: count.OrganisationID, ZoneID: count.ZoneID, Count: count.Count, TakenAt: at})
+		}
+	}
+	for _, organisationID := range organisationIDs {
+		snapshots = append(snapshots, OccupancySnapshot{OrganisationID: organisationID, Count: totals[organisationID], TakenAt: at})
+	}
+
+	tx := db.Begin()
+	for i := range snapshots {
+		err = tx.Debug().Model(&OccupancySnapshot{}).Create(&snapshots[i]).Error
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return 0, err
+	}
+	return len(snapshots), nil
+}
+
+// FindOccupancySnapshots returns the organisation's snapshots taken in [from, to),
+// oldest first, of its totals or of a single zone when zoneID is given
+func FindOccupancySnapshots(db *gorm.DB, organisationID uint64, zoneID *uint64, from, to time.Time) (*[]OccupancySnapshot, error) {
+	query := db.Debug().Model(&OccupancySnapshot{}).
+		Where("organisation_id = ? AND taken_at >= ? AND taken_at < ?", organisationID, from, to)
+	if zoneID != nil {
+		query = query.Where("zone_id = ?", *zoneID)
+	} else {
+		query = query.Where("zone_id IS NULL")
+	}
+
+	var snapshots []OccupancySnapshot
+	err := query.Order("taken_at asc").Find(&snapshots).Error
+	if err != nil {
+		return &[]OccupancySnapshot{}, err
+	}
+	return &snapshots, nil
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
 
 type Organisation struct {
 	ID uint64 `gorm:"primary_key;auto_increment" json:"id"`
@@ -10,6 +14,31 @@ type Organisation struct {
 	AdministratorID uint64
 	Administrator User `json:"administrator"`
 	EntityName string `json:"entity_name"`
+	OfflineThresholdMinutes int `gorm:"default:30" json:"offline_threshold_minutes"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	LastUsedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"last_used_at"`
 }
+
+// ErrOrganisationNotFound is returned by lookups against an organisation ID that does not exist
+var ErrOrganisationNotFound = errors.New("organisation not found")
+
+func (o *Organisation) FindOrganisationByID(db *gorm.DB, id uint64) (*Organisation, error) {
+	err := db.Debug().Model(&Organisation{}).Where("id = ?", id).Take(&o).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrOrganisationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// FindAdministeredOrganisationIDs lists the organisations the user administers
+func FindAdministeredOrganisationIDs(db *gorm.DB, userID uint32) ([]uint64, error) {
+	var ids []uint64
+	err := db.Debug().Model(&Organisation{}).Where("administrator_id = ?", userID).Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -1,19 +1,213 @@
 package models
 
 import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/labels"
 	"github.com/jinzhu/gorm"
+	"html"
+	"strings"
 	"time"
 )
 
+// ErrPucNotFound is returned by lookups against a PUC ID that does not exist
+var ErrPucNotFound = errors.New("puc not found")
+
 type Puc struct {
-	ID            uint64 `gorm:"primary_key;auto_increment" json:"id"`
-	CurrentUserID uint64
-	CurrentUser   *User `json:"current_user"`
-	LastCheckedIn        time.Time    `gorm:"default: CURRENT_TIMESTAMP"`
-	LastBeaconCheckedIntoID uint64
-	LastBeaconCheckedInto Beacon `json:"last_beacon_checked_into"`
+	ID                      uint64            `gorm:"primary_key;auto_increment" json:"id"`
+	SerialNumber            string            `gorm:"size:64;not null;unique" json:"serial_number"`
+	CurrentUserID           *uint32           `gorm:"index" json:"current_user_id"`
+	CurrentUser             *User             `gorm:"save_associations:false" json:"current_user,omitempty"`
+	LastCheckedIn           *time.Time        `json:"last_checked_in"`
+	LastBeaconCheckedIntoID *uint64           `gorm:"index" json:"last_beacon_checked_into_id"`
+	LastBeaconCheckedInto   *Beacon           `gorm:"save_associations:false" json:"last_beacon_checked_into,omitempty"`
+	LostAt                  *time.Time        `json:"lost_at"`
+	DeletedAt               *time.Time        `sql:"index" json:"-"`
+	Labels                  map[string]string `gorm:"-" json:"labels"`
+	CreatedAt               time.Time         `json:"created_at"`
+	UpdatedAt               time.Time         `json:"updated_at"`
+}
+
+func (p *Puc) Prepare() {
+	p.SerialNumber = html.EscapeString(strings.TrimSpace(p.SerialNumber))
+	p.CurrentUser = nil
+	p.LastBeaconCheckedInto = nil
+}
+
+func (p *Puc) Validate() error {
+	if p.SerialNumber == "" {
+		return errors.New("required serial number")
+	}
+	return labels.Validate(p.Labels)
+}
+
+// Redact hides who holds the PUC and where and when it was last seen, for
+// readers who may not follow it
+func (p *Puc) Redact() {
+	p.CurrentUserID = nil
+	p.CurrentUser = nil
+	p.LastCheckedIn = nil
+	p.LastBeaconCheckedIntoID = nil
+	p.LastBeaconCheckedInto = nil
+	p.LostAt = nil
+}
+
+func (p *Puc) SavePuc(db *gorm.DB) (*Puc, error) {
+	err := p.Validate()
+	if err != nil {
+		return &Puc{}, err
+	}
+
+	// custody only changes through CheckOutPuc and ReturnPuc, check-ins only
+	// through RecordCheckIn, loss only through ReportPucLost and ReportPucFound
+	p.CurrentUserID = nil
+	p.LostAt = nil
+	p.LastCheckedIn = nil
+	p.LastBeaconCheckedIntoID = nil
+
+	err = db.Debug().Model(&Puc{}).Create(&p).Error
+	if err != nil {
+		return &Puc{}, err
+	}
+
+	if len(p.Labels) > 0 {
+		err = p.SetPucLabels(db, p.Labels)
+		if err != nil {
+			return &Puc{}, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Puc) FindPucByID(db *gorm.DB, id uint64) (*Puc, error) {
+	err := db.Debug().Model(&Puc{}).Where("id = ?", id).Take(&p).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrPucNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sets, err := FindLabels(db, LabelResourcePuc, []uint64{p.ID})
+	if err != nil {
+		return nil, err
+	}
+	p.Labels = sets[p.ID]
+	return p, nil
 }
 
-func (p *Puc) UpdatePuc(db *gorm.DB, uid uint32) (*Puc, error) {
-	return nil,	nil
-}
\ No newline at end of file
+// FindAllPucs lists PUCs whose labels match the selector, which may be empty
+func (p *Puc) FindAllPucs(db *gorm.DB, selector labels.Selector) (*[]Puc, error) {
+	var pucs []Puc
+	query := whereLabelsMatch(db.Debug().Model(&Puc{}), LabelResourcePuc, "pucs.id", selector)
+	err := query.Order("id").Limit(100).Find(&pucs).Error
+	if err != nil {
+		return &[]Puc{}, err
+	}
+
+	ids := make([]uint64, len(pucs))
+	for i, _ := range pucs {
+		ids[i] = pucs[i].ID
+	}
+	sets, err := FindLabels(db, LabelResourcePuc, ids)
+	if err != nil {
+		return &[]Puc{}, err
+	}
+	for i, _ := range pucs {
+		pucs[i].Labels = sets[pucs[i].ID]
+	}
+	return &pucs, nil
+}
+
+// UpdatePuc saves the PUC's editable details. Custody, check-ins, loss and labels have their own updates.
+func (p *Puc) UpdatePuc(db *gorm.DB, uid uint64) (*Puc, error) {
+	err := p.Validate()
+	if err != nil {
+		return &Puc{}, err
+	}
+
+	result := db.Debug().Model(&Puc{}).Where("id = ?", uid).UpdateColumns(
+		map[string]interface{}{
+			"serial_number": p.SerialNumber,
+			"updated_at":    time.Now(),
+		})
+	if result.Error != nil {
+		return &Puc{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &Puc{}, ErrPucNotFound
+	}
+
+	return p.FindPucByID(db, uint64(uid))
+}
+
+// RecordCheckIn notes the beacon the PUC last checked in to, a quick view of the
+// latest entry in its check-in history. Check-ins can arrive out of order, so an
+// earlier check-in never replaces a later one.
+func (p *Puc) RecordCheckIn(db *gorm.DB, beaconID uint64, checkedInAt time.Time) error {
+	result := db.Debug().Model(&Puc{}).
+		Where("id = ? AND (last_checked_in IS NULL OR last_checked_in < ?)", p.ID, checkedInAt).
+		UpdateColumns(map[string]interface{}{
+			"last_checked_in":             checkedInAt,
+			"last_beacon_checked_into_id": beaconID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		p.LastCheckedIn = &checkedInAt
+		p.LastBeaconCheckedIntoID = &beaconID
+	}
+	return nil
+}
+
+// DeletePuc retires the PUC. It is only marked deleted, so its custody, check-in
+// and loss history are kept.
+func (p *Puc) DeletePuc(db *gorm.DB, uid uint64) (int64, error) {
+	existing := Puc{}
+	err := db.Debug().Model(&Puc{}).Where("id = ?", uid).Take(&existing).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, ErrPucNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// whoever holds the PUC gives it up along with it
+	now := time.Now()
+	err = db.Debug().Model(&PucCustody{}).Where("puc_id = ? AND returned_at IS NULL", uid).UpdateColumns(
+		map[string]interface{}{
+			"returned_at":  now,
+			"return_notes": "puc deleted",
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Model(&Puc{}).Where("id = ?", uid).UpdateColumn("current_user_id", nil).Error
+	if err != nil {
+		return 0, err
+	}
+
+	result := db.Debug().Model(&Puc{}).Where("id = ?", uid).Delete(&Puc{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, ErrPucNotFound
+	}
+
+	// the holder moves on to any other PUC they still hold
+	if existing.CurrentUserID != nil {
+		err = repointHeldPuc(db, *existing.CurrentUserID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// labels are shared with beacons so are not removed by a foreign key
+	err = db.Debug().Where("resource_type = ? AND resource_id = ?", LabelResourcePuc, uid).Delete(&Label{}).Error
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
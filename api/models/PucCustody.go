@@ -0,0 +1,220 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+var ErrPucAlreadyCheckedOut = errors.New("puc is already checked out")
+var ErrPucNotCheckedOut = errors.New("puc is not checked out")
+var ErrUserAlreadyHoldsPuc = errors.New("user already holds a puc")
+var ErrUserNotFound = errors.New("user not found")
+
+// PucCustody is one period a user held a PUC, from checkout until it was
+// returned. Open periods have no ReturnedAt.
+type PucCustody struct {
+	ID             uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	PucID          uint64     `gorm:"not null;index:idx_puc_custodies_puc" json:"puc_id"`
+	UserID         uint32     `gorm:"not null;index" json:"user_id"`
+	CheckedOutAt   time.Time  `gorm:"not null;index:idx_puc_custodies_puc" json:"checked_out_at"`
+	CheckedOutByID uint32     `gorm:"not null" json:"checked_out_by_id"`
+	CheckOutNotes  string     `gorm:"size:255" json:"check_out_notes"`
+	ReturnedAt     *time.Time `json:"returned_at"`
+	ReturnedByID   *uint32    `json:"returned_by_id"`
+	ReturnNotes    string     `gorm:"size:255" json:"return_notes"`
+}
+
+// CheckOutPuc hands the PUC to a user, updating the PUC, the user and the custody
+// history in a single transaction. Unless allowMultiple is set a user who already
+// holds a PUC is refused another.
+func (p *Puc) CheckOutPuc(db *gorm.DB, userID uint32, actorID uint32, notes string, allowMultiple bool) (*PucCustody, error) {
+	tx := db.Begin()
+
+	// locking the PUC and the user serialises checkouts of either
+	locked := Puc{}
+	err := tx.Debug().Model(&Puc{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", p.ID).Take(&locked).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, ErrPucNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if locked.CurrentUserID != nil {
+		tx.Rollback()
+		return nil, ErrPucAlreadyCheckedOut
+	}
+
+	err = tx.Debug().Model(&User{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", userID).Take(&User{}).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if !allowMultiple {
+		var held int
+		err = tx.Debug().Model(&Puc{}).Where("current_user_id = ?", userID).Count(&held).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if held > 0 {
+			tx.Rollback()
+			return nil, ErrUserAlreadyHoldsPuc
+		}
+	}
+
+	now := time.Now()
+	err = tx.Debug().Model(&Puc{}).Where("id = ?", p.ID).UpdateColumns(
+		map[string]interface{}{
+			"current_user_id": userID,
+			"updated_at":      now,
+		}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// a user holding several PUCs points at the one checked out most recently
+	err = tx.Debug().Model(&User{}).Where("id = ?", userID).UpdateColumn("current_puc_held_id", p.ID).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	custody := PucCustody{
+		PucID:          p.ID,
+		UserID:         userID,
+		CheckedOutAt:   now,
+		CheckedOutByID: actorID,
+		CheckOutNotes:  notes,
+	}
+	err = tx.Debug().Model(&PucCustody{}).Create(&custody).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	p.CurrentUserID = &userID
+	p.UpdatedAt = now
+	return &custody, nil
+}
+
+// ReturnPuc takes the PUC back from whoever holds it, closing their custody period
+func (p *Puc) ReturnPuc(db *gorm.DB, actorID uint32, notes string) (*PucCustody, error) {
+	tx := db.Begin()
+
+	locked := Puc{}
+	err := tx.Debug().Model(&Puc{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", p.ID).Take(&locked).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, ErrPucNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if locked.CurrentUserID == nil {
+		tx.Rollback()
+		return nil, ErrPucNotCheckedOut
+	}
+	holderID := *locked.CurrentUserID
+
+	now := time.Now()
+	err = tx.Debug().Model(&Puc{}).Where("id = ?", p.ID).UpdateColumns(
+		map[string]interface{}{
+			"current_user_id": nil,
+			"updated_at":      now,
+		}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	custody := PucCustody{}
+	err = tx.Debug().Model(&PucCustody{}).Where("puc_id = ? AND returned_at IS NULL", p.ID).Order("checked_out_at desc").Take(&custody).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, err
+	}
+	if err == nil {
+		err = tx.Debug().Model(&PucCustody{}).Where("id = ?", custody.ID).UpdateColumns(
+			map[string]interface{}{
+				"returned_at":    now,
+				"returned_by_id": actorID,
+				"return_notes":   notes,
+			}).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		custody.ReturnedAt = &now
+		custody.ReturnedByID = &actorID
+		custody.ReturnNotes = notes
+	}
+
+	err = repointHeldPuc(tx, holderID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	p.CurrentUserID = nil
+	p.UpdatedAt = now
+	return &custody, nil
+}
+
+// FindPucCustodyHistory returns the custody periods of a PUC that overlap the
+// window, oldest first. Passing the same instant as from and to finds the holder
+// at that moment.
+func FindPucCustodyHistory(db *gorm.DB, pucID uint64, from, to time.Time) (*[]PucCustody, error) {
+	var history []PucCustody
+	err := db.Debug().Model(&PucCustody{}).
+		Where("puc_id = ? AND checked_out_at <= ? AND (returned_at IS NULL OR returned_at > ?)", pucID, to, from).
+		Order("checked_out_at asc, id asc").
+		Find(&history).Error
+	if err != nil {
+		return &[]PucCustody{}, err
+	}
+	return &history, nil
+}
+
+// repointHeldPuc points the user at the PUC they most recently checked out and
+// still hold, or at nothing once they hold none
+func repointHeldPuc(db *gorm.DB, userID uint32) error {
+	custody := PucCustody{}
+	err := db.Debug().Model(&PucCustody{}).Select("puc_custodies.*").
+		Joins("JOIN pucs ON pucs.id = puc_custodies.puc_id AND pucs.current_user_id = puc_custodies.user_id").
+		Where("puc_custodies.user_id = ? AND puc_custodies.returned_at IS NULL", userID).
+		Order("puc_custodies.checked_out_at desc").
+		Take(&custody).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return db.Debug().Model(&User{}).Where("id = ?", userID).UpdateColumn("current_puc_held_id", nil).Error
+	}
+	if err != nil {
+		return err
+	}
+	return db.Debug().Model(&User{}).Where("id = ?", userID).UpdateColumn("current_puc_held_id", custody.PucID).Error
+}
+
+// releaseUserPucs closes every custody period of a user who is being removed
+func releaseUserPucs(db *gorm.DB, userID uint32) error {
+	return db.Debug().Model(&PucCustody{}).Where("user_id = ? AND returned_at IS NULL", userID).
+		UpdateColumn("returned_at", time.Now()).Error
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+var ErrPucAlreadyLost = errors.New("puc is already reported lost")
+var ErrPucNotLost = errors.New("puc is not reported lost")
+
+// PucLossReport is one period a PUC was lost, from being reported lost until it
+// was found. Open reports have no FoundAt. While BlockCredit is set check-ins of
+// the PUC are not credited to HolderID, whoever held it when it went missing.
+type PucLossReport struct {
+	ID           uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	PucID        uint64     `gorm:"not null;index:idx_puc_loss_reports_puc" json:"puc_id"`
+	HolderID     *uint32    `json:"holder_id"`
+	BlockCredit  bool       `gorm:"not null;default:false" json:"block_credit"`
+	ReportedAt   time.Time  `gorm:"not null;index:idx_puc_loss_reports_puc" json:"reported_at"`
+	ReportedByID uint32     `gorm:"not null" json:"reported_by_id"`
+	ReportNotes  string     `gorm:"size:255" json:"report_notes"`
+	FoundAt      *time.Time `json:"found_at"`
+	FoundByID    *uint32    `json:"found_by_id"`
+	FoundNotes   string     `gorm:"size:255" json:"found_notes"`
+}
+
+// PucAlert is raised when a PUC reported lost checks in somewhere or is heard by
+// a gateway, in which case it has no CheckInID
+type PucAlert struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	PucID          uint64    `gorm:"not null;index:idx_puc_alerts_puc_sighted" json:"puc_id"`
+	LossReportID   uint64    `gorm:"not null" json:"loss_report_id"`
+	BeaconID       uint64    `gorm:"not null" json:"beacon_id"`
+	OrganisationID uint64    `gorm:"index" json:"organisation_id"`
+	CheckInID      *uint64   `json:"check_in_id"`
+	SightedAt      time.Time `gorm:"not null;index:idx_puc_alerts_puc_sighted" json:"sighted_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ReportPucLost flags the PUC as lost and opens a loss report. With blockCredit
+// set its check-ins are no longer credited to whoever holds it.
+func (p *Puc) ReportPucLost(db *gorm.DB, actorID uint32, notes string, blockCredit bool) (*PucLossReport, error) {
+	tx := db.Begin()
+
+	locked := Puc{}
+	err := tx.Debug().Model(&Puc{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", p.ID).Take(&locked).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, ErrPucNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if locked.LostAt != nil {
+		tx.Rollback()
+		return nil, ErrPucAlreadyLost
+	}
+
+	now := time.Now()
+	report := PucLossReport{
+		PucID:        p.ID,
+		HolderID:     locked.CurrentUserID,
+		BlockCredit:  blockCredit,
+		ReportedAt:   now,
+		ReportedByID: actorID,
+		ReportNotes:  notes,
+	}
+	err = tx.Debug().Model(&PucLossReport{}).Create(&report).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Debug().Model(&Puc{}).Where("id = ?", p.ID).UpdateColumns(
+		map[string]interface{}{
+			"lost_at":    now,
+			"updated_at": now,
+		}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	p.LostAt = &now
+	p.UpdatedAt = now
+	return &report, nil
+}
+
+// ReportPucFound clears the PUC's lost flag, closing its loss report
+func (p *Puc) ReportPucFound(db *gorm.DB, actorID uint32, notes string) (*PucLossReport, error) {
+	tx := db.Begin()
+
+	locked := Puc{}
+	err := tx.Debug().Model(&Puc{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", p.ID).Take(&locked).Error
+	if gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return nil, ErrPucNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if locked.LostAt == nil {
+		tx.Rollback()
+		return nil, ErrPucNotLost
+	}
+
+	report, err := findOpenLossReport(tx, p.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	now := time.Now()
+	err = tx.Debug().Model(&PucLossReport{}).Where("id = ?", report.ID).UpdateColumns(
+		map[string]interface{}{
+			"found_at":    now,
+			"found_by_id": actorID,
+			"found_notes": notes,
+		}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Debug().Model(&Puc{}).Where("id = ?", p.ID).UpdateColumns(
+		map[string]interface{}{
+			"lost_at":    nil,
+			"updated_at": now,
+		}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	report.FoundAt = &now
+	report.FoundByID = &actorID
+	report.FoundNotes = notes
+	p.LostAt = nil
+	p.UpdatedAt = now
+	return report, nil
+}
+
+// FindPucLossReports returns every time the PUC was reported lost, newest first
+func FindPucLossReports(db *gorm.DB, pucID uint64) (*[]PucLossReport, error) {
+	var reports []PucLossReport
+	err := db.Debug().Model(&PucLossReport{}).Where("puc_id = ?", pucID).Order("reported_at desc, id desc").Find(&reports).Error
+	if err != nil {
+		return &[]PucLossReport{}, err
+	}
+	return &reports, nil
+}
+
+// FindPucAlerts returns the alerts raised by the PUC's sightings in [from, to), newest first
+func FindPucAlerts(db *gorm.DB, pucID uint64, from, to time.Time) (*[]PucAlert, error) {
+	var alerts []PucAlert
+	err := db.Debug().Model(&PucAlert{}).
+		Where("puc_id = ? AND sighted_at >= ? AND sighted_at < ?", pucID, from, to).
+		Order("sighted_at desc, id desc").Limit(500).Find(&alerts).Error
+	if err != nil {
+		return &[]PucAlert{}, err
+	}
+	return &alerts, nil
+}
+
+// findOpenLossReport returns the loss report of a PUC that has not been found
+func findOpenLossReport(db *gorm.DB, pucID uint64) (*PucLossReport, error) {
+	report := PucLossReport{}
+	err := db.Debug().Model(&PucLossReport{}).Where("puc_id = ? AND found_at IS NULL", pucID).Order("reported_at desc").Take(&report).Error
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// AlertLostPucSightings raises an alert for each lost PUC a gateway heard, one
+// per beacon at the latest time it was heard there. Sightings sent again raise no
+// further alerts.
+func AlertLostPucSightings(db *gorm.DB, sightings []Sighting, beacons map[uint64]*Beacon) error {
+	var pucIDs []uint64
+	for _, sighting := range sightings {
+		pucIDs = append(pucIDs, sighting.PucID)
+	}
+	if len(pucIDs) == 0 {
+		return nil
+	}
+
+	var reports []PucLossReport
+	err := db.Debug().Model(&PucLossReport{}).Where("puc_id IN (?) AND found_at IS NULL", pucIDs).Find(&reports).Error
+	if err != nil {
+		return err
+	}
+	openReports := map[uint64]*PucLossReport{}
+	for i := range reports {
+		openReports[reports[i].PucID] = &reports[i]
+	}
+
+	type pucAtBeacon struct {
+		pucID    uint64
+		beaconID uint64
+	}
+	latest := map[pucAtBeacon]time.Time{}
+	var order []pucAtBeacon
+	for _, sighting := range sightings {
+		if openReports[sighting.PucID] == nil {
+			continue
+		}
+		key := pucAtBeacon{sighting.PucID, sighting.BeaconID}
+		seenAt, ok := latest[key]
+		if !ok {
+			order = append(order, key)
+		}
+		if !ok || sighting.SeenAt.After(seenAt) {
+			latest[key] = sighting.SeenAt
+		}
+	}
+
+	for _, key := range order {
+		report := openReports[key.pucID]
+		var raised int
+		err = db.Debug().Model(&PucAlert{}).
+			Where("loss_report_id = ? AND beacon_id = ? AND sighted_at >= ?", report.ID, key.beaconID, latest[key]).
+			Count(&raised).Error
+		if err != nil {
+			return err
+		}
+		if raised > 0 {
+			continue
+		}
+
+		err = raiseLostPucAlert(db, report, beacons[key.beaconID], key.pucID, latest[key], nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alertRepeatedCheckIn raises an alert for a lost PUC's check-in that repeats
+// one already recorded, unless that check-in already raised one
+func alertRepeatedCheckIn(db *gorm.DB, report *PucLossReport, b *Beacon, checkIn *CheckIn, sightedAt time.Time) error {
+	var raised int
+	err := db.Debug().Model(&PucAlert{}).Where("loss_report_id = ? AND check_in_id = ?", report.ID, checkIn.ID).Count(&raised).Error
+	if err != nil || raised > 0 {
+		return err
+	}
+	return raiseLostPucAlert(db, report, b, checkIn.PucID, sightedAt, &checkIn.ID)
+}
+
+// raiseLostPucAlert records that a lost PUC was sighted at the beacon, both as an
+// alert on the PUC and as a security event in the beacon's log
+func raiseLostPucAlert(db *gorm.DB, report *PucLossReport, b *Beacon, pucID uint64, sightedAt time.Time, checkInID *uint64) error {
+	alert := PucAlert{
+		PucID:          pucID,
+		LossReportID:   report.ID,
+		BeaconID:       b.ID,
+		OrganisationID: b.OrganisationID,
+		CheckInID:      checkInID,
+		SightedAt:      sightedAt,
+	}
+	err := db.Debug().Model(&PucAlert{}).Create(&alert).Error
+	if err != nil {
+		return err
+	}
+
+	details := fmt.Sprintf("puc %d reported lost at %s", pucID, report.ReportedAt.UTC().Format(time.RFC3339))
+	return RecordBeaconEvent(db, b.ID, b.OrganisationID, BeaconEventLostPucSighted, details, sightedAt)
+}
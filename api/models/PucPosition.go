@@ -0,0 +1,186 @@
+package models
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/positioning"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"time"
+)
+
+// DefaultPositioningWindow is how far back readings are used to position a PUC
+const DefaultPositioningWindow = 30 * time.Second
+
+// How a PUC's position was estimated
+const (
+	PositionTrilateration = "trilateration"
+	PositionProximity     = "proximity"
+)
+
+var ErrPositionUnknown = errors.New("puc has not been heard by any placed beacon")
+
+// BeaconProximity is how far a PUC is estimated to be from one beacon
+type BeaconProximity struct {
+	BeaconID       uint64  `json:"beacon_id"`
+	Readings       int     `json:"readings"`
+	SmoothedRSSI   float64 `json:"smoothed_rssi"`
+	TxPower        int     `json:"tx_power"`
+	DistanceMetres float64 `json:"distance_metres"`
+}
+
+// PucPosition is a PUC's estimated position. Trilateration needs three placed
+// beacons on the floor, otherwise the PUC is placed at the nearest beacon and the
+// accuracy is its distance from it.
+type PucPosition struct {
+	PucID          uint64            `json:"puc_id"`
+	Method         string            `json:"method"`
+	Latitude       float64           `json:"latitude"`
+	Longitude      float64           `json:"longitude"`
+	Floor          *int              `json:"floor"`
+	AccuracyMetres float64           `json:"accuracy_metres"`
+	EstimatedAt    time.Time         `json:"estimated_at"`
+	Beacons        []BeaconProximity `json:"beacons"`
+}
+
+// PositioningOptions tunes how readings are turned into a position. Access
+// narrows the readings to those the reader may see.
+type PositioningOptions struct {
+	Window           time.Duration
+	PathLossExponent float64
+	Access           PucAccess
+}
+
+// applySightings limits a query on sightings to those the reader may see. As
+// sightings are not credited to anyone, a holder sees those from while they held
+// the PUC.
+func (a PucAccess) applySightings(query *gorm.DB) *gorm.DB {
+	if !a.Restricted {
+		return query
+	}
+	held := `EXISTS (SELECT 1 FROM puc_custodies WHERE puc_custodies.puc_id = sightings.puc_id
+		AND puc_custodies.user_id = ? AND puc_custodies.checked_out_at <= sightings.seen_at
+		AND (puc_custodies.returned_at IS NULL OR puc_custodies.returned_at > sightings.seen_at))`
+	if len(a.OrganisationIDs) == 0 {
+		return query.Where(held, a.UserID)
+	}
+	return query.Where("("+held+" OR sightings.beacon_id IN (SELECT id FROM beacons WHERE organisation_id IN (?)))", a.UserID, a.OrganisationIDs)
+}
+
+type rssiReading struct {
+	BeaconID uint64
+	RSSI     int
+	At       time.Time
+}
+
+// EstimatePucPosition positions a PUC from the RSSI of the gateway sightings and
+// check-ins reported for it in the window before at. Readings are smoothed per
+// beacon before being converted into distances.
+func EstimatePucPosition(db *gorm.DB, pucID uint64, at time.Time, options PositioningOptions) (*PucPosition, error) {
+	if options.Window <= 0 {
+		options.Window = DefaultPositioningWindow
+	}
+	from := at.Add(-options.Window)
+
+	var readings []rssiReading
+	sightings := db.Debug().Model(&Sighting{}).Select("beacon_id, rssi, seen_at AS at").
+		Where("puc_id = ? AND seen_at > ? AND seen_at <= ?", pucID, from, at)
+	err := options.Access.applySightings(sightings).Scan(&readings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var checkInReadings []rssiReading
+	checkIns := db.Debug().Model(&CheckIn{}).Select("beacon_id, rssi, checked_in_at AS at").
+		Where("puc_id = ? AND rssi IS NOT NULL AND checked_in_at > ? AND checked_in_at <= ?", pucID, from, at)
+	err = options.Access.apply(checkIns, "check_ins").Scan(&checkInReadings).Error
+	if err != nil {
+		return nil, err
+	}
+	readings = append(readings, checkInReadings...)
+	if len(readings) == 0 {
+		return nil, ErrPositionUnknown
+	}
+
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].At.Before(readings[j].At)
+	})
+	byBeacon := map[uint64][]float64{}
+	var beaconIDs []uint64
+	for _, reading := range readings {
+		if _, ok := byBeacon[reading.BeaconID]; !ok {
+			beaconIDs = append(beaconIDs, reading.BeaconID)
+		}
+		byBeacon[reading.BeaconID] = append(byBeacon[reading.BeaconID], float64(reading.RSSI))
+	}
+
+	// only beacons that have been placed can anchor a position
+	var beacons []Beacon
+	err = db.Debug().Model(&Beacon{}).Where("id IN (?) AND latitude IS NOT NULL AND longitude IS NOT NULL", beaconIDs).Find(&beacons).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(beacons) == 0 {
+		return nil, ErrPositionUnknown
+	}
+
+	proximities := make([]BeaconProximity, len(beacons))
+	for i, beacon := range beacons {
+		txPower := positioning.DefaultTxPower
+		if beacon.TxPower != nil {
+			txPower = *beacon.TxPower
+		}
+		rssi := positioning.SmoothRSSI(byBeacon[beacon.ID])
+		proximities[i] = BeaconProximity{
+			BeaconID:       beacon.ID,
+			Readings:       len(byBeacon[beacon.ID]),
+			SmoothedRSSI:   rssi,
+			TxPower:        txPower,
+			DistanceMetres: positioning.Distance(rssi, txPower, options.PathLossExponent),
+		}
+	}
+
+	// nearest first, the nearest beacon decides the floor
+	order := make([]int, len(beacons))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return proximities[order[i]].DistanceMetres < proximities[order[j]].DistanceMetres
+	})
+	nearest := beacons[order[0]]
+
+	position := PucPosition{
+		PucID:       pucID,
+		Floor:       nearest.Floor,
+		EstimatedAt: at,
+		Beacons:     []BeaconProximity{},
+	}
+
+	var anchors []positioning.Anchor
+	for _, i := range order {
+		beacon := beacons[i]
+		if nearest.Floor != nil && beacon.Floor != nil && *beacon.Floor != *nearest.Floor {
+			continue
+		}
+		x, y := positioning.Project(*beacon.Latitude, *beacon.Longitude, *nearest.Latitude, *nearest.Longitude)
+		anchors = append(anchors, positioning.Anchor{X: x, Y: y, Distance: proximities[i].DistanceMetres})
+		position.Beacons = append(position.Beacons, proximities[i])
+	}
+
+	x, y, accuracy, err := positioning.Trilaterate(anchors)
+	if err == nil {
+		position.Method = PositionTrilateration
+		position.Latitude, position.Longitude = positioning.Unproject(x, y, *nearest.Latitude, *nearest.Longitude)
+		position.AccuracyMetres = accuracy
+		return &position, nil
+	}
+	if err != positioning.ErrNotEnoughAnchors && err != positioning.ErrCollinearAnchors {
+		return nil, err
+	}
+
+	position.Method = PositionProximity
+	position.Latitude = *nearest.Latitude
+	position.Longitude = *nearest.Longitude
+	position.AccuracyMetres = proximities[order[0]].DistanceMetres
+	return &position, nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// sightingInsertChunk bounds how many sightings go into a single INSERT
+const sightingInsertChunk = 500
+
+// Sighting is a gateway hearing a PUC near a beacon. A gateway reporting the same
+// PUC and beacon at the same second is a duplicate and is only stored once.
+type Sighting struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	GatewayID uint64    `gorm:"not null;unique_index:idx_sightings_dedupe" json:"gateway_id"`
+	BeaconID  uint64    `gorm:"not null;unique_index:idx_sightings_dedupe;index:idx_sightings_beacon_seen" json:"beacon_id"`
+	PucID     uint64    `gorm:"not null;unique_index:idx_sightings_dedupe;index:idx_sightings_puc_seen" json:"puc_id"`
+	RSSI      int       `gorm:"column:rssi;not null" json:"rssi"`
+	SeenAt    time.Time `gorm:"not null;unique_index:idx_sightings_dedupe;index:idx_sightings_puc_seen,idx_sightings_beacon_seen" json:"seen_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertSightings bulk inserts the sightings, skipping any already stored, and
+// returns how many were new
+func InsertSightings(db *gorm.DB, sightings []Sighting) (int64, error) {
+	var inserted int64
+	now := time.Now()
+
+	for start := 0; start < len(sightings); start += sightingInsertChunk {
+		end := start + sightingInsertChunk
+		if end > len(sightings) {
+			end = len(sightings)
+		}
+
+		placeholders := make([]string, 0, end-start)
+		values := make([]interface{}, 0, (end-start)*6)
+		for _, sighting := range sightings[start:end] {
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?)")
+			values = append(values, sighting.GatewayID, sighting.BeaconID, sighting.PucID, sighting.RSSI, sighting.SeenAt, now)
+		}
+
+		result := db.Debug().Exec(fmt.Sprintf(
+			"INSERT INTO sightings (gateway_id, beacon_id, puc_id, rssi, seen_at, created_at) VALUES %s ON CONFLICT DO NOTHING",
+			strings.Join(placeholders, ", ")), values...)
+		if result.Error != nil {
+			return inserted, result.Error
+		}
+		inserted += result.RowsAffected
+	}
+	return inserted, nil
+}
+
+// FindPucIDs returns which of the given PUC IDs exist
+func FindPucIDs(db *gorm.DB, ids []uint64) (map[uint64]bool, error) {
+	known := map[uint64]bool{}
+	if len(ids) == 0 {
+		return known, nil
+	}
+
+	var found []uint64
+	err := db.Debug().Model(&Puc{}).Where("id IN (?)", ids).Pluck("id", &found).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		known[id] = true
+	}
+	return known, nil
+}
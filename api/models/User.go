@@ -21,8 +21,11 @@ type User struct {
 	UpdatedAt          time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 	AccountActive      bool      `gorm:"default:true" json:"active"`
 	LastLogin          time.Time `gorm:"default: CURRENT_TIMESTAMP" json:"last_login"`
-	CurrentPucHeldID   uint64
-	CurrentPucHeld 	   *Puc `json:"current_puc_held"`
+	CurrentPucHeldID   *uint64   `gorm:"index" json:"current_puc_held_id"`
+	CurrentPucHeld 	   *Puc `gorm:"save_associations:false" json:"current_puc_held,omitempty"`
+	// IsStaff marks the operators who manage beacons no organisation owns yet. It
+	// is only ever granted in the database.
+	IsStaff            bool      `gorm:"not null;default:false" json:"is_staff"`
 }
 
 type FieldValidation struct {
@@ -140,6 +143,9 @@ func (u *User) SaveUser(db *gorm.DB) (*User, error) {
 	// Setup Error Object
 	var err error
 
+	// staff are never created through the API
+	u.IsStaff = false
+
 	// Create User with Debugging and Pull Out Error
 	err = db.Debug().Create(&u).Error
 
@@ -221,6 +227,12 @@ func (u *User) UpdateUser(db *gorm.DB, uid uint32) (*User, error) {
 }
 
 func (u *User) DeleteUser(db *gorm.DB, uid uint32) (int64, error) {
+	// the user's PUCs are released by a foreign key, their custody is closed here
+	err := releaseUserPucs(db, uid)
+	if err != nil {
+		return 0, err
+	}
+
 	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).Delete(&User{})
 	if db.Error != nil {
 		return 0, db.Error
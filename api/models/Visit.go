@@ -0,0 +1,193 @@
+package models
+
+import (
+	"github.com/SherbazHashmi/goblog/api/visits"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// DefaultVisitInactivityTimeout is how long a PUC can go without checking in
+// before its visit is considered over
+const DefaultVisitInactivityTimeout = 15 * time.Minute
+
+// Visit is a PUC's stay at a beacon, zone or organisation, built from its
+// check-ins by the visits package. Visits are derived data and are rebuilt by
+// RecomputeVisits whenever the check-ins or the inactivity timeout change.
+type Visit struct {
+	ID             uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	PucID          uint64    `gorm:"not null;index:idx_visits_puc_entered" json:"puc_id"`
+	UserID         *uint32   `gorm:"index" json:"user_id"`
+	Scope          string    `gorm:"size:20;not null;index:idx_visits_scope" json:"scope"`
+	ScopeID        uint64    `gorm:"not null;index:idx_visits_scope" json:"scope_id"`
+	OrganisationID uint64    `gorm:"index" json:"organisation_id"`
+	EnteredAt      time.Time `gorm:"not null;index:idx_visits_puc_entered" json:"entered_at"`
+	ExitedAt       time.Time `gorm:"not null" json:"exited_at"`
+	DwellSeconds   int64     `json:"dwell_seconds"`
+	CheckIns       int       `json:"check_ins"`
+}
+
+// VisitFilter narrows the visits FindVisits returns. Zero fields are not filtered on.
+type VisitFilter struct {
+	PucID          uint64
+	OrganisationID uint64
+	Scope          string
+	ScopeID        uint64
+	From           time.Time
+	To             time.Time
+	Access         PucAccess
+}
+
+// FindVisits returns the visits overlapping [From, To) that match the filter, newest first
+func FindVisits(db *gorm.DB, filter VisitFilter) (*[]Visit, error) {
+	query := db.Debug().Model(&Visit{}).Where("entered_at < ? AND exited_at >= ?", filter.To, filter.From)
+	if filter.PucID != 0 {
+		query = query.Where("puc_id = ?", filter.PucID)
+	}
+	if filter.OrganisationID != 0 {
+		query = query.Where("organisation_id = ?", filter.OrganisationID)
+	}
+	if filter.Scope != "" {
+		query = query.Where("scope = ?", filter.Scope)
+	}
+	if filter.ScopeID != 0 {
+		query = query.Where("scope_id = ?", filter.ScopeID)
+	}
+	query = filter.Access.apply(query, "visits")
+
+	var found []Visit
+	err := query.Order("entered_at desc, id desc").Limit(500).Find(&found).Error
+	if err != nil {
+		return &[]Visit{}, err
+	}
+	return &found, nil
+}
+
+// FindCheckedInPucs lists the PUCs that checked in to the organisation within [from, to)
+func FindCheckedInPucs(db *gorm.DB, organisationID uint64, from, to time.Time) ([]uint64, error) {
+	var pucIDs []uint64
+	err := db.Debug().Model(&CheckIn{}).
+		Where("organisation_id = ? AND checked_in_at >= ? AND checked_in_at < ?", organisationID, from, to).
+		Pluck("DISTINCT puc_id", &pucIDs).Error
+	return pucIDs, err
+}
+
+// RecomputeVisits rebuilds the visits of each PUC around [from, to] from its
+// check-ins, returning how many visits were written. The window is widened to take
+// in every existing visit within one timeout of it, so visits that cross its edges
+// are rebuilt whole rather than cut in two.
+func RecomputeVisits(db *gorm.DB, pucIDs []uint64, from, to time.Time, timeout time.Duration) (int, error) {
+	if timeout <= 0 {
+		timeout = DefaultVisitInactivityTimeout
+	}
+
+	written := 0
+	for _, pucID := range pucIDs {
+		tx := db.Begin()
+		n, err := recomputePucVisits(tx, pucID, from, to, timeout)
+		if err != nil {
+			tx.Rollback()
+			return written, err
+		}
+		err = tx.Commit().Error
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func recomputePucVisits(db *gorm.DB, pucID uint64, from, to time.Time, timeout time.Duration) (int, error) {
+	// locking the PUC keeps concurrent recomputes from writing the same visits twice
+	err := db.Debug().Model(&Puc{}).Set("gorm:query_option", "FOR UPDATE").Where("id = ?", pucID).Take(&Puc{}).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return 0, ErrPucNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// widen the window until no visit straddles its margins
+	for {
+		bounds := struct {
+			EnteredAt *time.Time
+			ExitedAt  *time.Time
+		}{}
+		err = db.Debug().Model(&Visit{}).Select("MIN(entered_at) AS entered_at, MAX(exited_at) AS exited_at").
+			Where("puc_id = ? AND exited_at >= ? AND entered_at <= ?", pucID, from.Add(-timeout), to.Add(timeout)).
+			Scan(&bounds).Error
+		if err != nil {
+			return 0, err
+		}
+
+		widened := false
+		if bounds.EnteredAt != nil && bounds.EnteredAt.Before(from) {
+			from = *bounds.EnteredAt
+			widened = true
+		}
+		if bounds.ExitedAt != nil && bounds.ExitedAt.After(to) {
+			to = *bounds.ExitedAt
+			widened = true
+		}
+		if !widened {
+			break
+		}
+	}
+	from = from.Add(-timeout)
+	to = to.Add(timeout)
+
+	err = db.Debug().Where("puc_id = ? AND exited_at >= ? AND entered_at <= ?", pucID, from, to).Delete(&Visit{}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var checkIns []CheckIn
+	err = db.Debug().Model(&CheckIn{}).
+		Where("puc_id = ? AND checked_in_at >= ? AND checked_in_at <= ?", pucID, from, to).
+		Order("checked_in_at asc, id asc").
+		Find(&checkIns).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sessionInput := make([]visits.CheckIn, len(checkIns))
+	byID := map[uint64]CheckIn{}
+	for i, checkIn := range checkIns {
+		sessionInput[i] = visits.CheckIn{
+			ID:             checkIn.ID,
+			At:             checkIn.CheckedInAt,
+			BeaconID:       checkIn.BeaconID,
+			OrganisationID: checkIn.OrganisationID,
+		}
+		if checkIn.ZoneID != nil {
+			sessionInput[i].ZoneID = *checkIn.ZoneID
+		}
+		if checkIn.UserID != nil {
+			sessionInput[i].UserID = *checkIn.UserID
+		}
+		byID[checkIn.ID] = checkIn
+	}
+
+	sessions := visits.Sessionise(sessionInput, timeout)
+	for _, session := range sessions {
+		// sessions end when the PUC changes hands, so a visit belongs to whoever
+		// held it throughout
+		first := byID[session.FirstCheckInID]
+		visit := Visit{
+			PucID:          pucID,
+			UserID:         first.UserID,
+			Scope:          session.Scope,
+			ScopeID:        session.ScopeID,
+			OrganisationID: first.OrganisationID,
+			EnteredAt:      session.EnteredAt,
+			ExitedAt:       session.ExitedAt,
+			DwellSeconds:   int64(session.Dwell() / time.Second),
+			CheckIns:       session.CheckIns,
+		}
+		err = db.Debug().Model(&Visit{}).Create(&visit).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(sessions), nil
+}
@@ -0,0 +1,145 @@
+package positioning
+
+import (
+	"errors"
+	"math"
+)
+
+// DefaultTxPower is the calibrated RSSI at one metre assumed for beacons that
+// have not been calibrated, typical of iBeacons at their default power
+const DefaultTxPower = -59
+
+// DefaultPathLossExponent models free space. Indoor environments usually sit
+// between 2 and 4.
+const DefaultPathLossExponent = 2.0
+
+// Kalman filter noise suited to RSSI, which drifts slowly but is noisy to read
+const (
+	rssiProcessNoise     = 0.008
+	rssiMeasurementNoise = 4.0
+)
+
+const earthRadiusMetres = 6371000.0
+
+var ErrNotEnoughAnchors = errors.New("at least three beacons are needed to position")
+var ErrCollinearAnchors = errors.New("beacons are in a line so the position is ambiguous")
+
+// Distance estimates how far in metres a receiver is from a beacon using the
+// log-distance path loss model, given the RSSI it heard and the beacon's
+// calibrated RSSI at one metre
+func Distance(rssi float64, txPower int, pathLossExponent float64) float64 {
+	if pathLossExponent <= 0 {
+		pathLossExponent = DefaultPathLossExponent
+	}
+	return math.Pow(10, (float64(txPower)-rssi)/(10*pathLossExponent))
+}
+
+// Kalman is a one dimensional Kalman filter that smooths a series of readings
+type Kalman struct {
+	ProcessNoise     float64
+	MeasurementNoise float64
+	estimate         float64
+	covariance       float64
+	primed           bool
+}
+
+// NewRSSIFilter returns a filter tuned for smoothing RSSI readings
+func NewRSSIFilter() *Kalman {
+	return &Kalman{ProcessNoise: rssiProcessNoise, MeasurementNoise: rssiMeasurementNoise}
+}
+
+// Update folds a reading into the filter and returns the new estimate
+func (k *Kalman) Update(measurement float64) float64 {
+	if !k.primed {
+		k.estimate = measurement
+		k.covariance = k.MeasurementNoise
+		k.primed = true
+		return k.estimate
+	}
+
+	k.covariance += k.ProcessNoise
+	gain := k.covariance / (k.covariance + k.MeasurementNoise)
+	k.estimate += gain * (measurement - k.estimate)
+	k.covariance *= 1 - gain
+	return k.estimate
+}
+
+// SmoothRSSI runs the readings, oldest first, through an RSSI filter and returns
+// the final estimate
+func SmoothRSSI(readings []float64) float64 {
+	filter := NewRSSIFilter()
+	var estimate float64
+	for _, reading := range readings {
+		estimate = filter.Update(reading)
+	}
+	return estimate
+}
+
+// Anchor is a beacon at a known point with the estimated distance to it, all in metres
+type Anchor struct {
+	X        float64
+	Y        float64
+	Distance float64
+}
+
+// Trilaterate finds the point best fitting the distances to three or more
+// anchors by linear least squares. The error is the root mean square difference
+// between the distances to the point and the estimated distances.
+func Trilaterate(anchors []Anchor) (float64, float64, float64, error) {
+	if len(anchors) < 3 {
+		return 0, 0, 0, ErrNotEnoughAnchors
+	}
+
+	// subtracting the last anchor's circle from the others leaves linear equations
+	// a·x + b·y = c, solved through the normal equations
+	last := anchors[len(anchors)-1]
+	var aa, ab, bb, ac, bc float64
+	for _, anchor := range anchors[:len(anchors)-1] {
+		a := 2 * (last.X - anchor.X)
+		b := 2 * (last.Y - anchor.Y)
+		c := anchor.Distance*anchor.Distance - last.Distance*last.Distance -
+			anchor.X*anchor.X + last.X*last.X - anchor.Y*anchor.Y + last.Y*last.Y
+		aa += a * a
+		ab += a * b
+		bb += b * b
+		ac += a * c
+		bc += b * c
+	}
+
+	determinant := aa*bb - ab*ab
+	if math.Abs(determinant) < 1e-9*math.Max(1, aa*bb) {
+		return 0, 0, 0, ErrCollinearAnchors
+	}
+	x := (ac*bb - bc*ab) / determinant
+	y := (bc*aa - ac*ab) / determinant
+
+	var squared float64
+	for _, anchor := range anchors {
+		residual := math.Hypot(x-anchor.X, y-anchor.Y) - anchor.Distance
+		squared += residual * residual
+	}
+	return x, y, math.Sqrt(squared / float64(len(anchors))), nil
+}
+
+// Project converts a coordinate into metres east and north of the origin. The
+// equirectangular approximation is accurate over the size of a site.
+func Project(latitude, longitude, originLatitude, originLongitude float64) (float64, float64) {
+	x := radians(longitude-originLongitude) * math.Cos(radians(originLatitude)) * earthRadiusMetres
+	y := radians(latitude-originLatitude) * earthRadiusMetres
+	return x, y
+}
+
+// Unproject converts metres east and north of the origin back into a coordinate
+func Unproject(x, y, originLatitude, originLongitude float64) (float64, float64) {
+	latitude := originLatitude + degrees(y/earthRadiusMetres)
+	longitude := originLongitude + degrees(x/(earthRadiusMetres*math.Cos(radians(originLatitude))))
+	return latitude, longitude
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows each key a fixed number of attempts per window. It is held in
+// memory, so limits are per process and reset on restart.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	windows map[string]*fixedWindow
+}
+
+type fixedWindow struct {
+	start    time.Time
+	attempts int
+}
+
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		window:  window,
+		windows: map[string]*fixedWindow{},
+	}
+}
+
+// Allow records an attempt for the key, reporting whether it is within the limit
+// and, when it is not, how long until the key may try again
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current, ok := l.windows[key]
+	if !ok || !now.Before(current.start.Add(l.window)) {
+		l.sweep(now)
+		current = &fixedWindow{start: now}
+		l.windows[key] = current
+	}
+
+	if current.attempts >= l.limit {
+		return false, current.start.Add(l.window).Sub(now)
+	}
+	current.attempts++
+	return true, 0
+}
+
+// sweep forgets the windows that have already closed so idle keys do not accumulate
+func (l *Limiter) sweep(now time.Time) {
+	for key, window := range l.windows {
+		if !now.Before(window.start.Add(l.window)) {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -11,6 +11,7 @@ var users = []models.User {
 		Nickname: "Steven victor",
 		Email:    "steven@gmail.com",
 		Password: "password",
+		IsStaff:  true,
 	},
 	models.User{
 		Nickname: "Martin Luther",
@@ -54,22 +55,193 @@ var organisations = []models.Organisation {
 
 }
 
+var beacons = []models.Beacon {
+	{
+		MacAddress: "F0:2A:61:00:00:01",
+	},
+	{
+		MacAddress: "F0:2A:61:00:00:02",
+	},
+	{
+		MacAddress: "F0:2A:61:00:00:03",
+	},
+	{
+		MacAddress: "F0:2A:61:00:00:04",
+	},
+	{
+		MacAddress: "F0:2A:61:00:00:05",
+	},
+}
+
+var pucs = []models.Puc {
+	{
+		SerialNumber: "PUC-0001",
+	},
+	{
+		SerialNumber: "PUC-0002",
+	},
+}
+
 func Load(db *gorm.DB) {
 
-	err := db.Debug().DropTableIfExists(&models.Ticket{}, &models.User{}).Error
+	err := db.Debug().DropTableIfExists(&models.CheckInRejection{}, &models.Gateway{}, &models.BeaconEphemeralID{}, &models.BeaconClaimCode{}, &models.BeaconTransfer{}, &models.Label{}, &models.CheckInNonce{}, &models.BeaconEvent{}, &models.BeaconEventType{}, &models.BeaconTelemetry{}, &models.BeaconStatusTransition{}, &models.OccupancySnapshot{}, &models.Sighting{}, &models.Visit{}, &models.CheckIn{}, &models.PucAlert{}, &models.PucLossReport{}, &models.PucCustody{}, &models.Puc{}, &models.Beacon{}, &models.Location{}, &models.Organisation{}, &models.Ticket{}, &models.User{}).Error
 	if err != nil {
 		log.Fatalf("cannot drop table: %v", err)
 	}
-	err = db.Debug().AutoMigrate(&models.User{}, &models.Ticket{}).Error
+	err = db.Debug().AutoMigrate(&models.User{}, &models.Ticket{}, &models.Organisation{}, &models.Location{}, &models.Beacon{}, &models.Puc{}, &models.PucCustody{}, &models.PucLossReport{}, &models.PucAlert{}, &models.CheckIn{}, &models.Visit{}, &models.Sighting{}, &models.OccupancySnapshot{}, &models.BeaconStatusTransition{}, &models.BeaconTelemetry{}, &models.BeaconEventType{}, &models.BeaconEvent{}, &models.CheckInNonce{}, &models.Label{}, &models.BeaconTransfer{}, &models.BeaconClaimCode{}, &models.BeaconEphemeralID{}, &models.Gateway{}, &models.CheckInRejection{}).Error
 	if err != nil {
 		log.Fatalf("cannot migrate table: %v", err)
 	}
+	err = models.CreateBeaconIdentityIndexes(db)
+	if err != nil {
+		log.Fatalf("cannot create beacon identity indexes: %v", err)
+	}
 
 	err = db.Debug().Model(&models.Ticket{}).AddForeignKey("author_id", "users(id)", "cascade", "cascade").Error
 	if err != nil {
 		log.Fatalf("attaching foreign key error: %v", err)
 	}
 
+	err = db.Debug().Model(&models.BeaconStatusTransition{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.BeaconTelemetry{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.BeaconEvent{}).AddForeignKey("beacon_id", "beacons(id)", "restrict", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.BeaconEvent{}).AddForeignKey("event_type", "beacon_event_types(event_type)", "restrict", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Location{}).AddForeignKey("organisation_id", "organisations(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Location{}).AddForeignKey("parent_id", "locations(id)", "restrict", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Beacon{}).AddForeignKey("zone_id", "locations(id)", "set null", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.BeaconTransfer{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.BeaconClaimCode{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Puc{}).AddForeignKey("current_user_id", "users(id)", "set null", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Puc{}).AddForeignKey("last_beacon_checked_into_id", "beacons(id)", "set null", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.PucCustody{}).AddForeignKey("puc_id", "pucs(id)", "restrict", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.PucLossReport{}).AddForeignKey("puc_id", "pucs(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.PucAlert{}).AddForeignKey("puc_id", "pucs(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.PucAlert{}).AddForeignKey("loss_report_id", "puc_loss_reports(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.PucAlert{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.CheckIn{}).AddForeignKey("puc_id", "pucs(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.CheckIn{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Visit{}).AddForeignKey("puc_id", "pucs(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Sighting{}).AddForeignKey("puc_id", "pucs(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Sighting{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.OccupancySnapshot{}).AddForeignKey("organisation_id", "organisations(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.OccupancySnapshot{}).AddForeignKey("zone_id", "locations(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.CheckInNonce{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.BeaconEphemeralID{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.Gateway{}).AddForeignKey("organisation_id", "organisations(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = db.Debug().Model(&models.CheckInRejection{}).AddForeignKey("beacon_id", "beacons(id)", "cascade", "cascade").Error
+	if err != nil {
+		log.Fatalf("attaching foreign key error: %v", err)
+	}
+
+	err = models.SeedBeaconEventTypes(db)
+	if err != nil {
+		log.Fatalf("cannot seed beacon event types table: %v", err)
+	}
+
 	for i, _ := range users {
 		err = db.Debug().Model(&models.User{}).Create(&users[i]).Error
 		if err != nil {
@@ -82,4 +254,35 @@ func Load(db *gorm.DB) {
 			log.Fatalf("cannot seed tickets table: %v", err)
 		}
 	}
+
+	for i, _ := range organisations {
+		organisations[i].AdministratorID = uint64(users[0].ID)
+		err = db.Debug().Model(&models.Organisation{}).Create(&organisations[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed organisations table: %v", err)
+		}
+
+		err = db.Debug().Model(&models.Beacon{}).Create(&beacons[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed beacons table: %v", err)
+		}
+
+		// owned beacons are registered through the lifecycle, like any other
+		err = beacons[i].RegisterBeacon(db, organisations[i], users[0].ID, "seeded")
+		if err != nil {
+			log.Fatalf("cannot register seeded beacon: %v", err)
+		}
+	}
+
+	for i, _ := range pucs {
+		err = db.Debug().Model(&models.Puc{}).Create(&pucs[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed pucs table: %v", err)
+		}
+
+		_, err = pucs[i].CheckOutPuc(db, users[i].ID, users[0].ID, "", false)
+		if err != nil {
+			log.Fatalf("cannot seed puc custody table: %v", err)
+		}
+	}
 }
@@ -0,0 +1,123 @@
+package visits
+
+import (
+	"sort"
+	"time"
+)
+
+// Scopes a visit can be measured at, from the narrowest to the widest
+const (
+	ScopeBeacon       = "beacon"
+	ScopeZone         = "zone"
+	ScopeOrganisation = "organisation"
+)
+
+// Scopes lists every scope a check-in is sessionised at
+var Scopes = []string{ScopeBeacon, ScopeZone, ScopeOrganisation}
+
+// CheckIn is one check-in of a PUC with the place it happened at every scope. A
+// zero ID means the check-in was outside any place of that scope, such as a
+// beacon that is not in a zone. UserID is who held the PUC, zero when nobody did.
+type CheckIn struct {
+	ID             uint64
+	At             time.Time
+	UserID         uint32
+	BeaconID       uint64
+	ZoneID         uint64
+	OrganisationID uint64
+}
+
+// ScopeID returns the place the check-in happened at the given scope
+func (c CheckIn) ScopeID(scope string) uint64 {
+	switch scope {
+	case ScopeBeacon:
+		return c.BeaconID
+	case ScopeZone:
+		return c.ZoneID
+	case ScopeOrganisation:
+		return c.OrganisationID
+	}
+	return 0
+}
+
+// Session is a run of consecutive check-ins at the same place by the same holder,
+// each within the inactivity timeout of the one before. It is entered at the
+// first check-in and exited at the last, so a session of one check-in has no
+// dwell time.
+type Session struct {
+	Scope          string
+	ScopeID        uint64
+	UserID         uint32
+	EnteredAt      time.Time
+	ExitedAt       time.Time
+	FirstCheckInID uint64
+	CheckIns       int
+}
+
+// Dwell is how long the session lasted
+func (s Session) Dwell() time.Duration {
+	return s.ExitedAt.Sub(s.EnteredAt)
+}
+
+// Sessionise groups the check-ins of a single PUC into sessions at every scope.
+// A session ends when the PUC checks in somewhere else at that scope, changes
+// hands, or goes longer than the timeout without checking in. Sessions are returned in the
+// order they were entered.
+func Sessionise(checkIns []CheckIn, timeout time.Duration) []Session {
+	ordered := make([]CheckIn, len(checkIns))
+	copy(ordered, checkIns)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].At.Equal(ordered[j].At) {
+			return ordered[i].ID < ordered[j].ID
+		}
+		return ordered[i].At.Before(ordered[j].At)
+	})
+
+	var sessions []Session
+	for _, scope := range Scopes {
+		var current *Session
+		for _, checkIn := range ordered {
+			scopeID := checkIn.ScopeID(scope)
+			if current != nil && current.ScopeID == scopeID && current.UserID == checkIn.UserID &&
+				checkIn.At.Sub(current.ExitedAt) <= timeout {
+				current.ExitedAt = checkIn.At
+				current.CheckIns++
+				continue
+			}
+
+			if current != nil {
+				sessions = append(sessions, *current)
+				current = nil
+			}
+			if scopeID != 0 {
+				current = &Session{
+					Scope:          scope,
+					ScopeID:        scopeID,
+					UserID:         checkIn.UserID,
+					EnteredAt:      checkIn.At,
+					ExitedAt:       checkIn.At,
+					FirstCheckInID: checkIn.ID,
+					CheckIns:       1,
+				}
+			}
+		}
+		if current != nil {
+			sessions = append(sessions, *current)
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].EnteredAt.Before(sessions[j].EnteredAt)
+	})
+	return sessions
+}
+
+// ValidScope reports whether scope is one visits are measured at
+func ValidScope(scope string) bool {
+	for _, known := range Scopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
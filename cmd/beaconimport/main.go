@@ -0,0 +1,73 @@
+// Command beaconimport registers beacons in bulk from a CSV or JSON file using
+// the same import rules as the /beacons/import endpoint.
+//
+//	go run ./cmd/beaconimport -file beacons.csv -dry-run
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/beaconimport"
+	"github.com/SherbazHashmi/goblog/api/controllers"
+	"github.com/joho/godotenv"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	file := flag.String("file", "", "path to the CSV or JSON file to import")
+	format := flag.String("format", "", "csv or json, inferred from the file extension when omitted")
+	dryRun := flag.Bool("dry-run", false, "report the results without saving any beacons")
+	flag.Parse()
+
+	if *file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("unable to open import file: %v", err)
+	}
+	defer input.Close()
+
+	var rows []beaconimport.Row
+	switch *format {
+	case "csv":
+		rows, err = beaconimport.ParseCSV(input)
+	case "json":
+		rows, err = beaconimport.ParseJSON(input)
+	default:
+		log.Fatalf("unsupported import format %q", *format)
+	}
+	if err != nil {
+		log.Fatalf("unable to read import file: %v", err)
+	}
+
+	err = godotenv.Load()
+	if err != nil {
+		log.Fatalf("Error getting envionrment, %v", err)
+	}
+
+	server := controllers.Server{}
+	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PORT"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
+
+	// the command runs with the database's own credentials, so every row is allowed
+	report, err := beaconimport.Import(server.DB, rows, beaconimport.Options{DryRun: *dryRun})
+	if err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+
+	output, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(output))
+}
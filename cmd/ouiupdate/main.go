@@ -0,0 +1,83 @@
+// Command ouiupdate refreshes the vendor table embedded by the macaddress
+// package from the IEEE MA-L registry, dropping the address column.
+//
+//	go run ./cmd/ouiupdate -out api/macaddress/oui.csv
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+const registryURL = "https://standards-oui.ieee.org/oui/oui.csv"
+
+func main() {
+	source := flag.String("source", registryURL, "URL or path of the IEEE MA-L registry export")
+	out := flag.String("out", "api/macaddress/oui.csv", "path of the vendor table to write")
+	flag.Parse()
+
+	input, err := open(*source)
+	if err != nil {
+		log.Fatalf("unable to read the registry: %v", err)
+	}
+	defer input.Close()
+
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		log.Fatalf("unable to parse the registry: %v", err)
+	}
+	if len(records) < 2 {
+		log.Fatalf("the registry is empty")
+	}
+
+	// skip the header row and anything that is not a 24 bit assignment
+	var rows [][]string
+	for _, record := range records[1:] {
+		if len(record) < 3 || record[0] != "MA-L" || len(record[1]) != 6 {
+			continue
+		}
+		rows = append(rows, []string{"MA-L", strings.ToUpper(record[1]), strings.TrimSpace(record[2])})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i][1] < rows[j][1]
+	})
+
+	output, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("unable to create the vendor table: %v", err)
+	}
+	defer output.Close()
+
+	writer := csv.NewWriter(output)
+	writer.Write([]string{"Registry", "Assignment", "Organization Name"})
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		log.Fatalf("unable to write the vendor table: %v", err)
+	}
+	fmt.Printf("wrote %d assignments to %s\n", len(rows), *out)
+}
+
+// open reads the registry from a URL or a file already downloaded
+func open(source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+	response, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+	return response.Body, nil
+}
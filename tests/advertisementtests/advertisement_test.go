@@ -0,0 +1,100 @@
+package advertisementtests
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"gopkg.in/go-playground/assert.v1"
+	"testing"
+)
+
+const flags = "020106"
+
+func TestParseIBeacon(t *testing.T) {
+	payload := flags + "1AFF4C000215" + "E2C56DB5DFFB48D2B060D0F5A71096E0" + "0001" + "0002" + "C5"
+
+	adv, err := advertisement.ParseHex(payload)
+	if err != nil {
+		t.Errorf("this is the error parsing the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, adv.IBeacon.UUID, "E2C56DB5-DFFB-48D2-B060-D0F5A71096E0")
+	assert.Equal(t, adv.IBeacon.Major, uint16(1))
+	assert.Equal(t, adv.IBeacon.Minor, uint16(2))
+	assert.Equal(t, adv.IBeacon.TxPower, int8(-59))
+	assert.Equal(t, adv.EddystoneUID == nil, true)
+}
+
+func TestParseEddystoneUID(t *testing.T) {
+	payload := flags + "0303AAFE" + "1716AAFE00E7" + "EDD1EBEAC04E5DEFA017" + "0BDB87539B67" + "0000"
+
+	adv, err := advertisement.ParseHex(payload)
+	if err != nil {
+		t.Errorf("this is the error parsing the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, adv.EddystoneUID.Namespace, "EDD1EBEAC04E5DEFA017")
+	assert.Equal(t, adv.EddystoneUID.Instance, "0BDB87539B67")
+	assert.Equal(t, adv.EddystoneUID.TxPower, int8(-25))
+}
+
+func TestParseEddystoneURL(t *testing.T) {
+	payload := flags + "0303AAFE" + "0E16AAFE10EB01" + "6578616D706C65" + "00"
+
+	adv, err := advertisement.ParseHex(payload)
+	if err != nil {
+		t.Errorf("this is the error parsing the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, adv.EddystoneURL.URL, "https://www.example.com/")
+	assert.Equal(t, adv.EddystoneURL.TxPower, int8(-21))
+}
+
+func TestParseEddystoneTLM(t *testing.T) {
+	payload := flags + "0303AAFE" + "1116AAFE20" + "00" + "0BB8" + "1980" + "00000100" + "00002710"
+
+	adv, err := advertisement.ParseHex(payload)
+	if err != nil {
+		t.Errorf("this is the error parsing the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, adv.EddystoneTLM.BatteryMillivolts, uint16(3000))
+	assert.Equal(t, *adv.EddystoneTLM.Temperature, 25.5)
+	assert.Equal(t, adv.EddystoneTLM.AdvertisementCount, uint32(256))
+	assert.Equal(t, adv.EddystoneTLM.UptimeDeciseconds, uint32(10000))
+
+	// temperature is optional
+	adv, err = advertisement.ParseHex(flags + "0303AAFE" + "1116AAFE20" + "00" + "0BB8" + "8000" + "00000100" + "00002710")
+	if err != nil {
+		t.Errorf("this is the error parsing the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, adv.EddystoneTLM.Temperature == nil, true)
+}
+
+func TestParseErrors(t *testing.T) {
+	samples := []struct {
+		payload string
+		err     error
+	}{
+		{payload: "zz", err: advertisement.ErrMalformed},
+		{payload: flags + "1AFF4C000215E2C5", err: advertisement.ErrMalformed},
+		{payload: flags + "05FF4C000215", err: advertisement.ErrMalformed},
+		{payload: flags + "0E16AAFE10EB09" + "6578616D706C65" + "00", err: advertisement.ErrMalformed},
+		{payload: flags, err: advertisement.ErrNoBeaconFrame},
+		{payload: flags + "05FF59000102", err: advertisement.ErrNoBeaconFrame},
+	}
+
+	for _, v := range samples {
+		_, err := advertisement.ParseHex(v.payload)
+		assert.Equal(t, errors.Is(err, v.err), true)
+	}
+}
+
+func TestNormalizeUUID(t *testing.T) {
+	uuid, err := advertisement.NormalizeUUID("e2c56db5dffb48d2b060d0f5a71096e0")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, uuid, "E2C56DB5-DFFB-48D2-B060-D0F5A71096E0")
+
+	_, err = advertisement.NormalizeUUID("e2c56db5")
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,61 @@
+package advertisementtests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"gopkg.in/go-playground/assert.v1"
+	"testing"
+	"time"
+)
+
+const identityKey = "E2C56DB5DFFB48D2B060D0F5A71096E0"
+
+func TestComputeEIDRotation(t *testing.T) {
+	first, err := advertisement.ComputeEID(identityKey, 10, 1024*500)
+	if err != nil {
+		t.Errorf("this is the error computing the eid: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(first), 16)
+
+	// the id only changes once the rotation period has passed
+	samePeriod, _ := advertisement.ComputeEID(identityKey, 10, 1024*500+1023)
+	assert.Equal(t, samePeriod, first)
+
+	nextPeriod, _ := advertisement.ComputeEID(identityKey, 10, 1024*501)
+	assert.NotEqual(t, nextPeriod, first)
+
+	otherKey, _ := advertisement.ComputeEID("00000000000000000000000000000001", 10, 1024*500)
+	assert.NotEqual(t, otherKey, first)
+
+	assert.Equal(t, advertisement.EIDRotationPeriod(10), 1024*time.Second)
+}
+
+func TestComputeEIDErrors(t *testing.T) {
+	_, err := advertisement.ComputeEID("E2C56DB5", 10, 0)
+	assert.Equal(t, err, advertisement.ErrInvalidIdentityKey)
+
+	_, err = advertisement.ComputeEID(identityKey, 16, 0)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestParsedEIDMatchesComputed(t *testing.T) {
+	eid, err := advertisement.ComputeEID(identityKey, 10, advertisement.EIDCounter(time.Now()))
+	if err != nil {
+		t.Errorf("this is the error computing the eid: %v\n", err)
+		return
+	}
+
+	adv, err := advertisement.ParseHex(flags + "0303AAFE" + "0D16AAFE30E7" + eid)
+	if err != nil {
+		t.Errorf("this is the error parsing the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, adv.EddystoneEID.EphemeralID, eid)
+
+	normalized, err := advertisement.NormalizeEphemeralID(" " + "abcdef0123456789")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, normalized, "ABCDEF0123456789")
+
+	_, err = advertisement.NormalizeEphemeralID("abcdef")
+	assert.Equal(t, err, advertisement.ErrInvalidEphemeralID)
+}
@@ -0,0 +1,59 @@
+package beaconimporttests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/beaconimport"
+	"gopkg.in/go-playground/assert.v1"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	input := "Placement,mac_address,organisation_id\n" +
+		"front door,aa:bb:cc:dd:ee:01,1\n" +
+		"\"kitchen, rear\",AA-BB-CC-DD-EE-02,\n"
+
+	rows, err := beaconimport.ParseCSV(strings.NewReader(input))
+	if err != nil {
+		t.Errorf("this is the error parsing the csv: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(rows), 2)
+	assert.Equal(t, rows[0].MacAddress, "aa:bb:cc:dd:ee:01")
+	assert.Equal(t, rows[0].OrganisationID, uint64(1))
+	assert.Equal(t, rows[0].Placement, "front door")
+	assert.Equal(t, rows[1].OrganisationID, uint64(0))
+	assert.Equal(t, rows[1].Placement, "kitchen, rear")
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	samples := []string{
+		"",
+		"organisation_id,placement\n1,front door\n",
+		"mac_address,organisation_id\naa:bb:cc:dd:ee:01,one\n",
+	}
+
+	for _, v := range samples {
+		_, err := beaconimport.ParseCSV(strings.NewReader(v))
+		assert.NotEqual(t, err, nil)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	input := `[
+		{"mac_address": "aa:bb:cc:dd:ee:01", "organisation_id": 2, "placement": "bar"},
+		{"mac_address": "aabbccddee02"}
+	]`
+
+	rows, err := beaconimport.ParseJSON(strings.NewReader(input))
+	if err != nil {
+		t.Errorf("this is the error parsing the json: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(rows), 2)
+	assert.Equal(t, rows[0].OrganisationID, uint64(2))
+	assert.Equal(t, rows[0].Placement, "bar")
+	assert.Equal(t, rows[1].MacAddress, "aabbccddee02")
+
+	_, err = beaconimport.ParseJSON(strings.NewReader(`{"mac_address": "aa:bb:cc:dd:ee:01"}`))
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,99 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/beaconimport"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestImportBeacons(t *testing.T) {
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user %v\n", err)
+	}
+	organisation, _, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.DB.Model(&organisation).Update("administrator_id", user.ID).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := fmt.Sprintf("Bearer %v", token)
+
+	inputCSV := "mac_address,organisation_id,placement\n" +
+		fmt.Sprintf("f0-2a-61-00-00-20,%d,front door\n", organisation.ID) +
+		fmt.Sprintf("F0:2A:61:00:00:20,%d,back door\n", organisation.ID) +
+		fmt.Sprintf("f0:2a:61:00:00:01,%d,\n", organisation.ID) +
+		"not a mac,,\n" +
+		"F0:2A:61:00:00:21,9999,\n" +
+		// only staff import beacons without an organisation
+		"F0:2A:61:00:00:22,,\n"
+
+	samples := []struct {
+		url     string
+		created int
+		beacons int
+	}{
+		{
+			url:     "/beacons/import?format=csv&dry_run=true",
+			created: 1,
+			beacons: 2,
+		},
+		{
+			url:     "/beacons/import?format=csv",
+			created: 1,
+			beacons: 3,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", v.url, bytes.NewBufferString(inputCSV))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.ImportBeacons)
+
+		req.Header.Set("Authorization", tokenString)
+		handler.ServeHTTP(rr, req)
+
+		report := beaconimport.Report{}
+		err = json.Unmarshal([]byte(rr.Body.String()), &report)
+		if err != nil {
+			t.Errorf("Cannot convert to json: %v", err)
+		}
+		assert.Equal(t, rr.Code, http.StatusOK)
+		assert.Equal(t, report.Counts[beaconimport.StatusCreated], v.created)
+		assert.Equal(t, report.Counts[beaconimport.StatusDuplicate], 2)
+		assert.Equal(t, report.Counts[beaconimport.StatusInvalidMac], 1)
+		assert.Equal(t, report.Counts[beaconimport.StatusUnknownOrganisation], 1)
+		assert.Equal(t, report.Counts[beaconimport.StatusUnauthorized], 1)
+		assert.Equal(t, report.Results[0].MacAddress, "F0:2A:61:00:00:20")
+
+		count := 0
+		server.DB.Model(&models.Beacon{}).Count(&count)
+		assert.Equal(t, count, v.beacons)
+	}
+
+	// imported beacons are registered with their organisation
+	beacon := models.Beacon{}
+	_, err = beacon.FindBeaconByMacAddress(server.DB, "F0:2A:61:00:00:20")
+	if err != nil {
+		t.Errorf("this is the error finding the imported beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, beacon.Status, models.BeaconStatusRegistered)
+	assert.Equal(t, beacon.OrganisationID, organisation.ID)
+}
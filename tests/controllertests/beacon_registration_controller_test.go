@@ -0,0 +1,208 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestBeaconRegistrationLifecycle(t *testing.T) {
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user %v\n", err)
+	}
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.DB.Model(&organisation).Update("administrator_id", user.ID).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := fmt.Sprintf("Bearer %v", token)
+
+	samples := []struct {
+		handler      http.HandlerFunc
+		inputJSON    string
+		tokenGiven   string
+		statusCode   int
+		status       string
+		historyCount int
+		keyed        bool
+	}{
+		{
+			handler:    server.RegisterBeacon,
+			inputJSON:  fmt.Sprintf(`{"organisation_id": %d, "reason": "installed"}`, organisation.ID),
+			tokenGiven: "",
+			statusCode: 401,
+		},
+		{
+			handler:    server.SuspendBeacon,
+			inputJSON:  `{"reason": "not yet registered"}`,
+			tokenGiven: tokenString,
+			statusCode: 409,
+		},
+		{
+			handler:      server.RegisterBeacon,
+			inputJSON:    fmt.Sprintf(`{"organisation_id": %d, "reason": "installed"}`, organisation.ID),
+			tokenGiven:   tokenString,
+			statusCode:   200,
+			status:       models.BeaconStatusRegistered,
+			historyCount: 1,
+			keyed:        true,
+		},
+		{
+			handler:      server.SuspendBeacon,
+			inputJSON:    `{"reason": "moved to storage"}`,
+			tokenGiven:   tokenString,
+			statusCode:   200,
+			status:       models.BeaconStatusSuspended,
+			historyCount: 2,
+		},
+		{
+			handler:      server.DeregisterBeacon,
+			inputJSON:    `{"reason": "sold"}`,
+			tokenGiven:   tokenString,
+			statusCode:   200,
+			status:       models.BeaconStatusUnclaimed,
+			historyCount: 3,
+		},
+		{
+			// registering the beacon again provisions a new check-in key
+			handler:      server.RegisterBeacon,
+			inputJSON:    fmt.Sprintf(`{"organisation_id": %d, "reason": "reinstalled"}`, organisation.ID),
+			tokenGiven:   tokenString,
+			statusCode:   200,
+			status:       models.BeaconStatusRegistered,
+			historyCount: 4,
+			keyed:        true,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/beacons", bytes.NewBufferString(v.inputJSON))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(beacons[0].ID))})
+		rr := httptest.NewRecorder()
+
+		req.Header.Set("Authorization", v.tokenGiven)
+		v.handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 200 {
+			response := struct {
+				Beacon    models.Beacon                   `json:"beacon"`
+				History   []models.BeaconStatusTransition `json:"history"`
+				SecretKey string                          `json:"secret_key"`
+			}{}
+			err = json.Unmarshal([]byte(rr.Body.String()), &response)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.Equal(t, response.Beacon.Status, v.status)
+			assert.Equal(t, len(response.History), v.historyCount)
+			assert.Equal(t, response.SecretKey != "", v.keyed)
+		}
+	}
+}
+
+func TestBeaconRegistrationAuthorization(t *testing.T) {
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	err = server.DB.Model(&users[1]).Update("is_staff", true).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	organisation, _, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	beacon := models.Beacon{MacAddress: "F0:2A:61:00:00:03"}
+	err = server.DB.Model(&models.Beacon{}).Create(&beacon).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	samples := []struct {
+		handler    http.HandlerFunc
+		inputJSON  string
+		tokenGiven string
+		statusCode int
+		status     string
+	}{
+		{
+			// nobody but the organisation's administrator or staff attaches beacons to it
+			handler:    server.RegisterBeacon,
+			inputJSON:  fmt.Sprintf(`{"organisation_id": %d, "reason": "installed"}`, organisation.ID),
+			tokenGiven: tokens[0],
+			statusCode: 401,
+		},
+		{
+			// a beacon no organisation owns is managed by staff
+			handler:    server.DecommissionBeacon,
+			inputJSON:  `{"reason": "broken"}`,
+			tokenGiven: tokens[0],
+			statusCode: 401,
+		},
+		{
+			handler:    server.RegisterBeacon,
+			inputJSON:  fmt.Sprintf(`{"organisation_id": %d, "reason": "installed"}`, organisation.ID),
+			tokenGiven: tokens[1],
+			statusCode: 200,
+			status:     models.BeaconStatusPending,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/beacons", bytes.NewBufferString(v.inputJSON))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(beacon.ID))})
+		rr := httptest.NewRecorder()
+
+		req.Header.Set("Authorization", v.tokenGiven)
+		v.handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 200 {
+			response := struct {
+				Beacon models.Beacon `json:"beacon"`
+			}{}
+			err = json.Unmarshal([]byte(rr.Body.String()), &response)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.Equal(t, response.Beacon.Status, v.status)
+		}
+	}
+}
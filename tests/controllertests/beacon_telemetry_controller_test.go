@@ -0,0 +1,81 @@
+package controllertests
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCreateBeaconTelemetry(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = models.SeedBeaconEventTypes(server.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	err = server.DB.Model(&organisation).Update("administrator_id", users[0].ID).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	gateway, err := models.CreateGateway(server.DB, organisation.ID, "front door", users[0].ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token, err := server.SignIn(users[1].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	samples := []struct {
+		tokenGiven string
+		keyGiven   string
+		statusCode int
+	}{
+		{
+			statusCode: 401,
+		},
+		{
+			// only the beacon's administrator or its organisation's gateways report telemetry
+			tokenGiven: fmt.Sprintf("Bearer %v", token),
+			statusCode: 401,
+		},
+		{
+			keyGiven:   gateway.Key,
+			statusCode: 201,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/beacons/telemetry", bytes.NewBufferString(`{"battery_millivolts": 3000}`))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(beacons[0].ID))})
+		req.Header.Set("Authorization", v.tokenGiven)
+		if v.keyGiven != "" {
+			req.Header.Set("X-Gateway-Key", v.keyGiven)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.CreateBeaconTelemetry).ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
@@ -0,0 +1,420 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCreateBeacon(t *testing.T) {
+	organisation, _, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	err = server.DB.Model(&organisation).Update("administrator_id", users[0].ID).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.DB.Model(&users[1]).Update("is_staff", true).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	samples := []struct {
+		inputJSON    string
+		statusCode   int
+		macAddress   string
+		registered   bool
+		tokenGiven   string
+		errorMessage string
+	}{
+		{
+			// a beacon created for an organisation is registered to it
+			inputJSON:  fmt.Sprintf(`{"mac_address": "F0:2A:61:00:00:10", "organisation_id": %d}`, organisation.ID),
+			statusCode: 201,
+			tokenGiven: tokens[0],
+			macAddress: "F0:2A:61:00:00:10",
+			registered: true,
+		},
+		{
+			inputJSON:  `{"mac_address": "F0:2A:61:00:00:13"}`,
+			statusCode: 201,
+			tokenGiven: tokens[1],
+			macAddress: "F0:2A:61:00:00:13",
+		},
+		{
+			inputJSON:    `{"mac_address": "F0:2A:61:00:00:10"}`,
+			statusCode:   500,
+			tokenGiven:   tokens[1],
+			errorMessage: "Mac Address already registered",
+		},
+		{
+			// The same hardware written in a different form
+			inputJSON:    `{"mac_address": "f0-2a-61-00-00-10"}`,
+			statusCode:   500,
+			tokenGiven:   tokens[1],
+			errorMessage: "Mac Address already registered",
+		},
+		{
+			inputJSON:    `{"mac_address": "F0:2A:61:00:00"}`,
+			statusCode:   422,
+			tokenGiven:   tokens[1],
+			errorMessage: `invalid mac address: "F0:2A:61:00:00"`,
+		},
+		{
+			inputJSON:    `{"mac_address": ""}`,
+			statusCode:   422,
+			tokenGiven:   tokens[1],
+			errorMessage: "unable to update Beacon object as no Mac Address provided",
+		},
+		{
+			inputJSON:    `{"mac_address": "F0:2A:61:00:00:11", "organisation_id": 9999}`,
+			statusCode:   422,
+			tokenGiven:   tokens[1],
+			errorMessage: "organisation not found",
+		},
+		{
+			// only staff create beacons no organisation owns
+			inputJSON:    `{"mac_address": "F0:2A:61:00:00:12"}`,
+			statusCode:   401,
+			tokenGiven:   tokens[0],
+			errorMessage: "Unauthorized",
+		},
+		{
+			// only the organisation's administrator creates beacons for it
+			inputJSON:    fmt.Sprintf(`{"mac_address": "F0:2A:61:00:00:12", "organisation_id": %d}`, organisation.ID),
+			statusCode:   401,
+			tokenGiven:   tokens[1],
+			errorMessage: "Unauthorized",
+		},
+		{
+			// When no token is passed
+			inputJSON:    `{"mac_address": "F0:2A:61:00:00:12"}`,
+			statusCode:   401,
+			tokenGiven:   "",
+			errorMessage: "Unauthorized",
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/beacons", bytes.NewBufferString(v.inputJSON))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.CreateBeacon)
+
+		req.Header.Set("Authorization", v.tokenGiven)
+		handler.ServeHTTP(rr, req)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+		if err != nil {
+			fmt.Printf("Cannot convert to json: %v", err)
+		}
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 201 {
+			assert.Equal(t, responseMap["mac_address"], v.macAddress)
+			assert.Equal(t, responseMap["is_registered"], v.registered)
+		}
+		if v.statusCode == 401 || v.statusCode == 422 || v.statusCode == 500 && v.errorMessage != "" {
+			assert.Equal(t, responseMap["error"], v.errorMessage)
+		}
+	}
+}
+
+func TestGetBeacons(t *testing.T) {
+	_, _, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "/beacons", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetBeacons)
+	handler.ServeHTTP(rr, req)
+
+	var beacons []models.Beacon
+	err = json.Unmarshal([]byte(rr.Body.String()), &beacons)
+	if err != nil {
+		log.Fatalf("Unable to convert response to JSON: %v\n", err)
+	}
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, len(beacons), 2)
+}
+
+func TestGetBeaconByID(t *testing.T) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	beaconSample := []struct {
+		id         string
+		statusCode int
+		macAddress string
+	}{
+		{
+			id:         strconv.Itoa(int(beacons[0].ID)),
+			statusCode: 200,
+			macAddress: beacons[0].MacAddress,
+		},
+		{
+			id:         "9999",
+			statusCode: 404,
+		},
+		{
+			id:         "unknown",
+			statusCode: 400,
+		},
+	}
+
+	for _, v := range beaconSample {
+		req, err := http.NewRequest("GET", "/beacons", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": v.id})
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.GetBeacon)
+		handler.ServeHTTP(rr, req)
+
+		responseMap := make(map[string]interface{})
+		err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+		if err != nil {
+			log.Fatalf("Cannot convert to json: %v", err)
+		}
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 200 {
+			assert.Equal(t, responseMap["mac_address"], v.macAddress)
+		}
+	}
+}
+
+func TestGetOrganisationBeacons(t *testing.T) {
+	organisation, _, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "/organisations", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(organisation.ID))})
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetOrganisationBeacons)
+	handler.ServeHTTP(rr, req)
+
+	var beacons []models.Beacon
+	err = json.Unmarshal([]byte(rr.Body.String()), &beacons)
+	if err != nil {
+		log.Fatalf("Unable to convert response to JSON: %v\n", err)
+	}
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, len(beacons), 2)
+
+	req = mux.SetURLVars(req, map[string]string{"id": "9999"})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusNotFound)
+}
+
+func TestDeleteBeacon(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Cannot seed user %v\n", err)
+	}
+	err = server.DB.Model(&organisation).Update("administrator_id", user.ID).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := server.SignIn(user.Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	tokenString := fmt.Sprintf("Bearer %v", token)
+
+	// anybody else is not allowed to delete the organisation's beacons
+	others, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	otherToken, err := server.SignIn(others[0].Email, "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	otherTokenString := fmt.Sprintf("Bearer %v", otherToken)
+
+	beaconSample := []struct {
+		id         string
+		tokenGiven string
+		statusCode int
+	}{
+		{
+			id:         strconv.Itoa(int(beacons[0].ID)),
+			tokenGiven: tokenString,
+			statusCode: 204,
+		},
+		{
+			id:         strconv.Itoa(int(beacons[0].ID)),
+			tokenGiven: tokenString,
+			statusCode: 404,
+		},
+		{
+			id:         strconv.Itoa(int(beacons[1].ID)),
+			tokenGiven: "",
+			statusCode: 401,
+		},
+		{
+			id:         strconv.Itoa(int(beacons[1].ID)),
+			tokenGiven: otherTokenString,
+			statusCode: 401,
+		},
+		{
+			id:         "unknown",
+			tokenGiven: tokenString,
+			statusCode: 400,
+		},
+	}
+
+	for _, v := range beaconSample {
+		req, err := http.NewRequest("DELETE", "/beacons", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": v.id})
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.DeleteBeacon)
+
+		req.Header.Set("Authorization", v.tokenGiven)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
+
+func TestBeaconHeartbeat(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	err = server.DB.Model(&organisation).Update("administrator_id", users[0].ID).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	gateway, err := models.CreateGateway(server.DB, organisation.ID, "front door", users[0].ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	unowned := models.Beacon{MacAddress: "F0:2A:61:00:00:03"}
+	err = server.DB.Model(&models.Beacon{}).Create(&unowned).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	samples := []struct {
+		beaconID   uint64
+		tokenGiven string
+		keyGiven   string
+		statusCode int
+	}{
+		{
+			beaconID:   beacons[0].ID,
+			statusCode: 401,
+		},
+		{
+			// only the beacon's administrator reports it by hand
+			beaconID:   beacons[0].ID,
+			tokenGiven: tokens[1],
+			statusCode: 401,
+		},
+		{
+			beaconID:   beacons[0].ID,
+			tokenGiven: tokens[0],
+			statusCode: 200,
+		},
+		{
+			beaconID:   beacons[0].ID,
+			keyGiven:   "not a gateway key",
+			statusCode: 401,
+		},
+		{
+			beaconID:   beacons[1].ID,
+			keyGiven:   gateway.Key,
+			statusCode: 200,
+		},
+		{
+			// a gateway only reports its own organisation's beacons
+			beaconID:   unowned.ID,
+			keyGiven:   gateway.Key,
+			statusCode: 404,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/beacons/heartbeat", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(v.beaconID))})
+		req.Header.Set("Authorization", v.tokenGiven)
+		if v.keyGiven != "" {
+			req.Header.Set("X-Gateway-Key", v.keyGiven)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.BeaconHeartbeat).ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
@@ -0,0 +1,95 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestIssueBeaconClaimCode(t *testing.T) {
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	err = server.DB.Model(&users[1]).Update("is_staff", true).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, _, err = seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	beacon := models.Beacon{MacAddress: "F0:2A:61:00:00:03"}
+	err = server.DB.Model(&models.Beacon{}).Create(&beacon).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	samples := []struct {
+		tokenGiven string
+		statusCode int
+	}{
+		{
+			tokenGiven: "",
+			statusCode: 401,
+		},
+		{
+			// only staff issue claim codes
+			tokenGiven: tokens[0],
+			statusCode: 401,
+		},
+		{
+			tokenGiven: tokens[1],
+			statusCode: 201,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("POST", "/beacons/claim-codes", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(beacon.ID))})
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.IssueBeaconClaimCode)
+
+		req.Header.Set("Authorization", v.tokenGiven)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 201 {
+			claimCode := models.BeaconClaimCode{}
+			err = json.Unmarshal([]byte(rr.Body.String()), &claimCode)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.Equal(t, claimCode.BeaconID, beacon.ID)
+			assert.Equal(t, claimCode.IssuedByID, users[1].ID)
+			assert.NotEqual(t, claimCode.Code, "")
+		}
+	}
+
+	count := 0
+	server.DB.Model(&models.BeaconClaimCode{}).Count(&count)
+	assert.Equal(t, count, 1)
+}
@@ -0,0 +1,151 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/ingest"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIngestSightingsWithGatewayKey(t *testing.T) {
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.DB.Model(&organisation).Update("administrator_id", users[0].ID).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	unowned := models.Beacon{MacAddress: "F0:2A:61:00:00:03"}
+	err = server.DB.Model(&models.Beacon{}).Create(&unowned).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	puc := models.Puc{SerialNumber: "PUC-0001"}
+	err = server.DB.Model(&models.Puc{}).Create(&puc).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	// only the organisation's administrator issues gateway keys
+	createGateway := func(token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/organisations/gateways", bytes.NewBufferString(`{"name":"front door"}`))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(organisation.ID))})
+		req.Header.Set("Authorization", token)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.CreateGateway).ServeHTTP(rr, req)
+		return rr
+	}
+	rr := createGateway(tokens[1])
+	assert.Equal(t, rr.Code, 401)
+	rr = createGateway(tokens[0])
+	assert.Equal(t, rr.Code, 201)
+
+	gateway := models.Gateway{}
+	err = json.Unmarshal([]byte(rr.Body.String()), &gateway)
+	if err != nil {
+		t.Errorf("Cannot convert to json: %v", err)
+	}
+	assert.Equal(t, gateway.OrganisationID, organisation.ID)
+	assert.NotEqual(t, gateway.Key, "")
+
+	now := time.Now().Unix()
+	batch := fmt.Sprintf(`[
+		{"beacon_id":%d,"puc_id":%d,"rssi":-70,"timestamp":%d},
+		{"beacon_id":%d,"puc_id":%d,"rssi":-70,"timestamp":%d}
+	]`, beacons[0].ID, puc.ID, now, unowned.ID, puc.ID, now)
+
+	ingestSightings := func(key string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/ingest/sightings", bytes.NewBufferString(batch))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("X-Gateway-Key", key)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(server.IngestSightings).ServeHTTP(rr, req)
+		return rr
+	}
+
+	samples := []struct {
+		keyGiven   string
+		statusCode int
+	}{
+		{
+			keyGiven:   "",
+			statusCode: 401,
+		},
+		{
+			keyGiven:   "not a gateway key",
+			statusCode: 401,
+		},
+		{
+			keyGiven:   gateway.Key,
+			statusCode: 200,
+		},
+	}
+	for _, v := range samples {
+		rr = ingestSightings(v.keyGiven)
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 200 {
+			ack := ingest.Ack{}
+			err = json.Unmarshal([]byte(rr.Body.String()), &ack)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			// the beacon outside the gateway's organisation is not resolved
+			assert.Equal(t, ack.Accepted, 1)
+			assert.Equal(t, ack.Rejected, 1)
+		}
+	}
+
+	// sightings are recorded against the gateway the key belongs to
+	sighting := models.Sighting{}
+	err = server.DB.Model(&models.Sighting{}).Take(&sighting).Error
+	if err != nil {
+		t.Errorf("this is the error finding the sighting: %v\n", err)
+	}
+	assert.Equal(t, sighting.GatewayID, gateway.ID)
+
+	// a revoked key is no longer accepted
+	req, err := http.NewRequest("DELETE", "/gateways", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(gateway.ID))})
+	req.Header.Set("Authorization", tokens[0])
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(server.RevokeGateway).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 200)
+
+	rr = ingestSightings(gateway.Key)
+	assert.Equal(t, rr.Code, 401)
+}
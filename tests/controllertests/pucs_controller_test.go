@@ -0,0 +1,323 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestGetPuc(t *testing.T) {
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	err = server.DB.Model(&users[1]).Update("is_staff", true).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, _, err = seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	pucs, err := seedPucs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = pucs[0].CheckOutPuc(server.DB, users[0].ID, users[0].ID, "", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	samples := []struct {
+		pucID      uint64
+		tokenGiven string
+		statusCode int
+		holderID   *uint32
+	}{
+		{
+			pucID:      pucs[0].ID,
+			tokenGiven: "",
+			statusCode: 401,
+		},
+		{
+			pucID:      pucs[0].ID,
+			tokenGiven: tokens[0],
+			statusCode: 200,
+			holderID:   &users[0].ID,
+		},
+		{
+			pucID:      pucs[0].ID,
+			tokenGiven: tokens[1],
+			statusCode: 200,
+			holderID:   &users[0].ID,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/pucs", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(v.pucID))})
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(server.GetPuc)
+
+		req.Header.Set("Authorization", v.tokenGiven)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 200 {
+			puc := models.Puc{}
+			err = json.Unmarshal([]byte(rr.Body.String()), &puc)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.Equal(t, *puc.CurrentUserID, *v.holderID)
+		}
+	}
+
+	// anyone else does not see who holds a puc or where it was last seen
+	_, err = pucs[0].ReturnPuc(server.DB, users[0].ID, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = pucs[0].CheckOutPuc(server.DB, users[1].ID, users[1].ID, "", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "/pucs", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	req.Header.Set("Authorization", tokens[0])
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(server.GetPucs).ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 200)
+
+	listed := []models.Puc{}
+	err = json.Unmarshal([]byte(rr.Body.String()), &listed)
+	if err != nil {
+		t.Errorf("Cannot convert to json: %v", err)
+	}
+	assert.Equal(t, len(listed), 2)
+	for _, puc := range listed {
+		assert.Equal(t, puc.CurrentUserID, nil)
+	}
+}
+
+func TestPucManagementRequiresStaff(t *testing.T) {
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	err = server.DB.Model(&users[1]).Update("is_staff", true).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, _, err = seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	pucs, err := seedPucs()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	samples := []struct {
+		method     string
+		handler    http.HandlerFunc
+		inputJSON  string
+		tokenGiven string
+		statusCode int
+	}{
+		{
+			method:     "POST",
+			handler:    server.CreatePuc,
+			inputJSON:  `{"serial_number": "PUC-0003"}`,
+			tokenGiven: tokens[0],
+			statusCode: 401,
+		},
+		{
+			method:     "POST",
+			handler:    server.CreatePuc,
+			inputJSON:  `{"serial_number": "PUC-0003"}`,
+			tokenGiven: tokens[1],
+			statusCode: 201,
+		},
+		{
+			method:     "PUT",
+			handler:    server.UpdatePuc,
+			inputJSON:  `{"serial_number": "PUC-0004"}`,
+			tokenGiven: tokens[0],
+			statusCode: 401,
+		},
+		{
+			method:     "PUT",
+			handler:    server.SetPucLabels,
+			inputJSON:  `{"labels": {"team": "kitchen"}}`,
+			tokenGiven: tokens[0],
+			statusCode: 401,
+		},
+		{
+			method:     "PUT",
+			handler:    server.SetPucLabels,
+			inputJSON:  `{"labels": {"team": "kitchen"}}`,
+			tokenGiven: tokens[1],
+			statusCode: 200,
+		},
+		{
+			method:     "DELETE",
+			handler:    server.DeletePuc,
+			tokenGiven: tokens[0],
+			statusCode: 401,
+		},
+		{
+			method:     "DELETE",
+			handler:    server.DeletePuc,
+			tokenGiven: tokens[1],
+			statusCode: 204,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest(v.method, "/pucs", bytes.NewBufferString(v.inputJSON))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pucs[0].ID))})
+		rr := httptest.NewRecorder()
+
+		req.Header.Set("Authorization", v.tokenGiven)
+		v.handler.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
+
+func TestPucHistoryRequiresHolderOrAdministrator(t *testing.T) {
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := seedUsers()
+	if err != nil {
+		log.Fatalf("Cannot seed users %v\n", err)
+	}
+	_, _, err = seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatal(err)
+	}
+	pucs, err := seedPucs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = pucs[0].CheckOutPuc(server.DB, users[0].ID, users[0].ID, "", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens := make([]string, len(users))
+	for i, user := range users {
+		token, err := server.SignIn(user.Email, "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+		tokens[i] = fmt.Sprintf("Bearer %v", token)
+	}
+
+	samples := []struct {
+		handler    http.HandlerFunc
+		tokenGiven string
+		statusCode int
+	}{
+		{
+			handler:    server.GetPucCheckIns,
+			tokenGiven: tokens[0],
+			statusCode: 200,
+		},
+		{
+			// neither the holder nor any organisation's administrator
+			handler:    server.GetPucCheckIns,
+			tokenGiven: tokens[1],
+			statusCode: 401,
+		},
+		{
+			handler:    server.GetPucVisits,
+			tokenGiven: tokens[0],
+			statusCode: 200,
+		},
+		{
+			handler:    server.GetPucVisits,
+			tokenGiven: tokens[1],
+			statusCode: 401,
+		},
+		{
+			// nothing has been heard of the PUC yet
+			handler:    server.GetPucPosition,
+			tokenGiven: tokens[0],
+			statusCode: 404,
+		},
+		{
+			handler:    server.GetPucPosition,
+			tokenGiven: tokens[1],
+			statusCode: 401,
+		},
+		{
+			handler:    server.GetPucAlerts,
+			tokenGiven: tokens[0],
+			statusCode: 200,
+		},
+		{
+			handler:    server.GetPucAlerts,
+			tokenGiven: tokens[1],
+			statusCode: 401,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", "/pucs", nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(int(pucs[0].ID))})
+		req.Header.Set("Authorization", v.tokenGiven)
+		rr := httptest.NewRecorder()
+		v.handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+}
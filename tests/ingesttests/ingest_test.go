@@ -0,0 +1,66 @@
+package ingesttests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/ingest"
+	"gopkg.in/go-playground/assert.v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseNDJSON(t *testing.T) {
+	input := `{"beacon_id":1,"puc_id":2,"rssi":-70,"timestamp":1622538000}
+
+not json
+{"mac_address":"aa:bb:cc:dd:ee:01","puc_id":2,"rssi":-65,"timestamp":1622538001}
+`
+	batch, err := ingest.ParseNDJSON(strings.NewReader(input))
+	if err != nil {
+		t.Errorf("this is the error parsing the batch: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(batch.Sightings), 2)
+	assert.Equal(t, batch.Records, []int{1, 3})
+	assert.Equal(t, len(batch.Malformed), 1)
+	assert.Equal(t, batch.Malformed[0].Record, 2)
+	assert.Equal(t, batch.Sightings[1].MacAddress, "aa:bb:cc:dd:ee:01")
+}
+
+func TestParseJSON(t *testing.T) {
+	batch, err := ingest.ParseJSON(strings.NewReader(`[{"beacon_id":1,"puc_id":2,"rssi":-70,"timestamp":1622538000}]`))
+	if err != nil {
+		t.Errorf("this is the error parsing the batch: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(batch.Sightings), 1)
+	assert.Equal(t, *batch.Sightings[0].RSSI, -70)
+
+	_, err = ingest.ParseJSON(strings.NewReader(`{"beacon_id":1}`))
+	assert.NotEqual(t, err, nil)
+
+	_, err = ingest.ParseNDJSON(strings.NewReader(strings.Repeat("{}\n", ingest.MaxBatchSize+1)))
+	assert.Equal(t, err, ingest.ErrBatchTooLarge)
+}
+
+func TestValidateSighting(t *testing.T) {
+	now := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	options := ingest.Options{MaxAge: time.Hour, ClockSkew: time.Minute}
+	rssi := -70
+	weak := -200
+
+	valid := ingest.Sighting{BeaconID: 1, PucID: 2, RSSI: &rssi, Timestamp: now.Unix()}
+	assert.Equal(t, valid.Validate(now, options), nil)
+
+	samples := []ingest.Sighting{
+		{BeaconID: 1, RSSI: &rssi, Timestamp: now.Unix()},
+		{PucID: 2, RSSI: &rssi, Timestamp: now.Unix()},
+		{BeaconID: 1, MacAddress: "aa:bb:cc:dd:ee:01", PucID: 2, RSSI: &rssi, Timestamp: now.Unix()},
+		{BeaconID: 1, PucID: 2, Timestamp: now.Unix()},
+		{BeaconID: 1, PucID: 2, RSSI: &weak, Timestamp: now.Unix()},
+		{BeaconID: 1, PucID: 2, RSSI: &rssi, Timestamp: now.Add(2 * time.Minute).Unix()},
+		{BeaconID: 1, PucID: 2, RSSI: &rssi, Timestamp: now.Add(-2 * time.Hour).Unix()},
+	}
+	for _, sample := range samples {
+		assert.NotEqual(t, sample.Validate(now, options), nil)
+	}
+}
@@ -0,0 +1,49 @@
+package labelstests
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/labels"
+	"gopkg.in/go-playground/assert.v1"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	selector, err := labels.Parse("floor in (2, 1),type!=storage, zone, !retired,site==civic")
+	if err != nil {
+		t.Errorf("this is the error parsing the selector: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(selector), 5)
+	assert.Equal(t, selector[0], labels.Requirement{Key: "floor", Operator: labels.In, Values: []string{"2", "1"}})
+	assert.Equal(t, selector[1], labels.Requirement{Key: "type", Operator: labels.NotEquals, Values: []string{"storage"}})
+	assert.Equal(t, selector[2].Operator, labels.Exists)
+	assert.Equal(t, selector[3], labels.Requirement{Key: "retired", Operator: labels.DoesNotExist})
+	assert.Equal(t, selector[4].Values, []string{"civic"})
+	assert.Equal(t, selector.String(), "floor in (1,2),type!=storage,zone,!retired,site=civic")
+
+	empty, err := labels.Parse("")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(empty), 0)
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, selector := range []string{"floor in (1,2", "=2", "type=store room", "bad key=1"} {
+		_, err := labels.Parse(selector)
+		assert.Equal(t, errors.Is(err, labels.ErrInvalidSelector), true)
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	selector, _ := labels.Parse("floor in (1,2),type!=storage")
+
+	assert.Equal(t, selector.Matches(map[string]string{"floor": "2", "type": "entrance"}), true)
+	assert.Equal(t, selector.Matches(map[string]string{"floor": "1"}), true)
+	assert.Equal(t, selector.Matches(map[string]string{"floor": "2", "type": "storage"}), false)
+	assert.Equal(t, selector.Matches(map[string]string{"type": "entrance"}), false)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Equal(t, labels.Validate(map[string]string{"example.com/type": "entrance", "note": ""}), nil)
+	assert.Equal(t, errors.Is(labels.Validate(map[string]string{"type": "-entrance"}), labels.ErrInvalidLabel), true)
+	assert.Equal(t, errors.Is(labels.Validate(map[string]string{"": "x"}), labels.ErrInvalidLabel), true)
+}
@@ -0,0 +1,72 @@
+package macaddresstests
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/macaddress"
+	"gopkg.in/go-playground/assert.v1"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	samples := []struct {
+		input      string
+		normalized string
+		invalid    bool
+	}{
+		{input: "aa:bb:cc:dd:ee:ff", normalized: "AA:BB:CC:DD:EE:FF"},
+		{input: "AA-BB-CC-DD-EE-FF", normalized: "AA:BB:CC:DD:EE:FF"},
+		{input: "aabbccddeeff", normalized: "AA:BB:CC:DD:EE:FF"},
+		{input: "aabb.ccdd.eeff", normalized: "AA:BB:CC:DD:EE:FF"},
+		{input: " aa:bb:cc:dd:ee:ff ", normalized: "AA:BB:CC:DD:EE:FF"},
+		{input: "00:12:4b:ff:fe:01:02:03", normalized: "00:12:4B:FF:FE:01:02:03"},
+		{input: "aa:bb:cc:dd:ee", invalid: true},
+		{input: "aa:bb-cc:dd:ee:ff", invalid: true},
+		{input: "aab:bcc:dde:eff", invalid: true},
+		{input: "gg:bb:cc:dd:ee:ff", invalid: true},
+		{input: "", invalid: true},
+	}
+
+	for _, v := range samples {
+		normalized, err := macaddress.Normalize(v.input)
+		if v.invalid {
+			assert.Equal(t, errors.Is(err, macaddress.ErrInvalidMacAddress), true)
+			continue
+		}
+		assert.Equal(t, err, nil)
+		assert.Equal(t, normalized, v.normalized)
+	}
+}
+
+func TestAddressFlags(t *testing.T) {
+	samples := []struct {
+		input               string
+		locallyAdministered bool
+		multicast           bool
+		random              bool
+		randomSubtype       string
+	}{
+		{input: "B8:27:EB:00:00:01", randomSubtype: macaddress.RandomReserved},
+		{input: "02:00:00:00:00:01", locallyAdministered: true, random: true, randomSubtype: macaddress.RandomNonResolvable},
+		{input: "01:00:5E:00:00:01", multicast: true, randomSubtype: macaddress.RandomNonResolvable},
+		{input: "C1:22:33:44:55:66", multicast: true, random: true, randomSubtype: macaddress.RandomStatic},
+		{input: "4A:22:33:44:55:66", locallyAdministered: true, random: true, randomSubtype: macaddress.RandomResolvable},
+		// a public address whose OUI is not in the vendor table
+		{input: "F0:2A:61:00:00:01", randomSubtype: macaddress.RandomStatic},
+	}
+
+	for _, v := range samples {
+		address, err := macaddress.Parse(v.input)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, address.IsLocallyAdministered(), v.locallyAdministered)
+		assert.Equal(t, address.IsMulticast(), v.multicast)
+		assert.Equal(t, address.IsRandom(), v.random)
+		assert.Equal(t, address.RandomSubtype(), v.randomSubtype)
+	}
+}
+
+func TestLookupVendor(t *testing.T) {
+	assert.Equal(t, macaddress.LookupVendor("b8-27-eb-12-34-56"), "Raspberry Pi Foundation")
+	assert.Equal(t, macaddress.LookupVendor("00:12:4B:FF:FE:01:02:03"), "Texas Instruments")
+	assert.Equal(t, macaddress.LookupVendor("02:00:00:00:00:01"), "")
+	assert.Equal(t, macaddress.LookupVendor("not a mac"), "")
+}
@@ -0,0 +1,109 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestVerifyCheckIn(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	err = models.SeedBeaconEventTypes(server.DB)
+	if err != nil {
+		log.Fatalf("Error seeding beacon event types %v\n", err)
+	}
+	organisation.AdministratorID = 1
+	beacon := beacons[0]
+	now := time.Now()
+
+	err = beacon.VerifyCheckIn(server.DB, models.SignedCheckIn{BeaconID: beacon.ID, Nonce: "n1", Signature: "00"}, now, time.Minute)
+	assert.Equal(t, err, models.ErrCheckInNotRegistered)
+
+	err = beacon.RegisterBeacon(server.DB, organisation, 1, "installed")
+	if err != nil {
+		t.Errorf("this is the error registering the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(beacon.SecretKey), 64)
+
+	sign := func(pucID uint64, timestamp int64, nonce string) models.SignedCheckIn {
+		signature, err := models.SignCheckIn(beacon.SecretKey, beacon.ID, pucID, timestamp, nonce)
+		if err != nil {
+			t.Fatalf("this is the error signing the check-in: %v\n", err)
+		}
+		return models.SignedCheckIn{BeaconID: beacon.ID, PucID: pucID, Timestamp: timestamp, Nonce: nonce, Signature: signature}
+	}
+
+	checkIn := sign(1, now.Unix(), "n1")
+	err = beacon.VerifyCheckIn(server.DB, checkIn, now, time.Minute)
+	assert.Equal(t, err, nil)
+
+	err = beacon.VerifyCheckIn(server.DB, checkIn, now, time.Minute)
+	assert.Equal(t, err, models.ErrCheckInReplayed)
+
+	// a retry reusing the nonce is verified when its idempotency key names the
+	// check-in it signs, but only once the signature checks out
+	puc := models.Puc{SerialNumber: "PUC-0001"}
+	err = server.DB.Model(&models.Puc{}).Create(&puc).Error
+	if err != nil {
+		log.Fatalf("cannot seed pucs table: %v", err)
+	}
+	retry := sign(puc.ID, now.Unix(), "n4")
+	retry.IdempotencyKey = "gw-1:0001"
+	err = beacon.VerifyCheckIn(server.DB, retry, now, time.Minute)
+	assert.Equal(t, err, nil)
+	_, _, err = beacon.CheckInPUC(server.DB, retry.PucID, time.Unix(retry.Timestamp, 0), nil, models.CheckInDedupe{IdempotencyKey: retry.IdempotencyKey})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	err = beacon.VerifyCheckIn(server.DB, retry, now, time.Minute)
+	assert.Equal(t, err, nil)
+
+	forged := retry
+	forged.Signature = "00"
+	err = beacon.VerifyCheckIn(server.DB, forged, now, time.Minute)
+	assert.Equal(t, err, models.ErrCheckInBadSignature)
+
+	// the key does not cover another check-in from the same PUC
+	reused := sign(puc.ID, now.Unix()-1, "n4")
+	reused.IdempotencyKey = retry.IdempotencyKey
+	err = beacon.VerifyCheckIn(server.DB, reused, now, time.Minute)
+	assert.Equal(t, err, models.ErrCheckInReplayed)
+
+	tampered := sign(1, now.Unix(), "n2")
+	tampered.PucID = 2
+	err = beacon.VerifyCheckIn(server.DB, tampered, now, time.Minute)
+	assert.Equal(t, err, models.ErrCheckInBadSignature)
+
+	err = beacon.VerifyCheckIn(server.DB, sign(1, now.Add(-5*time.Minute).Unix(), "n3"), now, time.Minute)
+	assert.Equal(t, err, models.ErrCheckInClockSkew)
+
+	// a suspended beacon accepts no check-ins, even ones signed with its old key
+	suspended := sign(1, now.Unix(), "n5")
+	err = beacon.SuspendBeacon(server.DB, 1, "battery replacement")
+	if err != nil {
+		t.Errorf("this is the error suspending the beacon: %v\n", err)
+		return
+	}
+	err = beacon.VerifyCheckIn(server.DB, suspended, now, time.Minute)
+	assert.Equal(t, err, models.ErrCheckInNotRegistered)
+
+	// rejections are counted by reason rather than each stored
+	rejections, err := models.FindCheckInRejections(server.DB, beacon.ID, beacon.OrganisationID, now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error finding the check-in rejections: %v\n", err)
+		return
+	}
+	attempts := 0
+	for _, rejection := range *rejections {
+		attempts += rejection.Attempts
+	}
+	assert.Equal(t, len(*rejections), 4)
+	assert.Equal(t, attempts, 7)
+}
@@ -0,0 +1,86 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedeemClaimCode(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	err = models.SeedBeaconEventTypes(server.DB)
+	if err != nil {
+		log.Fatalf("Error seeding beacon event types %v\n", err)
+	}
+	organisation.AdministratorID = 1
+	beacon := beacons[2]
+
+	// a key the previous owner still holds
+	previousKey := strings.Repeat("ab", 32)
+	err = server.DB.Model(&beacon).UpdateColumn("secret_key", previousKey).Error
+	if err != nil {
+		log.Fatalf("Error setting the previous key %v\n", err)
+	}
+
+	replaced, err := beacon.IssueClaimCode(server.DB, 1, time.Hour)
+	if err != nil {
+		t.Errorf("this is the error issuing the claim code: %v\n", err)
+		return
+	}
+	claimCode, err := beacon.IssueClaimCode(server.DB, 1, time.Hour)
+	if err != nil {
+		t.Errorf("this is the error issuing the claim code: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(claimCode.Code), 14)
+
+	// issuing a new code revokes the previous one
+	_, err = models.RedeemClaimCode(server.DB, replaced.Code, organisation, 1, "")
+	assert.Equal(t, err, models.ErrInvalidClaimCode)
+
+	typed := strings.ToLower(strings.Replace(claimCode.Code, "-", " ", -1))
+	registered, err := models.RedeemClaimCode(server.DB, typed, organisation, 1, "")
+	if err != nil {
+		t.Errorf("this is the error redeeming the claim code: %v\n", err)
+		return
+	}
+	assert.Equal(t, registered.ID, beacon.ID)
+	assert.Equal(t, registered.OrganisationID, organisation.ID)
+	assert.Equal(t, registered.Status, models.BeaconStatusRegistered)
+	assert.Equal(t, len(registered.SecretKey), 64)
+	assert.NotEqual(t, registered.SecretKey, previousKey)
+
+	_, err = models.RedeemClaimCode(server.DB, claimCode.Code, organisation, 1, "")
+	assert.Equal(t, err, models.ErrInvalidClaimCode)
+}
+
+func TestExpiredClaimCode(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	claimCode, err := beacons[2].IssueClaimCode(server.DB, 1, time.Hour)
+	if err != nil {
+		t.Errorf("this is the error issuing the claim code: %v\n", err)
+		return
+	}
+
+	_, err = (&models.BeaconClaimCode{}).FindRedeemableClaimCode(server.DB, claimCode.Code, time.Now().Add(2*time.Hour))
+	assert.Equal(t, err, models.ErrInvalidClaimCode)
+
+	organisation.AdministratorID = 1
+	err = beacons[0].RegisterBeacon(server.DB, organisation, 1, "")
+	if err != nil {
+		t.Errorf("this is the error registering the beacon: %v\n", err)
+		return
+	}
+	_, err = beacons[0].IssueClaimCode(server.DB, 1, time.Hour)
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,107 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestBeaconEvents(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	err = models.SeedBeaconEventTypes(server.DB)
+	if err != nil {
+		log.Fatalf("Error seeding beacon event types %v\n", err)
+	}
+	organisation.AdministratorID = 1
+	beacon := beacons[0]
+	start := time.Now().Add(-time.Minute)
+
+	err = beacon.RegisterBeacon(server.DB, organisation, 1, "installed")
+	if err != nil {
+		t.Errorf("this is the error registering the beacon: %v\n", err)
+		return
+	}
+
+	beaconUpdate := beacon
+	beaconUpdate.Placement = "above the till"
+	err = beaconUpdate.UpdateBeacon(server.DB, beacon.ID)
+	if err != nil {
+		t.Errorf("this is the error updating the beacon: %v\n", err)
+		return
+	}
+
+	samples := []models.BeaconTelemetry{
+		{BeaconID: beacon.ID, BatteryMillivolts: 2600, RecordedAt: time.Now().Add(-3 * time.Second)},
+		{BeaconID: beacon.ID, BatteryMillivolts: 2400, RecordedAt: time.Now().Add(-2 * time.Second)},
+		{BeaconID: beacon.ID, BatteryMillivolts: 2300, RecordedAt: time.Now().Add(-time.Second)},
+	}
+	for i, _ := range samples {
+		_, err = samples[i].SaveTelemetry(server.DB)
+		if err != nil {
+			t.Errorf("this is the error saving the telemetry: %v\n", err)
+			return
+		}
+	}
+
+	eventInstance := models.BeaconEvent{}
+	events, err := eventInstance.FindBeaconEvents(server.DB, beacon.ID, nil, start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error finding the beacon events: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*events), 3)
+	assert.Equal(t, (*events)[0].EventType, models.BeaconEventBatteryLow)
+	assert.Equal(t, (*events)[1].EventType, models.BeaconEventConfigChanged)
+	assert.Equal(t, (*events)[1].Details, "changed placement")
+	assert.Equal(t, (*events)[2].EventType, models.BeaconEventRegistered)
+	assert.Equal(t, (*events)[2].OrganisationID, organisation.ID)
+
+	events, err = eventInstance.FindBeaconEvents(server.DB, beacon.ID, []string{models.BeaconEventRegistered}, start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error finding the beacon events: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*events), 1)
+
+	// the log is append-only
+	event := (*events)[0]
+	err = server.DB.Model(&event).Update("details", "rewritten").Error
+	assert.Equal(t, err, models.ErrBeaconEventImmutable)
+	err = server.DB.Delete(&event).Error
+	assert.Equal(t, err, models.ErrBeaconEventImmutable)
+
+	// a beacon heard for the first time has not come back online
+	err = beacon.MarkSeen(server.DB, time.Now())
+	if err != nil {
+		t.Errorf("this is the error marking the beacon seen: %v\n", err)
+		return
+	}
+	events, err = eventInstance.FindBeaconEvents(server.DB, beacon.ID, []string{models.BeaconEventOnline}, start, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error finding the beacon events: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*events), 0)
+
+	// a beacon with a history is decommissioned rather than deleted
+	_, err = beaconInstance.DeleteBeacon(server.DB, beacon.ID)
+	assert.Equal(t, err, models.ErrBeaconHasHistory)
+}
+
+func TestValidateBeaconEventTypes(t *testing.T) {
+	eventTypes, err := models.ValidateBeaconEventTypes("check_in, offline")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, eventTypes, []string{models.BeaconEventCheckIn, models.BeaconEventOffline})
+
+	eventTypes, err = models.ValidateBeaconEventTypes("")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(eventTypes), 0)
+
+	_, err = models.ValidateBeaconEventTypes("check_in,exploded")
+	assert.NotEqual(t, err, nil)
+}
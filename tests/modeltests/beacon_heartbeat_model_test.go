@@ -0,0 +1,120 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestBeaconOfflineDetection(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	err = server.DB.Model(&models.Beacon{}).Where("organisation_id = ?", organisation.ID).
+		UpdateColumn("status", models.BeaconStatusRegistered).Error
+	if err != nil {
+		log.Fatalf("Error registering beacons %v\n", err)
+	}
+
+	now := time.Now()
+	err = beacons[0].MarkSeen(server.DB, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Errorf("this is the error marking the beacon seen: %v\n", err)
+		return
+	}
+	err = beacons[1].MarkSeen(server.DB, now.Add(-time.Minute))
+	if err != nil {
+		t.Errorf("this is the error marking the beacon seen: %v\n", err)
+		return
+	}
+	assert.Equal(t, beacons[0].IsOnline, true)
+
+	// an older sighting must not move last seen backwards
+	err = beacons[1].MarkSeen(server.DB, now.Add(-time.Hour))
+	if err != nil {
+		t.Errorf("this is the error marking the beacon seen: %v\n", err)
+		return
+	}
+
+	marked, err := models.MarkOfflineBeacons(server.DB, now)
+	if err != nil {
+		t.Errorf("this is the error marking beacons offline: %v\n", err)
+		return
+	}
+	assert.Equal(t, marked, int64(1))
+
+	offline, err := beaconInstance.FindOfflineBeacons(server.DB, organisation.ID, now)
+	if err != nil {
+		t.Errorf("this is the error finding offline beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*offline), 1)
+	assert.Equal(t, (*offline)[0].Beacon.ID, beacons[0].ID)
+	assert.Equal(t, *(*offline)[0].SilentSeconds, int64(7200))
+
+	// hearing the beacon again brings it back online
+	err = beacons[0].MarkSeen(server.DB, now)
+	if err != nil {
+		t.Errorf("this is the error marking the beacon seen: %v\n", err)
+		return
+	}
+	offline, err = beaconInstance.FindOfflineBeacons(server.DB, organisation.ID, now)
+	if err != nil {
+		t.Errorf("this is the error finding offline beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*offline), 0)
+}
+
+func TestMarkOfflineBeaconsThreshold(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	err = server.DB.Model(&organisation).UpdateColumn("offline_threshold_minutes", 180).Error
+	if err != nil {
+		log.Fatalf("Error updating the organisation %v\n", err)
+	}
+	unowned := models.Beacon{MacAddress: "F0:2A:61:00:00:03"}
+	err = server.DB.Model(&models.Beacon{}).Create(&unowned).Error
+	if err != nil {
+		log.Fatalf("Error seeding beacon table %v\n", err)
+	}
+
+	now := time.Now()
+	for _, beacon := range []models.Beacon{beacons[0], unowned} {
+		err = beacon.MarkSeen(server.DB, now.Add(-2*time.Hour))
+		if err != nil {
+			t.Errorf("this is the error marking the beacon seen: %v\n", err)
+			return
+		}
+	}
+
+	// the organisation's threshold keeps its beacon online, the unowned beacon
+	// falls back to the default threshold
+	marked, err := models.MarkOfflineBeacons(server.DB, now)
+	if err != nil {
+		t.Errorf("this is the error marking beacons offline: %v\n", err)
+		return
+	}
+	assert.Equal(t, marked, int64(1))
+
+	beacon := models.Beacon{}
+	_, err = beacon.FindBeaconByID(server.DB, unowned.ID)
+	if err != nil {
+		t.Errorf("this is the error finding the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, beacon.IsOnline, false)
+
+	// nothing is marked twice
+	marked, err = models.MarkOfflineBeacons(server.DB, now)
+	if err != nil {
+		t.Errorf("this is the error marking beacons offline: %v\n", err)
+		return
+	}
+	assert.Equal(t, marked, int64(0))
+}
@@ -0,0 +1,100 @@
+package modeltests
+
+import (
+	"errors"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+)
+
+func TestCanTransitionBeacon(t *testing.T) {
+	samples := []struct {
+		from    string
+		to      string
+		allowed bool
+	}{
+		{from: models.BeaconStatusUnclaimed, to: models.BeaconStatusPending, allowed: true},
+		{from: models.BeaconStatusPending, to: models.BeaconStatusRegistered, allowed: true},
+		{from: models.BeaconStatusRegistered, to: models.BeaconStatusSuspended, allowed: true},
+		{from: models.BeaconStatusSuspended, to: models.BeaconStatusDecommissioned, allowed: true},
+		{from: models.BeaconStatusUnclaimed, to: models.BeaconStatusSuspended, allowed: false},
+		{from: models.BeaconStatusRegistered, to: models.BeaconStatusRegistered, allowed: false},
+		{from: models.BeaconStatusDecommissioned, to: models.BeaconStatusUnclaimed, allowed: false},
+	}
+
+	for _, v := range samples {
+		assert.Equal(t, models.CanTransitionBeacon(v.from, v.to), v.allowed)
+	}
+}
+
+func TestBeaconLifecycle(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	organisation.AdministratorID = 1
+	beacon := beacons[0]
+
+	// registrations by someone other than the administrator are left pending
+	err = beacon.RegisterBeacon(server.DB, organisation, 2, "installed at the counter")
+	if err != nil {
+		t.Errorf("this is the error registering the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, beacon.Status, models.BeaconStatusPending)
+	assert.Equal(t, beacon.IsRegistered, false)
+
+	err = beacon.RegisterBeacon(server.DB, organisation, 1, "approved")
+	if err != nil {
+		t.Errorf("this is the error registering the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, beacon.Status, models.BeaconStatusRegistered)
+	assert.Equal(t, beacon.IsRegistered, true)
+	assert.Equal(t, len(beacon.SecretKey), 64)
+	firstKey := beacon.SecretKey
+
+	// the check-in key is withdrawn whenever the beacon leaves service, and a
+	// registration always provisions a new one
+	err = beacon.SuspendBeacon(server.DB, 1, "battery replacement")
+	if err != nil {
+		t.Errorf("this is the error suspending the beacon: %v\n", err)
+		return
+	}
+	stored := models.Beacon{}
+	_, err = stored.FindBeaconByID(server.DB, beacon.ID)
+	if err != nil {
+		t.Errorf("this is the error finding the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, stored.SecretKey, "")
+
+	err = beacon.RegisterBeacon(server.DB, organisation, 1, "battery replaced")
+	if err != nil {
+		t.Errorf("this is the error registering the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(beacon.SecretKey), 64)
+	assert.NotEqual(t, beacon.SecretKey, firstKey)
+
+	err = beacon.DecommissionBeacon(server.DB, 1, "end of life")
+	if err != nil {
+		t.Errorf("this is the error decommissioning the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, beacon.SecretKey, "")
+
+	err = beacon.DeregisterBeacon(server.DB, 1, "")
+	assert.Equal(t, errors.Is(err, models.ErrInvalidBeaconTransition), true)
+
+	history, err := beacon.FindBeaconHistory(server.DB)
+	if err != nil {
+		t.Errorf("this is the error getting the beacon history: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*history), 5)
+	assert.Equal(t, (*history)[0].ActorID, uint32(2))
+	assert.Equal(t, (*history)[1].OrganisationID, organisation.ID)
+	assert.Equal(t, (*history)[4].ToStatus, models.BeaconStatusDecommissioned)
+}
@@ -0,0 +1,235 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/advertisement"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestFindAllBeacons(t *testing.T) {
+	_, _, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	beacons, err := beaconInstance.FindAllBeacons(server.DB, nil)
+	if err != nil {
+		t.Errorf("this is the error getting the beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*beacons), 3)
+}
+
+func TestFindOrganisationBeacons(t *testing.T) {
+	organisation, _, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	beacons, err := beaconInstance.FindOrganisationBeacons(server.DB, organisation.ID, nil)
+	if err != nil {
+		t.Errorf("this is the error getting the beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*beacons), 2)
+}
+
+func TestSaveBeacon(t *testing.T) {
+	err := refreshOrganisationAndBeaconTable()
+	if err != nil {
+		log.Fatalf("Error refreshing organisation and beacon table %v\n", err)
+	}
+
+	newBeacon := models.Beacon{
+		MacAddress: "F0:2A:61:00:00:09",
+	}
+	savedBeacon, err := newBeacon.SaveBeacon(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, savedBeacon.MacAddress, newBeacon.MacAddress)
+	assert.Equal(t, savedBeacon.IsRegistered, false)
+
+	_, err = (&models.Beacon{}).SaveBeacon(server.DB)
+	assert.NotEqual(t, err, nil)
+}
+
+func TestFindBeaconByID(t *testing.T) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	foundBeacon, err := beaconInstance.FindBeaconByID(server.DB, beacons[0].ID)
+	if err != nil {
+		t.Errorf("this is the error getting one beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, foundBeacon.ID, beacons[0].ID)
+	assert.Equal(t, foundBeacon.MacAddress, beacons[0].MacAddress)
+
+	_, err = beaconInstance.FindBeaconByID(server.DB, 9999)
+	assert.Equal(t, err, models.ErrBeaconNotFound)
+}
+
+func TestUpdateBeacon(t *testing.T) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	beaconUpdate := models.Beacon{
+		MacAddress:     "F0:2A:61:00:00:0A",
+		OrganisationID: beacons[0].OrganisationID,
+	}
+	err = beaconUpdate.UpdateBeacon(server.DB, beacons[0].ID)
+	if err != nil {
+		t.Errorf("this is the error updating the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, beaconUpdate.ID, beacons[0].ID)
+	assert.Equal(t, beaconUpdate.MacAddress, "F0:2A:61:00:00:0A")
+}
+
+func TestDeleteBeacon(t *testing.T) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	isDeleted, err := beaconInstance.DeleteBeacon(server.DB, beacons[0].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, isDeleted, int64(1))
+}
+
+func TestResolveAdvertisement(t *testing.T) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	beaconUpdate := models.Beacon{
+		MacAddress:   beacons[0].MacAddress,
+		IBeaconUUID:  "e2c56db5dffb48d2b060d0f5a71096e0",
+		IBeaconMajor: 1,
+		IBeaconMinor: 2,
+	}
+	err = beaconUpdate.Prepare()
+	if err != nil {
+		t.Errorf("this is the error preparing the beacon: %v\n", err)
+		return
+	}
+	err = beaconUpdate.UpdateBeacon(server.DB, beacons[0].ID)
+	if err != nil {
+		t.Errorf("this is the error updating the beacon: %v\n", err)
+		return
+	}
+
+	// no other beacon may broadcast the same identity
+	duplicate := beaconUpdate
+	duplicate.MacAddress = beacons[1].MacAddress
+	err = duplicate.UpdateBeacon(server.DB, beacons[1].ID)
+	assert.Equal(t, err, models.ErrBeaconIdentityTaken)
+	duplicate.MacAddress = "F0:2A:61:00:00:20"
+	_, err = duplicate.SaveBeacon(server.DB)
+	assert.Equal(t, err, models.ErrBeaconIdentityTaken)
+
+	adv, err := advertisement.ParseHex("0201061AFF4C000215E2C56DB5DFFB48D2B060D0F5A71096E000010002C5")
+	if err != nil {
+		t.Errorf("this is the error parsing the advertisement: %v\n", err)
+		return
+	}
+
+	resolved, err := (&models.Beacon{}).ResolveAdvertisement(server.DB, adv, "", time.Now(), models.DefaultEIDResolveWindow)
+	if err != nil {
+		t.Errorf("this is the error resolving the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, resolved.ID, beacons[0].ID)
+
+	// unknown identities fall back to the mac address the beacon was heard from
+	adv.IBeacon.Minor = 3
+	resolved, err = (&models.Beacon{}).ResolveAdvertisement(server.DB, adv, beacons[1].MacAddress, time.Now(), models.DefaultEIDResolveWindow)
+	if err != nil {
+		t.Errorf("this is the error resolving the advertisement: %v\n", err)
+		return
+	}
+	assert.Equal(t, resolved.ID, beacons[1].ID)
+
+	_, err = (&models.Beacon{}).ResolveAdvertisement(server.DB, adv, "", time.Now(), models.DefaultEIDResolveWindow)
+	assert.Equal(t, err, models.ErrBeaconNotFound)
+}
+
+func TestResolveEphemeralID(t *testing.T) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	beacon := beacons[1]
+
+	schedule := models.EIDSchedule{Window: 1, Interval: time.Minute}
+	err = beacon.ProvisionEID(server.DB, "", 4, schedule)
+	if err != nil {
+		t.Errorf("this is the error provisioning the eid: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(beacon.EIDIdentityKey), 32)
+
+	// the beacon broadcast this id one rotation period before it was observed
+	observedAt := time.Now()
+	eid, err := advertisement.ComputeEID(beacon.EIDIdentityKey, 4, advertisement.EIDCounter(observedAt.Add(-16*time.Second)))
+	if err != nil {
+		t.Errorf("this is the error computing the eid: %v\n", err)
+		return
+	}
+
+	resolved, err := (&models.Beacon{}).ResolveEphemeralID(server.DB, eid, observedAt, 1)
+	if err != nil {
+		t.Errorf("this is the error resolving the ephemeral id: %v\n", err)
+		return
+	}
+	assert.Equal(t, resolved.ID, beacon.ID)
+	assert.Equal(t, resolved.EIDEnabled, true)
+
+	_, err = (&models.Beacon{}).ResolveEphemeralID(server.DB, eid, observedAt.Add(time.Hour), 1)
+	assert.Equal(t, err, models.ErrBeaconNotFound)
+
+	// ids broadcast later only resolve once they have been refreshed
+	later := observedAt.Add(time.Hour)
+	eid, err = advertisement.ComputeEID(beacon.EIDIdentityKey, 4, advertisement.EIDCounter(later))
+	if err != nil {
+		t.Errorf("this is the error computing the eid: %v\n", err)
+		return
+	}
+	_, err = (&models.Beacon{}).ResolveEphemeralID(server.DB, eid, later, 1)
+	assert.Equal(t, err, models.ErrBeaconNotFound)
+
+	refreshed, err := models.RefreshEphemeralIDs(server.DB, later, schedule)
+	if err != nil {
+		t.Errorf("this is the error refreshing the ephemeral ids: %v\n", err)
+		return
+	}
+	assert.Equal(t, refreshed, 1)
+
+	resolved, err = (&models.Beacon{}).ResolveEphemeralID(server.DB, eid, later, 1)
+	if err != nil {
+		t.Errorf("this is the error resolving the ephemeral id: %v\n", err)
+		return
+	}
+	assert.Equal(t, resolved.ID, beacon.ID)
+
+	// nothing is due again until the stored ids run low
+	refreshed, err = models.RefreshEphemeralIDs(server.DB, later, schedule)
+	if err != nil {
+		t.Errorf("this is the error refreshing the ephemeral ids: %v\n", err)
+		return
+	}
+	assert.Equal(t, refreshed, 0)
+}
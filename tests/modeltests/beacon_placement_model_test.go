@@ -0,0 +1,78 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+)
+
+func seedPlacedBeacons() []models.Beacon {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	// the first two beacons are about 110 metres apart in Canberra, the third is in Sydney
+	placements := [][2]float64{{-35.2809, 149.1300}, {-35.2799, 149.1300}, {-33.8688, 151.2093}}
+	ground := 0
+	for i, _ := range beacons {
+		latitude, longitude := placements[i][0], placements[i][1]
+		beacons[i].Latitude = &latitude
+		beacons[i].Longitude = &longitude
+		beacons[i].Floor = &ground
+		err = beacons[i].UpdateBeacon(server.DB, beacons[i].ID)
+		if err != nil {
+			log.Fatalf("cannot place beacon: %v", err)
+		}
+	}
+	return beacons
+}
+
+func TestFindBeaconsWithinRadius(t *testing.T) {
+	beacons := seedPlacedBeacons()
+
+	nearby, err := beaconInstance.FindBeaconsWithinRadius(server.DB, -35.2809, 149.1300, 500, nil)
+	if err != nil {
+		t.Errorf("this is the error finding nearby beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*nearby), 2)
+	assert.Equal(t, (*nearby)[0].ID, beacons[0].ID)
+	assert.Equal(t, (*nearby)[1].DistanceMetres > 100 && (*nearby)[1].DistanceMetres < 120, true)
+
+	upstairs := 1
+	nearby, err = beaconInstance.FindBeaconsWithinRadius(server.DB, -35.2809, 149.1300, 500, &upstairs)
+	if err != nil {
+		t.Errorf("this is the error finding nearby beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*nearby), 0)
+
+	_, err = beaconInstance.FindBeaconsWithinRadius(server.DB, -95, 149.1300, 500, nil)
+	assert.Equal(t, err, models.ErrInvalidCoordinates)
+}
+
+func TestFindBeaconsInBoundingBox(t *testing.T) {
+	beacons := seedPlacedBeacons()
+
+	box := models.BoundingBox{MinLatitude: -34, MinLongitude: 151, MaxLatitude: -33, MaxLongitude: 152}
+	found, err := beaconInstance.FindBeaconsInBoundingBox(server.DB, box, nil)
+	if err != nil {
+		t.Errorf("this is the error finding beacons in the bounding box: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 1)
+	assert.Equal(t, (*found)[0].ID, beacons[2].ID)
+}
+
+func TestFindNearestBeacon(t *testing.T) {
+	beacons := seedPlacedBeacons()
+
+	nearest, err := beaconInstance.FindNearestBeacon(server.DB, -35.2790, 149.1301, nil)
+	if err != nil {
+		t.Errorf("this is the error finding the nearest beacon: %v\n", err)
+		return
+	}
+	assert.Equal(t, nearest.ID, beacons[1].ID)
+}
@@ -0,0 +1,59 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestBeaconTelemetry(t *testing.T) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	temperature := 21.5
+	samples := []models.BeaconTelemetry{
+		{BeaconID: beacons[0].ID, BatteryMillivolts: 3000, Temperature: &temperature, RecordedAt: hour.Add(5 * time.Minute)},
+		{BeaconID: beacons[0].ID, BatteryMillivolts: 2900, RecordedAt: hour.Add(35 * time.Minute)},
+		{BeaconID: beacons[0].ID, BatteryMillivolts: 2800, RecordedAt: hour.Add(65 * time.Minute)},
+		{BeaconID: beacons[1].ID, BatteryMillivolts: 2000, RecordedAt: hour.Add(5 * time.Minute)},
+	}
+	for i, _ := range samples {
+		_, err = samples[i].SaveTelemetry(server.DB)
+		if err != nil {
+			t.Errorf("this is the error saving the telemetry: %v\n", err)
+			return
+		}
+	}
+
+	_, err = (&models.BeaconTelemetry{BeaconID: beacons[0].ID}).SaveTelemetry(server.DB)
+	assert.NotEqual(t, err, nil)
+
+	telemetryInstance := models.BeaconTelemetry{}
+	found, err := telemetryInstance.FindBeaconTelemetry(server.DB, beacons[0].ID, 0, hour, hour.Add(time.Hour))
+	if err != nil {
+		t.Errorf("this is the error finding the telemetry: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 2)
+
+	buckets, err := telemetryInstance.AggregateBeaconTelemetry(server.DB, beacons[0].ID, 0, hour, hour.Add(2*time.Hour), models.TelemetryBucketHour)
+	if err != nil {
+		t.Errorf("this is the error aggregating the telemetry: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*buckets), 2)
+	assert.Equal(t, (*buckets)[0].Samples, 2)
+	assert.Equal(t, (*buckets)[0].BatteryMillivoltsMin, float64(2900))
+	assert.Equal(t, (*buckets)[0].BatteryMillivoltsAvg, float64(2950))
+	assert.Equal(t, (*buckets)[0].BatteryMillivoltsMax, float64(3000))
+	assert.Equal(t, *(*buckets)[0].TemperatureMax, temperature)
+	assert.Equal(t, (*buckets)[1].TemperatureMax == nil, true)
+
+	_, err = telemetryInstance.AggregateBeaconTelemetry(server.DB, beacons[0].ID, 0, hour, hour.Add(time.Hour), "week")
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,105 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func seedTransferOrganisations() (models.Organisation, models.Organisation, models.Beacon) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+	err = models.SeedBeaconEventTypes(server.DB)
+	if err != nil {
+		log.Fatalf("Error seeding beacon event types %v\n", err)
+	}
+
+	buyer := models.Organisation{Region: "Canberra", EntityName: "Braddon Bakery", AdministratorID: 2}
+	err = server.DB.Model(&models.Organisation{}).Create(&buyer).Error
+	if err != nil {
+		log.Fatalf("cannot seed organisations table: %v", err)
+	}
+
+	organisation.AdministratorID = 1
+	beacon := beacons[0]
+	err = beacon.RegisterBeacon(server.DB, organisation, 1, "installed")
+	if err != nil {
+		log.Fatalf("cannot register beacon: %v", err)
+	}
+	return organisation, buyer, beacon
+}
+
+func TestAcceptBeaconTransfer(t *testing.T) {
+	seller, buyer, beacon := seedTransferOrganisations()
+	originalKey := beacon.SecretKey
+
+	sample := models.BeaconTelemetry{BeaconID: beacon.ID, BatteryMillivolts: 3000, RecordedAt: time.Now()}
+	_, err := sample.SaveTelemetry(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the telemetry: %v\n", err)
+		return
+	}
+
+	transfer, err := beacon.RequestBeaconTransfer(server.DB, buyer.ID, 1, "sold with the till", time.Hour)
+	if err != nil {
+		t.Errorf("this is the error requesting the transfer: %v\n", err)
+		return
+	}
+	assert.Equal(t, transfer.Status, models.BeaconTransferPending)
+
+	_, err = beacon.RequestBeaconTransfer(server.DB, buyer.ID, 1, "again", time.Hour)
+	assert.Equal(t, err, models.ErrBeaconTransferInProgress)
+
+	transferred, err := transfer.AcceptBeaconTransfer(server.DB, 2)
+	if err != nil {
+		t.Errorf("this is the error accepting the transfer: %v\n", err)
+		return
+	}
+	assert.Equal(t, transferred.OrganisationID, buyer.ID)
+	assert.Equal(t, transferred.Status, models.BeaconStatusRegistered)
+	assert.NotEqual(t, transferred.SecretKey, originalKey)
+	assert.Equal(t, transfer.Status, models.BeaconTransferAccepted)
+
+	// history recorded before the transfer stays with the seller
+	samples, err := sample.FindBeaconTelemetry(server.DB, beacon.ID, 0, time.Now().Add(-time.Hour), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error finding the telemetry: %v\n", err)
+		return
+	}
+	assert.Equal(t, (*samples)[0].OrganisationID, seller.ID)
+
+	// and is not shown to the buyer
+	samples, err = sample.FindBeaconTelemetry(server.DB, beacon.ID, buyer.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error finding the telemetry: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*samples), 0)
+
+	err = transfer.RejectBeaconTransfer(server.DB, 2)
+	assert.Equal(t, err, models.ErrBeaconTransferNotPending)
+}
+
+func TestExpiredBeaconTransfer(t *testing.T) {
+	_, buyer, beacon := seedTransferOrganisations()
+
+	transfer, err := beacon.RequestBeaconTransfer(server.DB, buyer.ID, 1, "", time.Hour)
+	if err != nil {
+		t.Errorf("this is the error requesting the transfer: %v\n", err)
+		return
+	}
+
+	expired, err := models.ExpireBeaconTransfers(server.DB, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Errorf("this is the error expiring the transfers: %v\n", err)
+		return
+	}
+	assert.Equal(t, expired, int64(1))
+
+	_, err = transfer.AcceptBeaconTransfer(server.DB, 2)
+	assert.Equal(t, err, models.ErrBeaconTransferNotPending)
+}
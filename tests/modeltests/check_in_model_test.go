@@ -0,0 +1,145 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestCheckInHistory(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	rssi := -60
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		_, _, err = beacons[i%2].CheckInPUC(server.DB, pucs[0].ID, start.Add(time.Duration(i)*time.Minute), &rssi, models.CheckInDedupe{})
+		if err != nil {
+			t.Errorf("this is the error checking in the puc: %v\n", err)
+			return
+		}
+	}
+
+	// a late check-in is kept in the history without replacing the latest one
+	_, _, err = beacons[1].CheckInPUC(server.DB, pucs[0].ID, start.Add(-time.Minute), nil, models.CheckInDedupe{})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+
+	page := models.CheckInPage{From: start.Add(-time.Hour), To: time.Now(), Limit: 2}
+	checkIns, err := models.FindPucCheckIns(server.DB, pucs[0].ID, page)
+	if err != nil {
+		t.Errorf("this is the error finding the check-ins: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*checkIns), 2)
+	assert.Equal(t, (*checkIns)[0].BeaconID, beacons[0].ID)
+	assert.Equal(t, *(*checkIns)[0].RSSI, -60)
+
+	// the next page continues from the last check-in returned
+	last := (*checkIns)[1]
+	page.To = last.CheckedInAt
+	page.BeforeID = last.ID
+	checkIns, err = models.FindPucCheckIns(server.DB, pucs[0].ID, page)
+	if err != nil {
+		t.Errorf("this is the error finding the check-ins: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*checkIns), 2)
+
+	checkIns, err = models.FindBeaconCheckIns(server.DB, beacons[1].ID, models.CheckInPage{From: page.From, To: time.Now()})
+	if err != nil {
+		t.Errorf("this is the error finding the check-ins: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*checkIns), 2)
+
+	// readers only see the check-ins credited to them or at their organisations' beacons
+	page = models.CheckInPage{From: start.Add(-time.Hour), To: time.Now()}
+	page.Access = models.PucAccess{Restricted: true, UserID: 1, OrganisationIDs: []uint64{beacons[0].OrganisationID}}
+	checkIns, err = models.FindPucCheckIns(server.DB, pucs[0].ID, page)
+	if err != nil {
+		t.Errorf("this is the error finding the check-ins: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*checkIns), 4)
+
+	page.Access = models.PucAccess{Restricted: true, UserID: 1}
+	checkIns, err = models.FindPucCheckIns(server.DB, pucs[0].ID, page)
+	if err != nil {
+		t.Errorf("this is the error finding the check-ins: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*checkIns), 0)
+
+	puc := models.Puc{}
+	_, err = puc.FindPucByID(server.DB, pucs[0].ID)
+	if err != nil {
+		t.Errorf("this is the error finding the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, *puc.LastBeaconCheckedIntoID, beacons[0].ID)
+}
+
+func TestCheckInDedupe(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	dedupe := models.CheckInDedupe{IdempotencyKey: "gw-1:0001", Window: time.Minute}
+	first, duplicate, err := beacons[0].CheckInPUC(server.DB, pucs[0].ID, start, nil, dedupe)
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, duplicate, false)
+
+	// a retry with the same key returns the recorded check-in
+	retried, duplicate, err := beacons[0].CheckInPUC(server.DB, pucs[0].ID, start, nil, dedupe)
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, duplicate, true)
+	assert.Equal(t, retried.ID, first.ID)
+
+	// another gateway hearing the same visit within the window
+	_, duplicate, err = beacons[0].CheckInPUC(server.DB, pucs[0].ID, start.Add(30*time.Second), nil, models.CheckInDedupe{IdempotencyKey: "gw-2:0001", Window: time.Minute})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, duplicate, true)
+
+	// outside the window, or at another beacon, is a new check-in
+	_, duplicate, err = beacons[0].CheckInPUC(server.DB, pucs[0].ID, start.Add(2*time.Minute), nil, models.CheckInDedupe{Window: time.Minute})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, duplicate, false)
+	_, duplicate, err = beacons[1].CheckInPUC(server.DB, pucs[0].ID, start, nil, models.CheckInDedupe{Window: time.Minute})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, duplicate, false)
+
+	// a key cannot be reused for a different check-in
+	_, _, err = beacons[1].CheckInPUC(server.DB, pucs[1].ID, start, nil, dedupe)
+	assert.Equal(t, err, models.ErrIdempotencyKeyReused)
+
+	checkIns, err := models.FindPucCheckIns(server.DB, pucs[0].ID, models.CheckInPage{From: start.Add(-time.Hour), To: time.Now()})
+	if err != nil {
+		t.Errorf("this is the error finding the check-ins: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*checkIns), 3)
+}
@@ -0,0 +1,115 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/visits"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestFindContacts(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	checkIns := []struct {
+		beacon models.Beacon
+		pucID  uint64
+		offset time.Duration
+	}{
+		{beacons[0], pucs[0].ID, 0},
+		{beacons[0], pucs[0].ID, 10 * time.Minute},
+		{beacons[0], pucs[1].ID, 5 * time.Minute},
+		{beacons[0], pucs[1].ID, 20 * time.Minute},
+		// at the venue but never at the same beacon at the same time
+		{beacons[1], pucs[1].ID, time.Hour},
+	}
+	for _, checkIn := range checkIns {
+		_, _, err = checkIn.beacon.CheckInPUC(server.DB, checkIn.pucID, start.Add(checkIn.offset), nil, models.CheckInDedupe{})
+		if err != nil {
+			t.Errorf("this is the error checking in the puc: %v\n", err)
+			return
+		}
+	}
+	_, err = models.RecomputeVisits(server.DB, []uint64{pucs[0].ID, pucs[1].ID}, start, time.Now(), 15*time.Minute)
+	if err != nil {
+		t.Errorf("this is the error recomputing the visits: %v\n", err)
+		return
+	}
+
+	query := models.ContactQuery{
+		OrganisationID: beacons[0].OrganisationID,
+		PucID:          pucs[0].ID,
+		Scope:          visits.ScopeBeacon,
+		From:           start.Add(-time.Hour),
+		To:             time.Now(),
+		Timeout:        15 * time.Minute,
+	}
+	contacts, err := models.FindContacts(server.DB, query)
+	if err != nil {
+		t.Errorf("this is the error finding the contacts: %v\n", err)
+		return
+	}
+	// each PUC is present until the timeout after its last check-in, from 5m
+	// until the first PUC's presence ends at 25m
+	assert.Equal(t, len(*contacts), 1)
+	assert.Equal(t, (*contacts)[0].PucID, pucs[1].ID)
+	assert.Equal(t, (*contacts)[0].OverlapSeconds, int64(1200))
+	assert.Equal(t, (*contacts)[0].FirstContact.Equal(start.Add(5*time.Minute)), true)
+	assert.Equal(t, (*contacts)[0].LastContact.Equal(start.Add(25*time.Minute)), true)
+
+	// a brief contact can be left out
+	query.MinOverlap = 30 * time.Minute
+	contacts, err = models.FindContacts(server.DB, query)
+	if err != nil {
+		t.Errorf("this is the error finding the contacts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*contacts), 0)
+
+	query.PucID = 0
+	_, err = models.FindContacts(server.DB, query)
+	assert.Equal(t, err, models.ErrContactSubjectRequired)
+}
+
+func TestFindContactsSingleCheckIn(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	// a single check-in is a visit that ends where it starts
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	for i, puc := range pucs {
+		_, _, err = beacons[0].CheckInPUC(server.DB, puc.ID, start.Add(time.Duration(i)*5*time.Minute), nil, models.CheckInDedupe{})
+		if err != nil {
+			t.Errorf("this is the error checking in the puc: %v\n", err)
+			return
+		}
+	}
+	_, err = models.RecomputeVisits(server.DB, []uint64{pucs[0].ID, pucs[1].ID}, start, time.Now(), 15*time.Minute)
+	if err != nil {
+		t.Errorf("this is the error recomputing the visits: %v\n", err)
+		return
+	}
+
+	contacts, err := models.FindContacts(server.DB, models.ContactQuery{
+		OrganisationID: beacons[0].OrganisationID,
+		PucID:          pucs[0].ID,
+		Scope:          visits.ScopeBeacon,
+		From:           start.Add(-time.Hour),
+		To:             time.Now(),
+		Timeout:        15 * time.Minute,
+	})
+	if err != nil {
+		t.Errorf("this is the error finding the contacts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*contacts), 1)
+	assert.Equal(t, (*contacts)[0].PucID, pucs[1].ID)
+	assert.Equal(t, (*contacts)[0].OverlapSeconds, int64(600))
+}
@@ -0,0 +1,64 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/labels"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+)
+
+func TestFindBeaconsBySelector(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	sets := []map[string]string{
+		{"floor": "1", "type": "entrance"},
+		{"floor": "2", "type": "storage"},
+		{"floor": "2"},
+	}
+	for i, _ := range beacons {
+		err = beacons[i].SetBeaconLabels(server.DB, sets[i])
+		if err != nil {
+			t.Errorf("this is the error labelling the beacon: %v\n", err)
+			return
+		}
+	}
+
+	selector, err := labels.Parse("floor in (1,2),type!=storage")
+	if err != nil {
+		t.Errorf("this is the error parsing the selector: %v\n", err)
+		return
+	}
+	found, err := beaconInstance.FindAllBeacons(server.DB, selector)
+	if err != nil {
+		t.Errorf("this is the error finding the beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 2)
+	assert.Equal(t, (*found)[0].ID, beacons[0].ID)
+	assert.Equal(t, (*found)[0].Labels["type"], "entrance")
+	assert.Equal(t, (*found)[1].ID, beacons[2].ID)
+
+	found, err = beaconInstance.FindOrganisationBeacons(server.DB, organisation.ID, selector)
+	if err != nil {
+		t.Errorf("this is the error finding the organisation beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 1)
+
+	// replacing the labels drops the ones not given
+	err = beacons[0].SetBeaconLabels(server.DB, map[string]string{"floor": "3"})
+	if err != nil {
+		t.Errorf("this is the error relabelling the beacon: %v\n", err)
+		return
+	}
+	selector, _ = labels.Parse("!type")
+	found, err = beaconInstance.FindAllBeacons(server.DB, selector)
+	if err != nil {
+		t.Errorf("this is the error finding the beacons: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 2)
+}
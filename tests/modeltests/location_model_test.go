@@ -0,0 +1,75 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+)
+
+func TestLocationHierarchy(t *testing.T) {
+	organisation, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		log.Fatalf("Error seeding organisation and beacon table %v\n", err)
+	}
+
+	site, err := (&models.Location{OrganisationID: organisation.ID, Kind: models.LocationKindSite, Name: "Civic"}).SaveLocation(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the site: %v\n", err)
+		return
+	}
+
+	// a floor cannot sit directly under a site
+	_, err = (&models.Location{OrganisationID: organisation.ID, Kind: models.LocationKindFloor, Name: "Ground", ParentID: &site.ID}).SaveLocation(server.DB)
+	assert.NotEqual(t, err, nil)
+
+	building, err := (&models.Location{OrganisationID: organisation.ID, Kind: models.LocationKindBuilding, Name: "Main", ParentID: &site.ID}).SaveLocation(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the building: %v\n", err)
+		return
+	}
+	floor, err := (&models.Location{OrganisationID: organisation.ID, Kind: models.LocationKindFloor, Name: "Ground", ParentID: &building.ID}).SaveLocation(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the floor: %v\n", err)
+		return
+	}
+	zone, err := (&models.Location{OrganisationID: organisation.ID, Kind: models.LocationKindZone, Name: "Counter", ParentID: &floor.ID}).SaveLocation(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the zone: %v\n", err)
+		return
+	}
+
+	err = beacons[0].AssignBeaconToZone(server.DB, &zone.ID)
+	if err != nil {
+		t.Errorf("this is the error assigning the beacon: %v\n", err)
+		return
+	}
+	err = beacons[0].MarkSeen(server.DB, beacons[0].LastUpdated)
+	if err != nil {
+		t.Errorf("this is the error marking the beacon seen: %v\n", err)
+		return
+	}
+	err = beacons[1].AssignBeaconToZone(server.DB, &zone.ID)
+	if err != nil {
+		t.Errorf("this is the error assigning the beacon: %v\n", err)
+		return
+	}
+
+	// beacons outside the organisation cannot join its zones
+	err = beacons[2].AssignBeaconToZone(server.DB, &zone.ID)
+	assert.NotEqual(t, err, nil)
+
+	tree, err := (&models.Location{}).FindOrganisationLocationTree(server.DB, organisation.ID)
+	if err != nil {
+		t.Errorf("this is the error finding the location tree: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(tree), 1)
+	assert.Equal(t, tree[0].Stats.BeaconCount, 2)
+	assert.Equal(t, tree[0].Stats.OnlineRatio, 0.5)
+	assert.Equal(t, tree[0].Children[0].Children[0].Children[0].ID, zone.ID)
+	assert.Equal(t, tree[0].Children[0].Children[0].Children[0].Stats.OnlineCount, 1)
+
+	err = (&models.Location{}).DeleteLocation(server.DB, zone.ID)
+	assert.Equal(t, err, models.ErrLocationNotEmpty)
+}
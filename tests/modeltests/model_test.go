@@ -13,6 +13,7 @@ import (
 var server = controllers.Server{}
 var userInstance = models.User{}
 var ticketInstance = models.Ticket{}
+var beaconInstance = models.Beacon{}
 
 // convention
 func TestMain(m *testing.M) {
@@ -191,3 +192,97 @@ func seedUsersAndTickets() ([]models.User, []models.Ticket, error) {
 	}
 	return users, tickets, nil
 }
+
+func refreshOrganisationAndBeaconTable() error {
+	err := server.DB.DropTableIfExists(&models.CheckInRejection{}, &models.Gateway{}, &models.BeaconEphemeralID{}, &models.BeaconClaimCode{}, &models.BeaconTransfer{}, &models.Label{}, &models.CheckInNonce{}, &models.BeaconEvent{}, &models.BeaconEventType{}, &models.BeaconTelemetry{}, &models.BeaconStatusTransition{}, &models.OccupancySnapshot{}, &models.Sighting{}, &models.Visit{}, &models.CheckIn{}, &models.PucAlert{}, &models.PucLossReport{}, &models.PucCustody{}, &models.Puc{}, &models.Beacon{}, &models.Location{}, &models.Organisation{}).Error
+
+	if err != nil {
+		log.Fatalf("[Error] Unable to drop tables for testing, %v", err)
+		return err
+	}
+
+	err = server.DB.AutoMigrate(&models.Organisation{}, &models.Location{}, &models.Beacon{}, &models.Puc{}, &models.PucCustody{}, &models.PucLossReport{}, &models.PucAlert{}, &models.CheckIn{}, &models.Visit{}, &models.Sighting{}, &models.OccupancySnapshot{}, &models.BeaconStatusTransition{}, &models.BeaconTelemetry{}, &models.BeaconEventType{}, &models.BeaconEvent{}, &models.CheckInNonce{}, &models.Label{}, &models.BeaconTransfer{}, &models.BeaconClaimCode{}, &models.BeaconEphemeralID{}, &models.Gateway{}, &models.CheckInRejection{}).Error
+
+	if err != nil {
+		log.Fatalf("[Error] Unable to migrate tables for testing, %v", err)
+		return err
+	}
+
+	err = models.CreateBeaconIdentityIndexes(server.DB)
+
+	if err != nil {
+		log.Fatalf("[Error] Unable to create beacon identity indexes for testing, %v", err)
+		return err
+	}
+
+	log.Printf("successfully refreshed tables for testing")
+	return nil
+}
+
+func seedOrganisationAndBeacons() (models.Organisation, []models.Beacon, error) {
+	err := refreshOrganisationAndBeaconTable()
+
+	if err != nil {
+		return models.Organisation{}, []models.Beacon{}, err
+	}
+
+	organisation := models.Organisation{
+		Region:     "Canberra",
+		EntityName: "Ladomme Cafe",
+	}
+
+	err = server.DB.Model(&models.Organisation{}).Create(&organisation).Error
+
+	if err != nil {
+		log.Fatalf("[ERR] Unable to create organisation for testing %v", err)
+		return models.Organisation{}, []models.Beacon{}, err
+	}
+
+	beacons := []models.Beacon{
+		models.Beacon{
+			MacAddress:     "F0:2A:61:00:00:01",
+			OrganisationID: organisation.ID,
+		},
+		models.Beacon{
+			MacAddress:     "F0:2A:61:00:00:02",
+			OrganisationID: organisation.ID,
+		},
+		models.Beacon{
+			MacAddress: "F0:2A:61:00:00:03",
+		},
+	}
+
+	for i, _ := range beacons {
+		err = server.DB.Model(&models.Beacon{}).Create(&beacons[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed beacons table: %v", err)
+		}
+	}
+
+	return organisation, beacons, nil
+}
+
+func seedOrganisationBeaconsAndPucs() ([]models.Beacon, []models.Puc, error) {
+	_, beacons, err := seedOrganisationAndBeacons()
+	if err != nil {
+		return []models.Beacon{}, []models.Puc{}, err
+	}
+
+	pucs := []models.Puc{
+		models.Puc{
+			SerialNumber: "PUC-0001",
+		},
+		models.Puc{
+			SerialNumber: "PUC-0002",
+		},
+	}
+
+	for i, _ := range pucs {
+		err = server.DB.Model(&models.Puc{}).Create(&pucs[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed pucs table: %v", err)
+		}
+	}
+
+	return beacons, pucs, nil
+}
@@ -0,0 +1,67 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestOccupancy(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+	organisationID := beacons[0].OrganisationID
+
+	now := time.Now().Truncate(time.Second)
+	checkIns := []struct {
+		beacon models.Beacon
+		pucID  uint64
+		at     time.Time
+	}{
+		{beacons[0], pucs[0].ID, now.Add(-10 * time.Minute)},
+		{beacons[1], pucs[0].ID, now.Add(-5 * time.Minute)},
+		// checked in too long ago to still be present
+		{beacons[0], pucs[1].ID, now.Add(-20 * time.Minute)},
+	}
+	for _, checkIn := range checkIns {
+		_, _, err = checkIn.beacon.CheckInPUC(server.DB, checkIn.pucID, checkIn.at, nil, models.CheckInDedupe{})
+		if err != nil {
+			t.Errorf("this is the error checking in the puc: %v\n", err)
+			return
+		}
+	}
+
+	// moving between beacons of the organisation counts the PUC once
+	occupancy, err := models.FindOccupancy(server.DB, organisationID, now, 15*time.Minute)
+	if err != nil {
+		t.Errorf("this is the error finding the occupancy: %v\n", err)
+		return
+	}
+	assert.Equal(t, occupancy.Count, 1)
+
+	// earlier in the day both were present
+	occupancy, err = models.FindOccupancy(server.DB, organisationID, now.Add(-10*time.Minute), 15*time.Minute)
+	if err != nil {
+		t.Errorf("this is the error finding the occupancy: %v\n", err)
+		return
+	}
+	assert.Equal(t, occupancy.Count, 2)
+
+	written, err := models.TakeOccupancySnapshots(server.DB, now, 15*time.Minute)
+	if err != nil {
+		t.Errorf("this is the error taking the snapshots: %v\n", err)
+		return
+	}
+	assert.Equal(t, written, 1)
+
+	snapshots, err := models.FindOccupancySnapshots(server.DB, organisationID, nil, now.Add(-time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error finding the snapshots: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*snapshots), 1)
+	assert.Equal(t, (*snapshots)[0].Count, 1)
+}
@@ -0,0 +1,134 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestCheckOutAndReturnPuc(t *testing.T) {
+	_, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+
+	custody, err := pucs[0].CheckOutPuc(server.DB, user.ID, user.ID, "morning shift", false)
+	if err != nil {
+		t.Errorf("this is the error checking out the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, custody.UserID, user.ID)
+	assert.Equal(t, *pucs[0].CurrentUserID, user.ID)
+
+	holder := models.User{}
+	_, err = holder.FindUserByID(server.DB, user.ID)
+	if err != nil {
+		t.Errorf("this is the error finding the user: %v\n", err)
+		return
+	}
+	assert.Equal(t, *holder.CurrentPucHeldID, pucs[0].ID)
+
+	// the puc is already held, and the user already holds one
+	_, err = pucs[0].CheckOutPuc(server.DB, user.ID, user.ID, "", true)
+	assert.Equal(t, err, models.ErrPucAlreadyCheckedOut)
+	_, err = pucs[1].CheckOutPuc(server.DB, user.ID, user.ID, "", false)
+	assert.Equal(t, err, models.ErrUserAlreadyHoldsPuc)
+
+	custody, err = pucs[0].ReturnPuc(server.DB, user.ID, "end of shift")
+	if err != nil {
+		t.Errorf("this is the error returning the puc: %v\n", err)
+		return
+	}
+	assert.NotEqual(t, custody.ReturnedAt, nil)
+	assert.Equal(t, pucs[0].CurrentUserID, (*uint32)(nil))
+
+	holder = models.User{}
+	_, err = holder.FindUserByID(server.DB, user.ID)
+	if err != nil {
+		t.Errorf("this is the error finding the user: %v\n", err)
+		return
+	}
+	assert.Equal(t, holder.CurrentPucHeldID, (*uint64)(nil))
+
+	_, err = pucs[0].ReturnPuc(server.DB, user.ID, "")
+	assert.Equal(t, err, models.ErrPucNotCheckedOut)
+}
+
+func TestCheckOutSeveralPucs(t *testing.T) {
+	_, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+
+	for i, _ := range pucs {
+		_, err = pucs[i].CheckOutPuc(server.DB, user.ID, user.ID, "", true)
+		if err != nil {
+			t.Errorf("this is the error checking out the puc: %v\n", err)
+			return
+		}
+	}
+
+	// returning the latest puc points the user back at the one they still hold
+	_, err = pucs[1].ReturnPuc(server.DB, user.ID, "")
+	if err != nil {
+		t.Errorf("this is the error returning the puc: %v\n", err)
+		return
+	}
+
+	holder := models.User{}
+	_, err = holder.FindUserByID(server.DB, user.ID)
+	if err != nil {
+		t.Errorf("this is the error finding the user: %v\n", err)
+		return
+	}
+	assert.Equal(t, *holder.CurrentPucHeldID, pucs[0].ID)
+}
+
+func TestFindPucCustodyHistory(t *testing.T) {
+	_, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+
+	_, err = pucs[0].CheckOutPuc(server.DB, user.ID, user.ID, "", false)
+	if err != nil {
+		t.Errorf("this is the error checking out the puc: %v\n", err)
+		return
+	}
+	heldAt := time.Now()
+	_, err = pucs[0].ReturnPuc(server.DB, user.ID, "")
+	if err != nil {
+		t.Errorf("this is the error returning the puc: %v\n", err)
+		return
+	}
+
+	history, err := models.FindPucCustodyHistory(server.DB, pucs[0].ID, heldAt, heldAt)
+	if err != nil {
+		t.Errorf("this is the error finding the custody history: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*history), 1)
+	assert.Equal(t, (*history)[0].UserID, user.ID)
+
+	later := time.Now().Add(time.Minute)
+	history, err = models.FindPucCustodyHistory(server.DB, pucs[0].ID, later, later)
+	if err != nil {
+		t.Errorf("this is the error finding the custody history: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*history), 0)
+}
@@ -0,0 +1,177 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/ingest"
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestLostPucAlerts(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+	err = models.SeedBeaconEventTypes(server.DB)
+	if err != nil {
+		log.Fatalf("Error seeding event types %v\n", err)
+	}
+
+	_, err = pucs[0].CheckOutPuc(server.DB, user.ID, user.ID, "", false)
+	if err != nil {
+		t.Errorf("this is the error checking out the puc: %v\n", err)
+		return
+	}
+
+	report, err := pucs[0].ReportPucLost(server.DB, user.ID, "left on the train", true)
+	if err != nil {
+		t.Errorf("this is the error reporting the puc lost: %v\n", err)
+		return
+	}
+	assert.Equal(t, *report.HolderID, user.ID)
+	assert.NotEqual(t, pucs[0].LostAt, nil)
+
+	_, err = pucs[0].ReportPucLost(server.DB, user.ID, "", false)
+	assert.Equal(t, err, models.ErrPucAlreadyLost)
+
+	// a sighting of the lost puc raises an alert and is not credited to its holder
+	sightedAt := time.Now().Truncate(time.Second)
+	checkIn, _, err := beacons[0].CheckInPUC(server.DB, pucs[0].ID, sightedAt, nil, models.CheckInDedupe{})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, checkIn.UserID, nil)
+
+	alerts, err := models.FindPucAlerts(server.DB, pucs[0].ID, sightedAt.Add(-time.Hour), sightedAt.Add(time.Hour))
+	if err != nil {
+		t.Errorf("this is the error finding the alerts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*alerts), 1)
+	assert.Equal(t, (*alerts)[0].BeaconID, beacons[0].ID)
+	assert.Equal(t, (*alerts)[0].OrganisationID, beacons[0].OrganisationID)
+	assert.Equal(t, (*alerts)[0].LossReportID, report.ID)
+	assert.Equal(t, *(*alerts)[0].CheckInID, checkIn.ID)
+
+	// a repeat of a check-in that already raised an alert raises no more
+	repeat, duplicate, err := beacons[0].CheckInPUC(server.DB, pucs[0].ID, sightedAt.Add(10*time.Second), nil, models.CheckInDedupe{Window: time.Minute})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, duplicate, true)
+	assert.Equal(t, repeat.ID, checkIn.ID)
+
+	// a gateway hearing the lost puc raises an alert once, however often the
+	// sighting is sent
+	rssi := -70
+	batch := &ingest.Batch{
+		Sightings: []ingest.Sighting{
+			{BeaconID: beacons[1].ID, PucID: pucs[0].ID, RSSI: &rssi, Timestamp: sightedAt.Add(20 * time.Second).Unix()},
+		},
+		Records: []int{1},
+	}
+	options := ingest.Options{MaxAge: time.Hour, ClockSkew: time.Minute, OrganisationID: beacons[1].OrganisationID, GatewayID: 1}
+	for i := 0; i < 2; i++ {
+		_, err = ingest.Ingest(server.DB, batch, time.Now(), options)
+		if err != nil {
+			t.Errorf("this is the error ingesting the sightings: %v\n", err)
+			return
+		}
+	}
+
+	alerts, err = models.FindPucAlerts(server.DB, pucs[0].ID, sightedAt.Add(-time.Hour), sightedAt.Add(time.Hour))
+	if err != nil {
+		t.Errorf("this is the error finding the alerts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*alerts), 2)
+	assert.Equal(t, (*alerts)[0].BeaconID, beacons[1].ID)
+	assert.Equal(t, (*alerts)[0].CheckInID, nil)
+
+	found, err := pucs[0].ReportPucFound(server.DB, user.ID, "handed in at reception")
+	if err != nil {
+		t.Errorf("this is the error reporting the puc found: %v\n", err)
+		return
+	}
+	assert.Equal(t, found.ID, report.ID)
+	assert.Equal(t, pucs[0].LostAt, nil)
+
+	_, err = pucs[0].ReportPucFound(server.DB, user.ID, "")
+	assert.Equal(t, err, models.ErrPucNotLost)
+
+	// once found its check-ins are ordinary again
+	checkIn, _, err = beacons[1].CheckInPUC(server.DB, pucs[0].ID, sightedAt.Add(time.Minute), nil, models.CheckInDedupe{})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, *checkIn.UserID, user.ID)
+
+	alerts, err = models.FindPucAlerts(server.DB, pucs[0].ID, sightedAt.Add(-time.Hour), sightedAt.Add(time.Hour))
+	if err != nil {
+		t.Errorf("this is the error finding the alerts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*alerts), 2)
+
+	reports, err := models.FindPucLossReports(server.DB, pucs[0].ID)
+	if err != nil {
+		t.Errorf("this is the error finding the loss reports: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*reports), 1)
+	assert.NotEqual(t, (*reports)[0].FoundAt, nil)
+}
+
+func TestLostPucRepeatedCheckInAlert(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+	err = models.SeedBeaconEventTypes(server.DB)
+	if err != nil {
+		log.Fatalf("Error seeding event types %v\n", err)
+	}
+
+	sightedAt := time.Now().Truncate(time.Second)
+	checkIn, _, err := beacons[0].CheckInPUC(server.DB, pucs[0].ID, sightedAt, nil, models.CheckInDedupe{})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+
+	_, err = pucs[0].ReportPucLost(server.DB, user.ID, "", false)
+	if err != nil {
+		t.Errorf("this is the error reporting the puc lost: %v\n", err)
+		return
+	}
+
+	// the repeat is not recorded, but it still places the lost puc at the beacon
+	_, duplicate, err := beacons[0].CheckInPUC(server.DB, pucs[0].ID, sightedAt.Add(10*time.Second), nil, models.CheckInDedupe{Window: time.Minute})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, duplicate, true)
+
+	alerts, err := models.FindPucAlerts(server.DB, pucs[0].ID, sightedAt.Add(-time.Hour), sightedAt.Add(time.Hour))
+	if err != nil {
+		t.Errorf("this is the error finding the alerts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*alerts), 1)
+	assert.Equal(t, *(*alerts)[0].CheckInID, checkIn.ID)
+	assert.Equal(t, (*alerts)[0].SightedAt.Equal(sightedAt.Add(10*time.Second)), true)
+}
@@ -1 +1,110 @@
 package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestSaveAndFindPuc(t *testing.T) {
+	_, _, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	puc := models.Puc{SerialNumber: " PUC-0003 ", Labels: map[string]string{"team": "kitchen"}}
+	puc.Prepare()
+	saved, err := puc.SavePuc(server.DB)
+	if err != nil {
+		t.Errorf("this is the error saving the puc: %v\n", err)
+		return
+	}
+
+	found, err := (&models.Puc{}).FindPucByID(server.DB, saved.ID)
+	if err != nil {
+		t.Errorf("this is the error finding the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, found.SerialNumber, "PUC-0003")
+	assert.Equal(t, found.Labels["team"], "kitchen")
+
+	_, err = (&models.Puc{}).FindPucByID(server.DB, saved.ID+1)
+	assert.Equal(t, err, models.ErrPucNotFound)
+}
+
+func TestUpdateAndDeletePuc(t *testing.T) {
+	_, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	pucUpdate := models.Puc{SerialNumber: "PUC-0101"}
+	updated, err := pucUpdate.UpdatePuc(server.DB, pucs[0].ID)
+	if err != nil {
+		t.Errorf("this is the error updating the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, updated.SerialNumber, "PUC-0101")
+
+	user, err := seedOneUser()
+	if err != nil {
+		log.Fatalf("Error seeding user table %v\n", err)
+	}
+	_, err = pucs[0].CheckOutPuc(server.DB, user.ID, user.ID, "", false)
+	if err != nil {
+		t.Errorf("this is the error checking out the puc: %v\n", err)
+		return
+	}
+
+	isDeleted, err := (&models.Puc{}).DeletePuc(server.DB, pucs[0].ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, isDeleted, int64(1))
+
+	_, err = (&models.Puc{}).DeletePuc(server.DB, pucs[0].ID)
+	assert.Equal(t, err, models.ErrPucNotFound)
+
+	// the custody history outlives the puc
+	history, err := models.FindPucCustodyHistory(server.DB, pucs[0].ID, time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Errorf("this is the error finding the custody history: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*history), 1)
+	assert.NotEqual(t, (*history)[0].ReturnedAt, nil)
+}
+
+func TestCheckInPUC(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	_, _, err = beacons[0].CheckInPUC(server.DB, pucs[0].ID, time.Now(), nil, models.CheckInDedupe{})
+	if err != nil {
+		t.Errorf("this is the error checking in the puc: %v\n", err)
+		return
+	}
+
+	found, err := (&models.Puc{}).FindPucByID(server.DB, pucs[0].ID)
+	if err != nil {
+		t.Errorf("this is the error finding the puc: %v\n", err)
+		return
+	}
+	assert.Equal(t, *found.LastBeaconCheckedIntoID, beacons[0].ID)
+
+	// a late check-in does not replace a more recent one
+	err = found.RecordCheckIn(server.DB, beacons[1].ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Errorf("this is the error recording the check-in: %v\n", err)
+		return
+	}
+	assert.Equal(t, *found.LastBeaconCheckedIntoID, beacons[0].ID)
+
+	_, _, err = beacons[0].CheckInPUC(server.DB, pucs[1].ID+10, time.Now(), nil, models.CheckInDedupe{})
+	assert.NotEqual(t, err, nil)
+}
@@ -0,0 +1,77 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEstimatePucPosition(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	// three beacons about 100m apart, all heard at the same strength
+	coordinates := [][2]float64{{-33.8688, 151.2093}, {-33.8688, 151.2104}, {-33.8679, 151.2093}}
+	for i, beacon := range beacons {
+		err = server.DB.Model(&models.Beacon{}).Where("id = ?", beacon.ID).
+			Updates(map[string]interface{}{"latitude": coordinates[i][0], "longitude": coordinates[i][1]}).Error
+		if err != nil {
+			log.Fatalf("Error placing beacons %v\n", err)
+		}
+	}
+
+	now := time.Now().Truncate(time.Second)
+	var sightings []models.Sighting
+	for _, beacon := range beacons {
+		sightings = append(sightings, models.Sighting{GatewayID: 1, BeaconID: beacon.ID, PucID: pucs[0].ID, RSSI: -99, SeenAt: now.Add(-5 * time.Second)})
+	}
+	// only heard by one beacon
+	sightings = append(sightings, models.Sighting{GatewayID: 1, BeaconID: beacons[0].ID, PucID: pucs[1].ID, RSSI: -59, SeenAt: now.Add(-5 * time.Second)})
+	_, err = models.InsertSightings(server.DB, sightings)
+	if err != nil {
+		log.Fatalf("Error seeding sightings %v\n", err)
+	}
+
+	options := models.PositioningOptions{Window: time.Minute, PathLossExponent: 2}
+	position, err := models.EstimatePucPosition(server.DB, pucs[0].ID, now, options)
+	if err != nil {
+		t.Errorf("this is the error estimating the position: %v\n", err)
+		return
+	}
+	assert.Equal(t, position.Method, models.PositionTrilateration)
+	assert.Equal(t, len(position.Beacons), 3)
+	// equidistant from the three corners puts it near the middle of the square
+	assert.Equal(t, math.Abs(position.Latitude-(-33.86835)) < 0.0002, true)
+	assert.Equal(t, math.Abs(position.Longitude-151.20985) < 0.0002, true)
+
+	position, err = models.EstimatePucPosition(server.DB, pucs[1].ID, now, options)
+	if err != nil {
+		t.Errorf("this is the error estimating the position: %v\n", err)
+		return
+	}
+	assert.Equal(t, position.Method, models.PositionProximity)
+	assert.Equal(t, position.Latitude, coordinates[0][0])
+	assert.Equal(t, position.AccuracyMetres, 1.0)
+
+	// nothing heard in the window
+	_, err = models.EstimatePucPosition(server.DB, pucs[0].ID, now.Add(time.Hour), options)
+	assert.Equal(t, err, models.ErrPositionUnknown)
+
+	// readers only use what was heard while they held the puc or at their beacons
+	options.Access = models.PucAccess{Restricted: true, UserID: 1, OrganisationIDs: []uint64{beacons[0].OrganisationID}}
+	position, err = models.EstimatePucPosition(server.DB, pucs[0].ID, now, options)
+	if err != nil {
+		t.Errorf("this is the error estimating the position: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(position.Beacons), 3)
+
+	options.Access = models.PucAccess{Restricted: true, UserID: 1}
+	_, err = models.EstimatePucPosition(server.DB, pucs[0].ID, now, options)
+	assert.Equal(t, err, models.ErrPositionUnknown)
+}
@@ -0,0 +1,49 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/ingest"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestIngestSightings(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	now := time.Now()
+	rssi := -70
+	batch := &ingest.Batch{
+		Sightings: []ingest.Sighting{
+			{BeaconID: beacons[0].ID, PucID: pucs[0].ID, RSSI: &rssi, Timestamp: now.Unix()},
+			{MacAddress: beacons[0].MacAddress, PucID: pucs[0].ID, RSSI: &rssi, Timestamp: now.Unix()},
+			{BeaconID: beacons[1].ID, PucID: pucs[1].ID + 10, RSSI: &rssi, Timestamp: now.Unix()},
+			{MacAddress: "F0:2A:61:00:00:FF", PucID: pucs[1].ID, RSSI: &rssi, Timestamp: now.Unix()},
+			{BeaconID: beacons[2].ID, PucID: pucs[1].ID, RSSI: &rssi, Timestamp: now.Unix()},
+		},
+		Records: []int{1, 2, 3, 4, 5},
+	}
+	// only beacons of the gateway's organisation are resolved
+	options := ingest.Options{MaxAge: time.Hour, ClockSkew: time.Minute, OrganisationID: beacons[0].OrganisationID, GatewayID: 1}
+
+	ack, err := ingest.Ingest(server.DB, batch, now, options)
+	if err != nil {
+		t.Errorf("this is the error ingesting the sightings: %v\n", err)
+		return
+	}
+	assert.Equal(t, ack.Accepted, 1)
+	assert.Equal(t, ack.Duplicate, 1)
+	assert.Equal(t, ack.Rejected, 3)
+
+	// a batch sent again is all duplicates
+	ack, err = ingest.Ingest(server.DB, batch, now, options)
+	if err != nil {
+		t.Errorf("this is the error ingesting the sightings: %v\n", err)
+		return
+	}
+	assert.Equal(t, ack.Accepted, 0)
+	assert.Equal(t, ack.Duplicate, 2)
+}
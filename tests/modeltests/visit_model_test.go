@@ -0,0 +1,71 @@
+package modeltests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/models"
+	"github.com/SherbazHashmi/goblog/api/visits"
+	"gopkg.in/go-playground/assert.v1"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestRecomputeVisits(t *testing.T) {
+	beacons, pucs, err := seedOrganisationBeaconsAndPucs()
+	if err != nil {
+		log.Fatalf("Error seeding beacon and puc tables %v\n", err)
+	}
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, offset := range []time.Duration{0, 10 * time.Minute, 20 * time.Minute} {
+		_, _, err = beacons[0].CheckInPUC(server.DB, pucs[0].ID, start.Add(offset), nil, models.CheckInDedupe{})
+		if err != nil {
+			t.Errorf("this is the error checking in the puc: %v\n", err)
+			return
+		}
+	}
+
+	filter := models.VisitFilter{PucID: pucs[0].ID, Scope: visits.ScopeBeacon, From: start, To: time.Now()}
+
+	_, err = models.RecomputeVisits(server.DB, []uint64{pucs[0].ID}, start, start.Add(20*time.Minute), 15*time.Minute)
+	if err != nil {
+		t.Errorf("this is the error recomputing the visits: %v\n", err)
+		return
+	}
+	found, err := models.FindVisits(server.DB, filter)
+	if err != nil {
+		t.Errorf("this is the error finding the visits: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 1)
+	assert.Equal(t, (*found)[0].DwellSeconds, int64(20*60))
+	assert.Equal(t, (*found)[0].CheckIns, 3)
+
+	// a shorter timeout splits the visit, without leaving the old one behind
+	_, err = models.RecomputeVisits(server.DB, []uint64{pucs[0].ID}, start.Add(10*time.Minute), start.Add(10*time.Minute), 5*time.Minute)
+	if err != nil {
+		t.Errorf("this is the error recomputing the visits: %v\n", err)
+		return
+	}
+	found, err = models.FindVisits(server.DB, filter)
+	if err != nil {
+		t.Errorf("this is the error finding the visits: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 3)
+
+	// a reader without access to the organisation sees none of them
+	filter.Access = models.PucAccess{Restricted: true, UserID: 1, OrganisationIDs: []uint64{beacons[0].OrganisationID + 1}}
+	found, err = models.FindVisits(server.DB, filter)
+	if err != nil {
+		t.Errorf("this is the error finding the visits: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*found), 0)
+
+	pucIDs, err := models.FindCheckedInPucs(server.DB, beacons[0].OrganisationID, start, time.Now())
+	if err != nil {
+		t.Errorf("this is the error finding the checked in pucs: %v\n", err)
+		return
+	}
+	assert.Equal(t, pucIDs, []uint64{pucs[0].ID})
+}
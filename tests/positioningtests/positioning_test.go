@@ -0,0 +1,80 @@
+package positioningtests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/positioning"
+	"gopkg.in/go-playground/assert.v1"
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	// at the calibrated power the receiver is a metre away
+	assert.Equal(t, positioning.Distance(-59, -59, 2), 1.0)
+	// every 20 dB lost in free space is ten times further
+	assert.Equal(t, math.Abs(positioning.Distance(-79, -59, 2)-10) < 1e-9, true)
+	// an unset exponent falls back to free space
+	assert.Equal(t, positioning.Distance(-79, -59, 0), positioning.Distance(-79, -59, 2))
+}
+
+func TestSmoothRSSI(t *testing.T) {
+	assert.Equal(t, positioning.SmoothRSSI([]float64{-70}), -70.0)
+
+	// a single outlier barely moves a settled estimate
+	readings := []float64{-70, -70, -70, -70, -70, -70, -70, -70, -40}
+	smoothed := positioning.SmoothRSSI(readings)
+	assert.Equal(t, smoothed < -65, true)
+	assert.Equal(t, smoothed > -70, true)
+}
+
+func TestTrilaterate(t *testing.T) {
+	anchors := []positioning.Anchor{
+		{X: 0, Y: 0, Distance: 5},
+		{X: 10, Y: 0, Distance: math.Hypot(7, 4)},
+		{X: 0, Y: 10, Distance: math.Hypot(3, 6)},
+	}
+
+	x, y, rms, err := positioning.Trilaterate(anchors)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, math.Abs(x-3) < 1e-6, true)
+	assert.Equal(t, math.Abs(y-4) < 1e-6, true)
+	assert.Equal(t, rms < 1e-6, true)
+
+	// a fourth noisy anchor still lands close and reports the error
+	anchors = append(anchors, positioning.Anchor{X: 10, Y: 10, Distance: math.Hypot(7, 6) + 1})
+	x, y, rms, err = positioning.Trilaterate(anchors)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, math.Hypot(x-3, y-4) < 1, true)
+	assert.Equal(t, rms > 0, true)
+}
+
+func TestTrilaterateNeedsThreeAnchorsOffALine(t *testing.T) {
+	_, _, _, err := positioning.Trilaterate([]positioning.Anchor{
+		{X: 0, Y: 0, Distance: 1},
+		{X: 1, Y: 0, Distance: 1},
+	})
+	assert.Equal(t, err, positioning.ErrNotEnoughAnchors)
+
+	_, _, _, err = positioning.Trilaterate([]positioning.Anchor{
+		{X: 0, Y: 0, Distance: 1},
+		{X: 5, Y: 0, Distance: 4},
+		{X: 10, Y: 0, Distance: 9},
+	})
+	assert.Equal(t, err, positioning.ErrCollinearAnchors)
+}
+
+func TestProjectRoundTrip(t *testing.T) {
+	originLatitude, originLongitude := -33.8688, 151.2093
+
+	x, y := positioning.Project(originLatitude, originLongitude, originLatitude, originLongitude)
+	assert.Equal(t, x, 0.0)
+	assert.Equal(t, y, 0.0)
+
+	// a thousandth of a degree north is roughly 111 metres
+	_, y = positioning.Project(originLatitude+0.001, originLongitude, originLatitude, originLongitude)
+	assert.Equal(t, math.Abs(y-111.19) < 0.1, true)
+
+	latitude, longitude := positioning.Unproject(25, -40, originLatitude, originLongitude)
+	x, y = positioning.Project(latitude, longitude, originLatitude, originLongitude)
+	assert.Equal(t, math.Abs(x-25) < 1e-6, true)
+	assert.Equal(t, math.Abs(y+40) < 1e-6, true)
+}
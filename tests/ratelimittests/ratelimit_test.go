@@ -0,0 +1,29 @@
+package ratelimittests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/ratelimit"
+	"gopkg.in/go-playground/assert.v1"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	limiter := ratelimit.New(2, time.Minute)
+	start := time.Now()
+
+	allowed, _ := limiter.Allow("user:1", start)
+	assert.Equal(t, allowed, true)
+	allowed, _ = limiter.Allow("user:1", start.Add(time.Second))
+	assert.Equal(t, allowed, true)
+
+	allowed, retryAfter := limiter.Allow("user:1", start.Add(20*time.Second))
+	assert.Equal(t, allowed, false)
+	assert.Equal(t, retryAfter, 40*time.Second)
+
+	// keys are limited independently
+	allowed, _ = limiter.Allow("user:2", start.Add(20*time.Second))
+	assert.Equal(t, allowed, true)
+
+	allowed, _ = limiter.Allow("user:1", start.Add(time.Minute))
+	assert.Equal(t, allowed, true)
+}
@@ -0,0 +1,74 @@
+package visitstests
+
+import (
+	"github.com/SherbazHashmi/goblog/api/visits"
+	"gopkg.in/go-playground/assert.v1"
+	"testing"
+	"time"
+)
+
+func TestSessionise(t *testing.T) {
+	start := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	checkIns := []visits.CheckIn{
+		{ID: 1, At: start, BeaconID: 1, ZoneID: 10, OrganisationID: 100},
+		{ID: 2, At: start.Add(5 * time.Minute), BeaconID: 1, ZoneID: 10, OrganisationID: 100},
+		{ID: 3, At: start.Add(8 * time.Minute), BeaconID: 2, ZoneID: 10, OrganisationID: 100},
+		// a gap longer than the timeout ends every session
+		{ID: 4, At: start.Add(40 * time.Minute), BeaconID: 2, OrganisationID: 100},
+	}
+
+	sessions := visits.Sessionise(checkIns, 15*time.Minute)
+
+	count := map[string]int{}
+	for _, session := range sessions {
+		count[session.Scope]++
+	}
+	assert.Equal(t, count[visits.ScopeBeacon], 3)
+	assert.Equal(t, count[visits.ScopeZone], 1)
+	assert.Equal(t, count[visits.ScopeOrganisation], 2)
+
+	for _, session := range sessions {
+		if session.Scope == visits.ScopeZone {
+			assert.Equal(t, session.ScopeID, uint64(10))
+			assert.Equal(t, session.Dwell(), 8*time.Minute)
+			assert.Equal(t, session.CheckIns, 3)
+		}
+	}
+	assert.Equal(t, sessions[0].EnteredAt, start)
+}
+
+func TestSessioniseOutOfOrder(t *testing.T) {
+	start := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	checkIns := []visits.CheckIn{
+		{ID: 2, At: start.Add(10 * time.Minute), BeaconID: 1},
+		{ID: 1, At: start, BeaconID: 1},
+	}
+
+	sessions := visits.Sessionise(checkIns, 15*time.Minute)
+	assert.Equal(t, len(sessions), 1)
+	assert.Equal(t, sessions[0].FirstCheckInID, uint64(1))
+	assert.Equal(t, sessions[0].Dwell(), 10*time.Minute)
+
+	// a shorter timeout splits the same check-ins in two
+	sessions = visits.Sessionise(checkIns, 5*time.Minute)
+	assert.Equal(t, len(sessions), 2)
+	assert.Equal(t, visits.ValidScope("zone"), true)
+	assert.Equal(t, visits.ValidScope("floor"), false)
+}
+
+func TestSessioniseHolderChange(t *testing.T) {
+	start := time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)
+	checkIns := []visits.CheckIn{
+		{ID: 1, At: start, UserID: 7, BeaconID: 1},
+		{ID: 2, At: start.Add(5 * time.Minute), UserID: 7, BeaconID: 1},
+		// the PUC was handed to someone else at the same beacon
+		{ID: 3, At: start.Add(10 * time.Minute), UserID: 8, BeaconID: 1},
+	}
+
+	sessions := visits.Sessionise(checkIns, 15*time.Minute)
+	assert.Equal(t, len(sessions), 2)
+	assert.Equal(t, sessions[0].UserID, uint32(7))
+	assert.Equal(t, sessions[0].CheckIns, 2)
+	assert.Equal(t, sessions[1].UserID, uint32(8))
+	assert.Equal(t, sessions[1].FirstCheckInID, uint64(3))
+}